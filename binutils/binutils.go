@@ -31,8 +31,12 @@ func RunCmd(cmd *exec.Cmd) {
 	cmd.Wait()
 }
 
-func RunTunnelFG(envPath string) {
+// RunTunnelFG runs the tunnel process until it exits, env is added to the environment of the process
+func RunTunnelFG(envPath string, env ...string) {
 	cmd := exec.Command(BinPath("wireguard"), envPath, "--master-controlled")
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	RunCmd(cmd)
 }
 
@@ -0,0 +1,65 @@
+// +build !android
+
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2020 WireGuard LLC. All Rights Reserved.
+ */
+
+package conn
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToDevice restricts a socket to an interface using SO_BINDTODEVICE, the index 0 removes the restriction
+func bindToDevice(fd int, interfaceIndex uint32) error {
+	name := ""
+	if interfaceIndex != 0 {
+		iface, err := net.InterfaceByIndex(int(interfaceIndex))
+		if err != nil {
+			return err
+		}
+		name = iface.Name
+	}
+	return unix.SetsockoptString(fd, unix.SOL_SOCKET, unix.SO_BINDTODEVICE, name)
+}
+
+func (bind *nativeBind) BindSocketToInterface4(interfaceIndex uint32, blackhole bool) error {
+	if bind.sock4 == -1 {
+		return syscall.EAFNOSUPPORT
+	}
+	if err := bindToDevice(bind.sock4, interfaceIndex); err != nil {
+		return err
+	}
+	bind.blackhole4 = blackhole
+	return nil
+}
+
+func (bind *nativeBind) BindSocketToInterface6(interfaceIndex uint32, blackhole bool) error {
+	if bind.sock6 == -1 {
+		return syscall.EAFNOSUPPORT
+	}
+	if err := bindToDevice(bind.sock6, interfaceIndex); err != nil {
+		return err
+	}
+	bind.blackhole6 = blackhole
+	return nil
+}
+
+// BindUDPConnToInterface restricts a UDP socket to an interface so its packets leave through it whatever the routes are
+func BindUDPConnToInterface(c *net.UDPConn, interfaceIndex uint32) error {
+	sysconn, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	err2 := sysconn.Control(func(fd uintptr) {
+		err = bindToDevice(int(fd), interfaceIndex)
+	})
+	if err2 != nil {
+		return err2
+	}
+	return err
+}
@@ -60,9 +60,11 @@ func (endpoint *NativeEndpoint) dst6() *unix.SockaddrInet6 {
 }
 
 type nativeBind struct {
-	sock4    int
-	sock6    int
-	lastMark uint32
+	sock4      int
+	sock6      int
+	lastMark   uint32
+	blackhole4 bool
+	blackhole6 bool
 }
 
 var _ Endpoint = (*NativeEndpoint)(nil)
@@ -224,11 +226,17 @@ func (bind *nativeBind) Send(buff []byte, end Endpoint) error {
 		if bind.sock4 == -1 {
 			return syscall.EAFNOSUPPORT
 		}
+		if bind.blackhole4 {
+			return nil
+		}
 		return send4(bind.sock4, nend, buff)
 	} else {
 		if bind.sock6 == -1 {
 			return syscall.EAFNOSUPPORT
 		}
+		if bind.blackhole6 {
+			return nil
+		}
 		return send6(bind.sock6, nend, buff)
 	}
 }
@@ -6,6 +6,7 @@
 package device
 
 import (
+	"net"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -347,6 +348,14 @@ func (device *Device) LookupPeer(pk NoisePublicKey) *Peer {
 	return device.peers.keyMap[pk]
 }
 
+// LookupPeerByIP returns the peer whose allowed IPs contain ip, the one the packets from ip must come from
+func (device *Device) LookupPeerByIP(ip net.IP) *Peer {
+	if ip4 := ip.To4(); ip4 != nil {
+		return device.allowedips.LookupIPv4(ip4)
+	}
+	return device.allowedips.LookupIPv6(ip.To16())
+}
+
 func (device *Device) RemovePeer(key NoisePublicKey) {
 	device.peers.Lock()
 	defer device.peers.Unlock()
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/inverse-inc/wireguard-go/dns/request"
+	"github.com/inverse-inc/wireguard-go/util"
 	"github.com/miekg/dns"
 )
 
@@ -212,6 +213,12 @@ func (uh *UpstreamHost) InitDOH(u *reloadableUpstream) {
 		// Fallback to use system default resolvers, which located at /etc/resolv.conf
 	}
 
+	tlsConfig := u.transport.tlsConfig.Clone()
+	tlsConfig.InsecureSkipVerify = u.tlsInsecure
+	if len(u.tlsPins) > 0 {
+		tlsConfig.VerifyPeerCertificate = util.VerifySPKIPins(u.tlsPins)
+	}
+
 	dialer := &net.Dialer{
 		Timeout:   8 * time.Second,
 		KeepAlive: 30 * time.Second,
@@ -226,7 +233,7 @@ func (uh *UpstreamHost) InitDOH(u *reloadableUpstream) {
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   8 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig:       tlsConfig,
 	}
 	if u.noIPv6 {
 		httpTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
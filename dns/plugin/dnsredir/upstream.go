@@ -18,6 +18,7 @@ import (
 	pkgtls "github.com/inverse-inc/wireguard-go/dns/plugin/pkg/tls"
 	"github.com/inverse-inc/wireguard-go/dns/plugin/pkg/transport"
 	"github.com/inverse-inc/wireguard-go/dns/request"
+	"github.com/inverse-inc/wireguard-go/util"
 	"github.com/miekg/dns"
 )
 
@@ -33,6 +34,9 @@ type reloadableUpstream struct {
 	bootstrap     []string
 	noIPv6        bool
 	sourceNetwork net.IPNet
+	// TLS settings specific to the DoH upstreams
+	tlsInsecure bool
+	tlsPins     []string
 }
 
 // reloadableUpstream implements Upstream interface
@@ -397,6 +401,25 @@ func parseBlock(c *caddy.Controller, u *reloadableUpstream) error {
 		}
 		u.transport.tlsConfig.ServerName = serverName
 		log.Infof("%v: %v", dir, serverName)
+	case "tls_insecure":
+		args := c.RemainingArgs()
+		if len(args) != 0 {
+			return c.ArgErr()
+		}
+		u.tlsInsecure = true
+		log.Infof("%v: %v", dir, u.tlsInsecure)
+	case "tls_pin":
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return c.ArgErr()
+		}
+		for _, pin := range args {
+			if err := util.ValidateSPKIPin(pin); err != nil {
+				return c.Errf("%v: %v", dir, err)
+			}
+		}
+		u.tlsPins = append(u.tlsPins, args...)
+		log.Infof("%v: %v", dir, args)
 	case "bootstrap":
 		if err := parseBootstrap(c, u); err != nil {
 			return err
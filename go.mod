@@ -56,6 +56,7 @@ require (
 	google.golang.org/protobuf v1.25.0
 	gopkg.in/DataDog/dd-trace-go.v1 v1.27.1
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+	gopkg.in/yaml.v2 v2.3.0
 	gortc.io/stun v1.22.2
 	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
@@ -24,6 +24,7 @@ var messages = map[string]string{
 	ztn.STATUS_CONNECTED:      "Ready to connect to peers",
 	ztn.STATUS_ERROR:          "An error has occured",
 	ztn.STATUS_FETCHING_PEERS: "Obtaining list of peers from central server",
+	ztn.STATUS_DEGRADED:       "Unable to contact the central server, using the last known configuration",
 	ztn.STATUS_NOT_READY:      "Starting tunnel",
 }
 
@@ -169,6 +169,11 @@ func PromptCredentials(tabs *container.AppTabs, callback func(bool)) {
 	passwordEntry := NewPasswordField()
 	passwordEntry.PlaceHolder = spacePlaceholder
 
+	// Only asked on the first run, the keys of the device are created when connecting
+	needsEnrollment := ztn.NeedsEnrollment(ztn.AuthFilePath())
+	enrollmentTokenEntry := widget.NewEntry()
+	enrollmentTokenEntry.PlaceHolder = "Optional"
+
 	installRoutesFromServerEntry := widget.NewCheck("Install routes from server", func(bool) {})
 	installRoutesFromServerEntry.Checked = (loadEnvPreference(ztn.EnvHonorRoutes, "true") == "true")
 
@@ -211,6 +216,9 @@ func PromptCredentials(tabs *container.AppTabs, callback func(bool)) {
 
 		setEnv(ztn.EnvUsername, usernameEntry.Text, save)
 		binutils.Setenv(ztn.EnvPassword, base64.StdEncoding.EncodeToString([]byte(passwordEntry.Text)))
+		if needsEnrollment && enrollmentTokenEntry.Text != "" {
+			binutils.Setenv(ztn.EnvEnrollmentToken, enrollmentTokenEntry.Text)
+		}
 		setEnv(ztn.EnvServer, serverEntry.Text, save)
 		setEnv(ztn.EnvServerPort, serverPortEntry.Text, save)
 		verifySslStr := "y"
@@ -252,6 +260,14 @@ func PromptCredentials(tabs *container.AppTabs, callback func(bool)) {
 
 	passwordEntry.onEnter = connect
 
+	enrollmentTokenBox := widget.NewHBox(
+		widget.NewLabel("Enrollment token"),
+		enrollmentTokenEntry,
+	)
+	if !needsEnrollment {
+		enrollmentTokenBox.Hide()
+	}
+
 	connectionTab.Content = fyne.NewContainerWithLayout(
 		layout.NewCenterLayout(),
 		widget.NewVBox(
@@ -275,6 +291,7 @@ func PromptCredentials(tabs *container.AppTabs, callback func(bool)) {
 				widget.NewLabel("Password"),
 				passwordEntry,
 			),
+			enrollmentTokenBox,
 			fyne.NewContainerWithLayout(
 				layout.NewGridLayout(2),
 				widget.NewButton("Reset", reset),
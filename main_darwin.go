@@ -71,12 +71,14 @@ func warning() {
 func main() {
 	defer binutils.CapturePanic()
 
+	runSubcommand()
+
 	godotenv.Load(os.Args[1])
 
 	// get log level (default: info)
 
 	logLevel := func() int {
-		switch os.Getenv("LOG_LEVEL") {
+		switch ztn.GetConfig().LogLevel {
 		case "debug":
 			return device.LogLevelDebug
 		case "info":
@@ -103,16 +105,14 @@ func main() {
 		}()		
 		go checkParentIsAlive()
 
-		for {
-			binutils.RunTunnelFG(os.Args[1])
-		}
+		superviseInstances(os.Args[1])
 	} else {
 		outputlog.RedirectOutputToRotatedLog("/var/log/wireguard.log")
 
 		warning()
 
 		foreground := true
-		interfaceName := "utun8"
+		interfaceName := ztn.CurrentInstance().InterfaceName("utun", 8)
 
 		if !foreground {
 			foreground = os.Getenv(ENV_WG_PROCESS_FOREGROUND) == "1"
@@ -194,7 +194,7 @@ func main() {
 			env = append(env, fmt.Sprintf("%s=4", ENV_WG_UAPI_FD))
 			env = append(env, fmt.Sprintf("%s=1", ENV_WG_PROCESS_FOREGROUND))
 			files := [3]*os.File{}
-			if os.Getenv("LOG_LEVEL") != "" && logLevel != device.LogLevelSilent {
+			if ztn.GetConfig().IsSet("log_level") && logLevel != device.LogLevelSilent {
 				files[0], _ = os.Open(os.DevNull)
 				files[1] = os.Stdout
 				files[2] = os.Stderr
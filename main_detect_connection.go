@@ -3,9 +3,42 @@ package main
 import (
 	"fmt"
 	"net"
+	"sync"
 	"time"
+
+	"github.com/inverse-inc/wireguard-go/ztn"
 )
 
+// watchNetworkChanges calls onchange when the network changes, using the notifications of the system when it has them and polling it otherwise
+func watchNetworkChanges(serverHost string, onchange func()) {
+	poll := func() {
+		detectNetworkChange(serverHost, onchange)
+	}
+	if err := ztn.SubscribeNetworkChanges(logger, onchange, poll); err != nil {
+		logger.Info.Println("Polling the network to detect its changes:", err)
+		poll()
+	}
+}
+
+// onUnderlayChange returns a callback that only calls onchange when the path used to reach the Internet changed since the last call
+// The changes of the network that keep the same path, or that leave no path at all, are ignored
+func onUnderlayChange(stunServer string, onchange func()) func() {
+	var lock sync.Mutex
+	underlay := ztn.Underlay(stunServer)
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		current := ztn.Underlay(stunServer)
+		if current == "" || current == underlay {
+			logger.Debug.Println("The path to the Internet is unchanged:", underlay)
+			return
+		}
+		logger.Info.Println("The path to the Internet changed from", underlay, "to", current)
+		underlay = current
+		onchange()
+	}
+}
+
 func detectNetworkChange(serverHost string, onchange func()) {
 	go func() {
 		zeroIP := net.IPv4(0, 0, 0, 0)
@@ -2,21 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"net"
 	"os"
 	"strings"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	godnschange "github.com/inverse-inc/go-dnschange"
-	"github.com/inverse-inc/packetfence/go/remoteclients"
-	"github.com/inverse-inc/packetfence/go/sharedutils"
 	"github.com/inverse-inc/packetfence/go/timedlock"
 	"github.com/inverse-inc/packetfence/go/unifiedapiclient"
 	"github.com/inverse-inc/wireguard-go/device"
 	"github.com/inverse-inc/wireguard-go/dns/coremain"
+	"github.com/inverse-inc/wireguard-go/wgrpc"
 	"github.com/inverse-inc/wireguard-go/ztn"
 )
 
@@ -31,36 +31,24 @@ var GlobalTransactionLock *timedlock.RWLock
 
 var newPeer = make(chan string)
 
-func GenerateCoreDNSConfig(myDNSInfo *godnschange.DNSInfo, profile ztn.Profile, APIClient *unifiedapiclient.Client) string {
-
-	id, _ := GlobalTransactionLock.RLock()
-
-	defer GlobalTransactionLock.RUnlock(id)
-
-	var tpl bytes.Buffer
-
-	type Data struct {
-		Domains        []string
-		Nameservers    string
-		ZTNPeers       []string
-		API            string
-		SearchDomain   []string
-		InternalDomain string
-		ZTNServer      bool
-		Port           string
-	}
-
-	ZTNAddr := false
-
-	if net.ParseIP(APIClient.Host) == nil {
-		_, err := net.LookupIP(APIClient.Host)
-		if err != nil {
-			logger.Error.Println("Unknown host ", APIClient.Host)
-		} else {
-			ZTNAddr = true
-		}
-	}
+// The ID of this device in the events, it changes when the keys are rotated
+var dnsMyEventsID atomic.Value
+
+// dnsZone holds the names that are resolved through the server of one of the instances
+type dnsZone struct {
+	API        string
+	Port       string
+	TLSOptions string
+	ZTNServer  bool
+	Domains    []string
+	// The names of the peers, Names along with the local machine for the main instance
+	ZTNPeers       []string
+	Names          []string
+	InternalDomain string
+}
 
+// dnsZones returns the zone of the main instance followed by the ones of the additional instances that are running
+func dnsZones(profile ztn.Profile, APIClient *unifiedapiclient.Client) []dnsZone {
 	// Add local machine
 	hostname, err := os.Hostname()
 	var Peers []string
@@ -69,15 +57,85 @@ func GenerateCoreDNSConfig(myDNSInfo *godnschange.DNSInfo, profile ztn.Profile,
 	} else {
 		Peers = append(profile.NamesToResolve, hostname)
 	}
-	data := Data{
+
+	zones := []dnsZone{{
+		API:            APIClient.Host,
+		Port:           APIClient.Port,
+		TLSOptions:     coreDNSTLSOptions(ztn.APIClientConfig),
+		ZTNServer:      isZTNServerName(APIClient.Host),
 		Domains:        profile.DomainsToResolve,
 		ZTNPeers:       Peers,
-		Nameservers:    strings.Join(myDNSInfo.NameServers[:], " "),
-		API:            APIClient.Host,
-		SearchDomain:   myDNSInfo.SearchDomain,
-		ZTNServer:      ZTNAddr,
+		Names:          profile.NamesToResolve,
 		InternalDomain: profile.InternalDomainToResolve,
-		Port:           APIClient.Port,
+	}}
+
+	for _, instance := range ztn.Instances()[1:] {
+		zone, err := instanceDNSZone(instance)
+		if err != nil {
+			logger.Debug.Println("Not resolving the names of instance", instance, ":", err)
+			continue
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// instanceDNSZone fetches the names to resolve from the tunnel process of instance since this process has no API client for its server
+func instanceDNSZone(instance ztn.Instance) (dnsZone, error) {
+	config, err := ztn.LoadInstanceConfig(ztn.GetConfig(), instance.ConfigFile)
+	if err != nil {
+		return dnsZone{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := wgrpc.WGRPCInstanceClient(instance).GetDNSZones(ctx, &wgrpc.DNSZonesRequest{})
+	if err != nil {
+		return dnsZone{}, err
+	}
+
+	return dnsZone{
+		API:            config.Server,
+		Port:           config.ServerPort,
+		TLSOptions:     coreDNSTLSOptions(config),
+		ZTNServer:      isZTNServerName(config.Server),
+		Domains:        reply.Domains,
+		ZTNPeers:       reply.Names,
+		Names:          reply.Names,
+		InternalDomain: reply.InternalDomain,
+	}, nil
+}
+
+// isZTNServerName returns whether host is a name that must be resolved using the nameservers of the system
+func isZTNServerName(host string) bool {
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	if _, err := net.LookupIP(host); err != nil {
+		logger.Error.Println("Unknown host ", host)
+		return false
+	}
+	return true
+}
+
+func GenerateCoreDNSConfig(myDNSInfo *godnschange.DNSInfo, zones []dnsZone) string {
+
+	id, _ := GlobalTransactionLock.RLock()
+
+	defer GlobalTransactionLock.RUnlock(id)
+
+	var tpl bytes.Buffer
+
+	type Data struct {
+		Nameservers  string
+		SearchDomain []string
+		Zones        []dnsZone
+	}
+
+	data := Data{
+		Nameservers:  strings.Join(myDNSInfo.NameServers[:], " "),
+		SearchDomain: myDNSInfo.SearchDomain,
+		Zones:        zones,
 	}
 
 	t := template.New("Coreconfig")
@@ -87,26 +145,27 @@ func GenerateCoreDNSConfig(myDNSInfo *godnschange.DNSInfo, profile ztn.Profile,
 bind 127.0.0.69
 reload
 #debug
+{{ range $zone := .Zones }}
 {{ range .Domains }}{{ if ne . "" }}{{$domain := .}}
 dnsredir {{.}} {
-   to ietf-doh://{{ $.API }}:{{$.Port}}/dns-query
-}
+   to ietf-doh://{{ $zone.API }}:{{$zone.Port}}/dns-query
+{{ $zone.TLSOptions }}}
 {{ end }}{{ end }}
-dnsredir {{$.InternalDomain}} {
-	to ietf-doh://{{ $.API }}:{{$.Port}}/dns-ztn-query
-}
+dnsredir {{$zone.InternalDomain}} {
+	to ietf-doh://{{ $zone.API }}:{{$zone.Port}}/dns-ztn-query
+{{ $zone.TLSOptions }}}
 
 {{ range .ZTNPeers }}{{ if ne . "" }}{{$ztnpeer := .}}
 {{ range $.SearchDomain }}{{ if ne . "" }}
 dnsredir {{$ztnpeer}}.{{.}} {
-	to ietf-doh://{{ $.API }}:{{$.Port}}/dns-ztn-query
-}
+	to ietf-doh://{{ $zone.API }}:{{$zone.Port}}/dns-ztn-query
+{{ $zone.TLSOptions }}}
 {{ end }}{{ end }}{{ end }}{{ end }}
 {{ if .ZTNServer }}
-forward {{ .API }} {{ .Nameservers }} {
+forward {{ .API }} {{ $.Nameservers }} {
 	prefer_udp
 }
-{{ end }}
+{{ end }}{{ end }}
 forward . {{ .Nameservers }} {
 	prefer_udp
 }
@@ -117,6 +176,51 @@ forward . {{ .Nameservers }} {
 	return tpl.String()
 }
 
+// changeDNS makes the system resolve the names of all the zones using CoreDNS
+// The system configuration only has room for the internal domain and the server of the main instance, the ones of the other instances are handled as domains
+func changeDNS(dnsChange *godnschange.DNSStruct, zones []dnsZone) error {
+	main := zones[0]
+	domains := append([]string{}, main.Domains...)
+	names := append([]string{}, main.Names...)
+	for _, zone := range zones[1:] {
+		domains = append(domains, zone.Domains...)
+		if zone.InternalDomain != "" {
+			domains = append(domains, zone.InternalDomain)
+		}
+		names = append(names, zone.Names...)
+	}
+	return dnsChange.Change(LocalDNS, domains, names, main.InternalDomain, main.API)
+}
+
+// coreDNSTLSOptions returns the dnsredir directives that apply the TLS settings of the API client to the DoH upstreams
+func coreDNSTLSOptions(config *ztn.Config) string {
+	var sb strings.Builder
+	args := []string{}
+	if config.ClientCertFile != "" {
+		args = append(args, quoteCorefileArg(config.ClientCertFile), quoteCorefileArg(config.ClientKeyFile))
+	}
+	if config.ServerCAFile != "" {
+		args = append(args, quoteCorefileArg(config.ServerCAFile))
+	}
+	if len(args) > 0 {
+		sb.WriteString("\ttls " + strings.Join(args, " ") + "\n")
+	}
+	if !config.ServerVerifyTLS {
+		sb.WriteString("\ttls_insecure\n")
+	}
+	if len(config.ServerPinnedKeys) > 0 {
+		sb.WriteString("\ttls_pin " + strings.Join(config.ServerPinnedKeys, " ") + "\n")
+	}
+	return sb.String()
+}
+
+// quoteCorefileArg quotes a value so that the Corefile lexer reads it as a single argument
+// The lexer only unescapes the quotes, the backslashes of Windows paths are kept as is
+func quoteCorefileArg(v string) string {
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return `"` + v + `"`
+}
+
 func StartDNS() *godnschange.DNSStruct {
 	CoreDNSConfig = nil
 	GlobalTransactionLock = timedlock.NewRWLock()
@@ -126,12 +230,12 @@ func StartDNS() *godnschange.DNSStruct {
 
 	myDNSInfo := dnsChange.GetDNS()
 
-	if !sharedutils.IsEnabled(sharedutils.EnvOrDefault(ztn.EnvSetupDNS, "true")) {
-		logger.Info.Println("Not setting up DNS due to environment variable " + ztn.EnvSetupDNS)
+	if !ztn.GetConfig().SetupDNS {
+		logger.Info.Println("Not setting up DNS due to setup_dns (" + ztn.EnvSetupDNS + ") in the configuration")
 		return dnsChange
 	}
 
-	privateKey, publicKey := getKeys()
+	privateKey, publicKey := waitForKeys()
 
 	APIClient := ztn.GetAPIClient()
 
@@ -139,33 +243,47 @@ func StartDNS() *godnschange.DNSStruct {
 	profile.PrivateKey = base64.StdEncoding.EncodeToString(privateKey[:])
 	profile.PublicKey = base64.StdEncoding.EncodeToString(publicKey[:])
 
-	err := profile.FillProfileFromServer(connection, logger)
+	_, err := profile.FillProfileFromServerOrCache(connection, logger, ztn.NewReadOnlyProfileCache(ztn.ProfileCachePath(), profile.PrivateKey))
 	if err != nil {
 		logger.Error.Println("Got error when filling profile from server", err)
 		dnsChange.Success = false
 	} else {
-		detectNetworkChange(profile.STUNServer, func() {
+		// The DNS servers only change along with the path to the Internet
+		watchNetworkChanges(profile.STUNServer, onUnderlayChange(profile.STUNServer, func() {
 			// Recover dns configuration
 			dnsChange.RestoreDNS(LocalDNS)
 			dnsChange := godnschange.NewDNSChange()
 			myDNSInfo := dnsChange.GetDNS()
-			conf := GenerateCoreDNSConfig(myDNSInfo, profile, APIClient)
+			zones := dnsZones(profile, APIClient)
+			conf := GenerateCoreDNSConfig(myDNSInfo, zones)
 			CoreDNSConfig = &conf
-			err := dnsChange.Change(LocalDNS, profile.DomainsToResolve, profile.NamesToResolve, profile.InternalDomainToResolve, APIClient.Host)
+			err := changeDNS(dnsChange, zones)
 			if err != nil {
 				dnsChange.Success = false
 			} else {
 				dnsChange.Success = true
 			}
-		})
+		}))
 
-		go listenMyEvents(profile, dnsNewPeerHandler(profile))
+		// The events are received by the tunnel process which forwards them to us
+		resync := func() {
+			go func() {
+				newPeer <- ""
+			}()
+		}
+		dnsMyEventsID.Store(myEventsID(profile))
+		go wgrpc.ForwardEvents(logger, dnsEventDispatcher(func() string { return dnsMyEventsID.Load().(string) }), resync)
+		// The names of the additional instances are fetched again when their tunnel process starts and when their peers change
+		for _, instance := range ztn.Instances()[1:] {
+			go wgrpc.ForwardInstanceEvents(instance, logger, dnsEventDispatcher(func() string { return "" }), resync)
+		}
 
-		conf := GenerateCoreDNSConfig(myDNSInfo, profile, APIClient)
+		zones := dnsZones(profile, APIClient)
+		conf := GenerateCoreDNSConfig(myDNSInfo, zones)
 		CoreDNSConfig = &conf
 		// Clean old modifications
 		dnsChange.RestoreDNS(LocalDNS)
-		err := dnsChange.Change(LocalDNS, profile.DomainsToResolve, profile.NamesToResolve, profile.InternalDomainToResolve, APIClient.Host)
+		err := changeDNS(dnsChange, zones)
 		if err != nil {
 			dnsChange.Success = false
 		} else {
@@ -198,30 +316,32 @@ func pooling(connection *ztn.Connection, logger *device.Logger, myDNSInfo *godns
 		case <-newPeer:
 			logger.Info.Println("Discovered new peer, reload DNS configuration")
 			defer recoverPooling(connection, logger, myDNSInfo, profile, dnsChange, conf, APIClient)
-			err := profile.FillProfileFromServer(connection, logger)
+			err := refreshDNSProfile(connection, logger, profile)
 			if err != nil {
 				logger.Error.Println("Something went wrong on profile refresh", err)
 			}
-			*conf = GenerateCoreDNSConfig(myDNSInfo, *profile, APIClient)
+			zones := dnsZones(*profile, APIClient)
+			*conf = GenerateCoreDNSConfig(myDNSInfo, zones)
 			if *conf != *CoreDNSConfig {
 				CoreDNSConfig = conf
 				dnsChange.RestoreDNS(LocalDNS)
-				err := dnsChange.Change(LocalDNS, profile.DomainsToResolve, profile.NamesToResolve, profile.InternalDomainToResolve, APIClient.Host)
+				err := changeDNS(dnsChange, zones)
 				if err != nil {
 					logger.Error.Println("Unable to change the dns configuration ", err)
 				}
 			}
 		case <-time.After(10 * time.Minute):
 			defer recoverPooling(connection, logger, myDNSInfo, profile, dnsChange, conf, APIClient)
-			err := profile.FillProfileFromServer(connection, logger)
+			err := refreshDNSProfile(connection, logger, profile)
 			if err != nil {
 				logger.Error.Println("Something went wrong on profile refresh", err)
 			}
-			*conf = GenerateCoreDNSConfig(myDNSInfo, *profile, APIClient)
+			zones := dnsZones(*profile, APIClient)
+			*conf = GenerateCoreDNSConfig(myDNSInfo, zones)
 			if *conf != *CoreDNSConfig {
 				CoreDNSConfig = conf
 				dnsChange.RestoreDNS(LocalDNS)
-				err := dnsChange.Change(LocalDNS, profile.DomainsToResolve, profile.NamesToResolve, profile.InternalDomainToResolve, APIClient.Host)
+				err := changeDNS(dnsChange, zones)
 				if err != nil {
 					logger.Error.Println("Unable to change the dns configuration ", err)
 				}
@@ -230,6 +350,15 @@ func pooling(connection *ztn.Connection, logger *device.Logger, myDNSInfo *godns
 	}
 }
 
+// refreshDNSProfile fills the profile from the server using the keys of the auth file since the tunnel process may have rotated them
+func refreshDNSProfile(connection *ztn.Connection, logger *device.Logger, profile *ztn.Profile) error {
+	if reloadKeys(profile) {
+		logger.Info.Println("The keys of this device were rotated, using the new public key", profile.PublicKey)
+		dnsMyEventsID.Store(myEventsID(*profile))
+	}
+	return profile.FillProfileFromServer(connection, logger)
+}
+
 func recoverPooling(connection *ztn.Connection, logger *device.Logger, myDNSInfo *godnschange.DNSInfo, profile *ztn.Profile, dnsChange *godnschange.DNSStruct, conf *string, APIClient *unifiedapiclient.Client) {
 	if r := recover(); r != nil {
 		go func() {
@@ -238,18 +367,32 @@ func recoverPooling(connection *ztn.Connection, logger *device.Logger, myDNSInfo
 	}
 }
 
-func dnsNewPeerHandler(profile ztn.Profile) func(ztn.Event) {
-	pub, err := remoteclients.B64KeyToBytes(profile.PublicKey)
-	sharedutils.CheckError(err)
-	myID := base64.URLEncoding.EncodeToString(pub[:])
-	return func(event ztn.Event) {
-		data := map[string]interface{}{}
-		err = json.Unmarshal(event.Data, &data)
-		if event.Type == "new_peer" && data["id"].(string) != myID {
-			logger.Info.Println("Received new peer from pub/sub", data["id"].(string))
-			go func() {
-				newPeer <- data["id"].(string)
-			}()
-		}
+// dnsEventDispatcher reloads the DNS configuration when the peers change, the events about the ID returned by myID are ignored
+func dnsEventDispatcher(myID func() string) *ztn.EventDispatcher {
+	reload := func(id string) {
+		go func() {
+			newPeer <- id
+		}()
 	}
+
+	dispatcher := ztn.NewEventDispatcher()
+	dispatcher.OnNewPeer(func(e ztn.NewPeerEvent) {
+		if e.ID != myID() {
+			logger.Info.Println("Received new peer from pub/sub", e.ID)
+			reload(e.ID)
+		}
+	})
+	dispatcher.OnPeerRemoved(func(e ztn.PeerRemovedEvent) {
+		logger.Info.Println("Received removed peer from pub/sub", e.ID)
+		reload(e.ID)
+	})
+	dispatcher.OnPeerUpdated(func(e ztn.PeerUpdatedEvent) {
+		logger.Info.Println("Received updated peer from pub/sub", e.ID)
+		reload(e.ID)
+	})
+	dispatcher.OnProfileUpdated(func(e ztn.ProfileUpdatedEvent) {
+		logger.Info.Println("Received profile update from pub/sub")
+		reload("")
+	})
+	return dispatcher
 }
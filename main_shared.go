@@ -3,15 +3,14 @@ package main
 //go:generate go run dns/directives_generate.go
 
 import (
+	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"os/user"
-	"path"
 	"runtime/debug"
 	"syscall"
 	"time"
@@ -29,17 +28,108 @@ import (
 	_ "net/http/pprof"
 )
 
+// The ports of the main instance, the other instances use offset ports
 const mainConnectionPort = 12673
+const pprofPort = 6060
 
 var connection *ztn.Connection
 
 var masterProcess bool
 
+func printSubcommandUsage() {
+	fmt.Printf("usage:\n")
+	fmt.Printf("%s config check FILE\n", os.Args[0])
+	fmt.Printf("%s key rotate [INSTANCE]\n", os.Args[0])
+}
+
+// runSubcommand runs the subcommand found in the arguments and exits, if there is one
+func runSubcommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	switch {
+	case os.Args[1] == "config" && len(os.Args) == 4 && os.Args[2] == "check":
+		runConfigCheck()
+	case os.Args[1] == "key" && (len(os.Args) == 3 || len(os.Args) == 4) && os.Args[2] == "rotate":
+		runKeyRotate()
+	case os.Args[1] == "config" || os.Args[1] == "key":
+		printSubcommandUsage()
+		os.Exit(1)
+	}
+}
+
+func runConfigCheck() {
+	config, err := ztn.LoadConfig(os.Args[3])
+	fmt.Print(config.Describe())
+	if err != nil {
+		fmt.Println()
+		fmt.Println("The configuration is invalid:")
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runKeyRotate asks the running tunnel of the main instance or of the instance named in the arguments to rotate its keys
+func runKeyRotate() {
+	instance := ztn.CurrentInstance()
+	if len(os.Args) == 4 {
+		var err error
+		instance, err = ztn.FindInstance(os.Args[3])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	reply, err := wgrpc.WGRPCInstanceClient(instance).RotateKey(context.Background(), &wgrpc.RotateKeyRequest{})
+	if err != nil {
+		fmt.Println("Unable to rotate the keys:", err)
+		os.Exit(1)
+	}
+	fmt.Println("The new public key is", reply.PublicKey)
+	os.Exit(0)
+}
+
 func setMasterProcess() {
 	masterProcess = true
 	setupMasterQuit()
 }
 
+// superviseInstances runs the tunnel process of each instance and restarts it when it exits
+func superviseInstances(envPath string) {
+	instances := ztn.Instances()
+	for _, instance := range instances[1:] {
+		logger.Info.Println("Starting the additional instance", instance, "configured in", instance.ConfigFile)
+		go superviseInstance(envPath, instance)
+	}
+
+	superviseInstance(envPath, instances[0])
+}
+
+// superviseInstance runs the tunnel process of the instance forever
+// The restarts are delayed further each time the process exits shortly after starting so that a crashing instance doesn't spin
+func superviseInstance(envPath string, instance ztn.Instance) {
+	const minBackoff = 1 * time.Second
+	const maxBackoff = 1 * time.Minute
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		binutils.RunTunnelFG(envPath, instance.Env())
+
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+		logger.Error.Println("The tunnel process of the instance", instance, "exited, restarting it in", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
 func tryFindBindTechnique(todo func() bool) {
 	done := false
 	for !done {
@@ -78,6 +168,19 @@ func startInverse(interfaceName string, device *device.Device) {
 		}
 	})
 
+	go tryFindBindTechnique(func() bool {
+		if ztn.NewPCP().CheckNet() == nil {
+			logger.Info.Println("Router supports PCP, it will be used to create public P2P connections")
+			ztn.BindTechniques.Add(ztn.BindPCP)
+			go func() {
+				bindTechniqueDone <- true
+			}()
+			return true
+		} else {
+			return false
+		}
+	})
+
 	go tryFindBindTechnique(func() bool {
 		if ztn.NewNATPMP().CheckNet() == nil {
 			logger.Info.Println("Router supports NAT PMP, it will be used to create public P2P connections")
@@ -105,12 +208,29 @@ func startInverse(interfaceName string, device *device.Device) {
 		go checkParentIsAlive()
 	}
 
+	if authFile := ztn.AuthFilePath(); ztn.NeedsEnrollment(authFile) {
+		logger.Info.Println("No keys found in", authFile, "enrolling this device")
+		if err := ztn.Enroll(authFile, logger); err != nil {
+			logger.Error.Println("Unable to enroll this device", err)
+			connection.Update(func() {
+				connection.Status = ztn.STATUS_ERROR
+				connection.LastError = err
+			})
+			ztn.PauseOnError(quit)
+		}
+	}
+
+	if err := ztn.RecoverKeyRotation(ztn.AuthFilePath(), logger); err != nil {
+		logger.Error.Println("Unable to recover the interrupted key rotation:", err)
+	}
+
 	privateKey, publicKey := getKeys()
 
 	profile := ztn.Profile{}
 	profile.PrivateKey = base64.StdEncoding.EncodeToString(privateKey[:])
 	profile.PublicKey = base64.StdEncoding.EncodeToString(publicKey[:])
-	err := profile.FillProfileFromServer(connection, logger)
+	connection.ProfileCache = ztn.NewProfileCache(ztn.ProfileCachePath(), profile.PrivateKey)
+	fromCache, err := profile.FillProfileFromServerOrCache(connection, logger, connection.ProfileCache)
 	if err != nil {
 		logger.Error.Println("Got error when filling profile from server", err)
 		connection.Update(func() {
@@ -122,11 +242,6 @@ func startInverse(interfaceName string, device *device.Device) {
 
 	connection.Profile = &profile
 
-	detectNetworkChange(profile.STUNServer, func() {
-		logger.Info.Println("Detected a network change, exiting...")
-		quit()
-	})
-
 	connection.Update(func() {
 		connection.Status = ztn.STATUS_FETCHING_PEERS
 		connection.LastError = err
@@ -142,14 +257,37 @@ func startInverse(interfaceName string, device *device.Device) {
 		ztn.PauseOnError(quit)
 	}
 
-	networkConnection := ztn.NewNetworkConnection("MAIN", logger, mainConnectionPort)
+	if fromCache {
+		logger.Info.Println("Server is unreachable, running in degraded mode using the cached profile")
+		connection.Update(func() {
+			connection.Status = ztn.STATUS_DEGRADED
+			connection.LastError = errors.New("Unable to contact the server, using the cached profile")
+		})
+	}
+
+	networkConnection := ztn.NewNetworkConnection("MAIN", logger, ztn.CurrentInstance().Port(mainConnectionPort))
 	networkConnection.Connection = connection
+	networkConnection.BindScores = ztn.NewBindScores(ztn.BindScoresPath())
+	if err := networkConnection.BindScores.Load(); err != nil && !os.IsNotExist(err) {
+		logger.Error.Println("Unable to load the scores of the bind techniques:", err)
+	}
+
+	eventSubscription := ztn.NewEventSubscription(connection, logger)
+	keyRotator := ztn.NewKeyRotator(connection, device, networkConnection, eventSubscription, logger, ztn.AuthFilePath())
 
 	wgrpc.WGRPCServer.SetNetworkConnection(networkConnection)
+	wgrpc.WGRPCServer.SetEventSubscription(eventSubscription)
+	wgrpc.WGRPCServer.SetKeyRotator(keyRotator)
 	wgrpc.WGRPCServer.AddDebugable(networkConnection)
 
 	go networkConnection.Start()
 
+	onNetworkChange := func() {
+		logger.Info.Println("Detected a network change, reconnecting the peers whose path changed")
+		connection.HandleNetworkChange(networkConnection)
+	}
+	watchNetworkChanges(profile.STUNServer, onNetworkChange)
+
 	filter := filter.NewFilterFromAcls(profile.ACLs)
 	device.SetReceiveFilter(filter)
 
@@ -157,70 +295,142 @@ func startInverse(interfaceName string, device *device.Device) {
 		connection.StartPeer(device, profile, peerID, networkConnection)
 	}
 
-	go listenMyEvents(profile, connectNewPeerHandler(device, networkConnection, profile))
+	if ztn.GetConfig().LANDiscovery {
+		if err := ztn.NewLANDiscovery(connection, logger).Start(); err != nil {
+			logger.Error.Println("Unable to start the LAN discovery:", err)
+		}
+	}
+
+	profileRefresher := ztn.NewProfileRefresher(connection, device, networkConnection, logger)
+
+	if fromCache {
+		// Events can only be received once the server is reachable
+		go profile.WaitForServerProfile(connection.ProfileCache, func(fresh ztn.Profile) {
+			profileRefresher.Apply(fresh)
+			connection.Update(func() {
+				connection.Status = ztn.STATUS_CONNECTED
+				connection.LastError = nil
+			})
+			go profileRefresher.Start()
+			go keyRotator.Start()
+			go eventSubscription.Start(fresh)
+			go eventSubscription.Listen(tunnelEventDispatcher(device, networkConnection, profileRefresher), profileRefresher.Refresh)
+		}, func(err error) {
+			connection.Update(func() {
+				connection.Status = ztn.STATUS_ERROR
+				connection.LastError = err
+			})
+			ztn.PauseOnError(quit)
+		})
+	} else {
+		go profileRefresher.Start()
+		go keyRotator.Start()
+		go eventSubscription.Start(profile)
+		go eventSubscription.Listen(tunnelEventDispatcher(device, networkConnection, profileRefresher), profileRefresher.Refresh)
+	}
 
 	go func() {
 		//PPROF
-		log.Println(http.ListenAndServe("localhost:6060", nil))
+		log.Println(http.ListenAndServe(fmt.Sprintf("localhost:%d", ztn.CurrentInstance().Port(pprofPort)), nil))
 	}()
 
 }
 
 func getKeys() ([32]byte, [32]byte) {
-	usr, err := user.Current()
-	sharedutils.CheckError(err)
-	authFile := path.Join(usr.HomeDir, "auth.json")
+	authFile := ztn.AuthFilePath()
 
 	logger.Info.Println("Using auth file:", authFile)
 
 	return remoteclients.GetKeysFromFile(authFile)
 }
 
-func connectNewPeerHandler(device *device.Device, networkConnection *ztn.NetworkConnection, profile ztn.Profile) func(ztn.Event) {
-	pub, err := remoteclients.B64KeyToBytes(profile.PublicKey)
-	sharedutils.CheckError(err)
-	myID := base64.URLEncoding.EncodeToString(pub[:])
-	return func(event ztn.Event) {
-		data := map[string]interface{}{}
-		err = json.Unmarshal(event.Data, &data)
-		if event.Type == "new_peer" && data["id"].(string) != myID {
-			logger.Info.Println("Received new peer from pub/sub", data["id"].(string))
-			connection.StartPeer(device, profile, data["id"].(string), networkConnection)
+// waitForKeys returns the keys of this device once the tunnel process has enrolled it
+func waitForKeys() ([32]byte, [32]byte) {
+	authFile := ztn.AuthFilePath()
+	if ztn.NeedsEnrollment(authFile) {
+		logger.Info.Println("Waiting for this device to be enrolled")
+		for ztn.NeedsEnrollment(authFile) {
+			time.Sleep(1 * time.Second)
 		}
 	}
+	return getKeys()
 }
 
-func listenMyEvents(profile ztn.Profile, eventHandler func(e ztn.Event)) {
-	chal, err := ztn.GetServerChallenge(&profile)
-	if err != nil {
-		logger.Error.Println("Got an error while starting to listen events", err)
-		if connection != nil {
-			connection.Update(func() {
-				connection.Status = ztn.STATUS_ERROR
-				connection.LastError = err
-			})
-		}
+// reloadKeys updates the keys of the profile from the auth file and returns whether they changed
+// It lets the processes other than the tunnel process follow the key rotations
+func reloadKeys(profile *ztn.Profile) bool {
+	privateKey, publicKey := getKeys()
+	b64PrivateKey := base64.StdEncoding.EncodeToString(privateKey[:])
+	if b64PrivateKey == profile.PrivateKey {
+		return false
 	}
+	profile.PrivateKey = b64PrivateKey
+	profile.PublicKey = base64.StdEncoding.EncodeToString(publicKey[:])
+	return true
+}
 
-	priv, err := remoteclients.B64KeyToBytes(profile.PrivateKey)
-	sharedutils.CheckError(err)
+func myEventsID(profile ztn.Profile) string {
 	pub, err := remoteclients.B64KeyToBytes(profile.PublicKey)
 	sharedutils.CheckError(err)
-	serverPub, err := remoteclients.URLB64KeyToBytes(chal.PublicKey)
-	sharedutils.CheckError(err)
+	return base64.URLEncoding.EncodeToString(pub[:])
+}
 
-	c := ztn.GLPPrivateClient(priv, pub, serverPub)
-	c.LogErrors = true
-	c.Start(ztn.APIClientCtx)
-	for {
-		select {
-		case e := <-c.EventsChan:
-			event := ztn.Event{}
-			err := json.Unmarshal(e.Data, &event)
-			sharedutils.CheckError(err)
-			eventHandler(event)
-		}
+func tunnelEventDispatcher(device *device.Device, networkConnection *ztn.NetworkConnection, profileRefresher *ztn.ProfileRefresher) *ztn.EventDispatcher {
+	currentProfile := func() ztn.Profile {
+		var p ztn.Profile
+		connection.Update(func() {
+			p = *connection.Profile
+		})
+		return p
+	}
+	// The ID of this device changes when its keys are rotated
+	isMyID := func(id string) bool {
+		return id == myEventsID(currentProfile())
 	}
+
+	dispatcher := ztn.NewEventDispatcher()
+	dispatcher.OnNewPeer(func(e ztn.NewPeerEvent) {
+		if !isMyID(e.ID) {
+			logger.Info.Println("Received new peer from pub/sub", e.ID)
+			connection.StartPeer(device, currentProfile(), e.ID, networkConnection)
+		}
+	})
+	dispatcher.OnPeerRemoved(func(e ztn.PeerRemovedEvent) {
+		if isMyID(e.ID) {
+			logger.Info.Println("This device was removed, disconnecting from all the peers")
+			connection.StopPeers()
+		} else {
+			logger.Info.Println("Received removed peer from pub/sub", e.ID)
+			connection.StopPeer(e.ID)
+		}
+	})
+	dispatcher.OnPeerUpdated(func(e ztn.PeerUpdatedEvent) {
+		if !isMyID(e.ID) {
+			logger.Info.Println("Received updated peer from pub/sub", e.ID)
+			connection.RestartPeer(device, currentProfile(), e.ID, networkConnection)
+		}
+	})
+	dispatcher.OnProfileUpdated(func(e ztn.ProfileUpdatedEvent) {
+		logger.Info.Println("Received profile update from pub/sub")
+		profileRefresher.Refresh()
+	})
+	dispatcher.OnACLUpdated(func(e ztn.ACLUpdatedEvent) {
+		logger.Info.Println("Received ACL update from pub/sub")
+		if e.ACLs != nil {
+			device.SetReceiveFilter(filter.NewFilterFromAcls(e.ACLs))
+		}
+		profileRefresher.Refresh()
+	})
+	dispatcher.OnForceReconnect(func(e ztn.ForceReconnectEvent) {
+		if e.ID == "" {
+			logger.Info.Println("Received forced reconnection of all the peers from pub/sub")
+			connection.ReconnectPeers()
+		} else {
+			logger.Info.Println("Received forced reconnection from pub/sub for", e.ID)
+			connection.ReconnectPeer(e.ID)
+		}
+	})
+	return dispatcher
 }
 
 func findppid(pid int) int {
@@ -260,6 +470,7 @@ func quit() {
 		fmt.Println("Master process is exiting")
 	} else {
 		ztn.UPNPIGDCleanupMapped()
+		ztn.PCPCleanupMapped()
 	}
 	os.Exit(0)
 }
@@ -35,6 +35,8 @@ var DNSChange *godnschange.DNSStruct
 func main() {
 	defer binutils.CapturePanic()
 
+	runSubcommand()
+
 	outputlog.RedirectOutputToRotatedLog("C:\\Program Files\\PacketFence-Zero-Trust-Client\\wireguard.log")
 
 	godotenv.Load(os.Args[1])
@@ -53,11 +55,9 @@ func main() {
 		}()
 		go checkParentIsAlive()
 
-		for {
-			binutils.RunTunnelFG(os.Args[1])
-		}
+		superviseInstances(os.Args[1])
 	} else {
-		interfaceName := "wg0"
+		interfaceName := ztn.CurrentInstance().InterfaceName("wg", 0)
 
 		logger = device.NewLogger(
 			device.LogLevelInfo,
@@ -13,3 +13,11 @@ func Add(ipnet *net.IPNet, gw net.IP) error {
 	}
 	return err
 }
+
+func Delete(ipnet *net.IPNet, gw net.IP) error {
+	res, err := exec.Command("ip", "route", "del", ipnet.String(), "via", gw.String()).Output()
+	if err != nil {
+		fmt.Println(string(res))
+	}
+	return err
+}
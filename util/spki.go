@@ -0,0 +1,47 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// SPKIHash returns the base64 encoded SHA-256 hash of the public key of a certificate, as used for public key pinning
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ValidateSPKIPin checks that a pin is a base64 encoded SHA-256 hash
+func ValidateSPKIPin(pin string) error {
+	sum, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("%s is not a base64 encoded SHA-256 hash", pin)
+	}
+	return nil
+}
+
+// VerifySPKIPins returns a function to use as the VerifyPeerCertificate of a tls.Config
+// The peer is only accepted when one of the certificates it presents has the public key of one of the pins
+// It is called even when InsecureSkipVerify is set so pinning alone can be used to trust a self-signed certificate
+func VerifySPKIPins(pins []string) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	allowed := map[string]bool{}
+	for _, pin := range pins {
+		allowed[pin] = true
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				continue
+			}
+			if allowed[SPKIHash(cert)] {
+				return nil
+			}
+		}
+		return errors.New("None of the certificates presented by the server match the pinned public keys")
+	}
+}
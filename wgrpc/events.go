@@ -0,0 +1,60 @@
+package wgrpc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"github.com/inverse-inc/wireguard-go/ztn"
+)
+
+// ForwardEvents subscribes to the events received by the tunnel process and dispatches them in this process
+// onResync is called when the tunnel process restarted or when events were missed, in which case the state must be fetched again from the server
+func ForwardEvents(logger *device.Logger, dispatcher *ztn.EventDispatcher, onResync func()) {
+	ForwardInstanceEvents(ztn.CurrentInstance(), logger, dispatcher, onResync)
+}
+
+// ForwardInstanceEvents forwards the events received by the tunnel process of instance
+func ForwardInstanceEvents(instance ztn.Instance, logger *device.Logger, dispatcher *ztn.EventDispatcher, onResync func()) {
+	client := WGRPCInstanceClient(instance)
+	streamID := ""
+	var cursor uint64
+	for {
+		// The token is read again since the tunnel process generates a new one when it restarts
+		ctx, err := withToken(context.Background(), instance)
+		var stream WGService_SubscribeEventsClient
+		if err == nil {
+			stream, err = client.SubscribeEvents(ctx, &SubscribeEventsRequest{StreamID: streamID, Since: cursor})
+		}
+		for err == nil {
+			var reply *EventReply
+			reply, err = stream.Recv()
+			if err != nil {
+				break
+			}
+			if reply.Resync {
+				streamID = reply.StreamID
+				cursor = reply.Cursor
+				logger.Info.Println("Events were missed, resynchronizing")
+				onResync()
+				continue
+			}
+			// The cursor is the sequence ID of the event in its stream, the events that were already handled are dropped
+			if reply.StreamID == streamID && reply.Cursor <= cursor {
+				logger.Debug.Println("Ignoring the event", reply.Cursor, "which was already handled")
+				continue
+			}
+			streamID = reply.StreamID
+			cursor = reply.Cursor
+			event := ztn.Event{Type: reply.Type, Data: reply.Data, Timestamp: reply.Timestamp}
+			if err := dispatcher.Dispatch(event); err != nil {
+				logger.Error.Println("Unable to handle event:", err)
+			}
+		}
+		if err != io.EOF {
+			logger.Debug.Println("Lost the events subscription, reconnecting:", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -2,8 +2,10 @@ package wgrpc
 
 import (
 	context "context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	sync "sync"
 	"time"
 
@@ -19,8 +21,12 @@ type WGServiceServerHandler struct {
 	UnimplementedWGServiceServer
 	connection        *ztn.Connection
 	networkConnection *ztn.NetworkConnection
+	eventSubscription *ztn.EventSubscription
+	keyRotator        *ztn.KeyRotator
 	debugables        []Debugable
 	onexit            func()
+	// The token the clients must present to subscribe to the events, see checkToken
+	token string
 }
 
 func NewWGServiceServerHandler(connection *ztn.Connection, onexit func()) *WGServiceServerHandler {
@@ -48,6 +54,22 @@ func (s *WGServiceServerHandler) GetStatus(ctx context.Context, in *StatusReques
 	sr := &StatusReply{Status: s.connection.Status, LastError: errStr}
 	if s.networkConnection != nil {
 		sr.CurrentBindTechnique = string(s.networkConnection.BindTechnique)
+		sr.Network = s.networkConnection.GetNetworkID()
+		if s.networkConnection.BindScores != nil && sr.Network != "" {
+			for bt, score := range s.networkConnection.BindScores.Scores(sr.Network) {
+				sr.BindTechniqueScores = append(sr.BindTechniqueScores, &BindTechniqueScore{
+					BindTechnique:          string(bt),
+					Attempts:               int64(score.Attempts),
+					Successes:              int64(score.Successes),
+					SuccessRate:            score.SuccessRate(),
+					AverageTimeToConnectMs: score.AverageTimeToConnect().Milliseconds(),
+					Score:                  score.Score(),
+				})
+			}
+			sort.Slice(sr.BindTechniqueScores, func(i, j int) bool {
+				return sr.BindTechniqueScores[i].Score > sr.BindTechniqueScores[j].Score
+			})
+		}
 	}
 	return sr, nil
 }
@@ -91,3 +113,115 @@ func (s *WGServiceServerHandler) PrintDebug(ctx context.Context, in *PrintDebugR
 func (s *WGServiceServerHandler) SetNetworkConnection(networkConnection *ztn.NetworkConnection) {
 	s.networkConnection = networkConnection
 }
+
+func (s *WGServiceServerHandler) SetEventSubscription(eventSubscription *ztn.EventSubscription) {
+	s.Lock()
+	defer s.Unlock()
+	s.eventSubscription = eventSubscription
+}
+
+func (s *WGServiceServerHandler) SetKeyRotator(keyRotator *ztn.KeyRotator) {
+	s.Lock()
+	defer s.Unlock()
+	s.keyRotator = keyRotator
+}
+
+// RotateKey replaces the key pair of this device right away
+func (s *WGServiceServerHandler) RotateKey(ctx context.Context, in *RotateKeyRequest) (*RotateKeyReply, error) {
+	s.Lock()
+	kr := s.keyRotator
+	s.Unlock()
+	if kr == nil {
+		return nil, errors.New("Key rotation isn't available yet")
+	}
+
+	publicKey, err := kr.Rotate()
+	if err != nil {
+		return nil, err
+	}
+	return &RotateKeyReply{PublicKey: publicKey}, nil
+}
+
+// GetDNSZones returns the names the DNS of the master process must resolve through the server of this instance
+func (s *WGServiceServerHandler) GetDNSZones(ctx context.Context, in *DNSZonesRequest) (*DNSZonesReply, error) {
+	s.connection.Lock()
+	defer s.connection.Unlock()
+	if s.connection.Profile == nil {
+		return nil, errors.New("The profile isn't available yet")
+	}
+	profile := s.connection.Profile
+	return &DNSZonesReply{
+		Domains:        profile.DomainsToResolve,
+		Names:          profile.NamesToResolve,
+		InternalDomain: profile.InternalDomainToResolve,
+	}, nil
+}
+
+// ListBridges returns the peers this device bridges for and the traffic it relayed for them
+func (s *WGServiceServerHandler) ListBridges(ctx context.Context, in *BridgesRequest) (*BridgesReply, error) {
+	if ztn.PeerServer == nil {
+		return nil, errors.New("The peer service isn't running yet")
+	}
+	reply := &BridgesReply{Bridges: []*BridgeReply{}}
+	for _, b := range ztn.PeerServer.Bridges() {
+		reply.Bridges = append(reply.Bridges, &BridgeReply{
+			PeerID:         b.PeerID,
+			Hostname:       b.Hostname,
+			IpAddress:      b.IP,
+			ConnectionType: b.ConnectionType,
+			Since:          b.Since.Unix(),
+			RxBytes:        b.RxBytes,
+			RxPackets:      b.RxPackets,
+			TxBytes:        b.TxBytes,
+			TxPackets:      b.TxPackets,
+			DroppedBytes:   b.DroppedBytes,
+			DroppedPackets: b.DroppedPackets,
+		})
+	}
+	return reply, nil
+}
+
+// SubscribeEvents streams the events received by this process so that other processes don't need their own connection to the server
+func (s *WGServiceServerHandler) SubscribeEvents(in *SubscribeEventsRequest, stream WGService_SubscribeEventsServer) error {
+	if err := checkToken(stream.Context(), s.token); err != nil {
+		return err
+	}
+
+	s.Lock()
+	es := s.eventSubscription
+	s.Unlock()
+	if es == nil {
+		return errors.New("Events aren't available yet")
+	}
+
+	sub := es.Subscribe(in.StreamID, in.Since)
+	defer es.Unsubscribe(sub)
+
+	if sub.Resync {
+		err := stream.Send(&EventReply{StreamID: es.StreamID, Cursor: sub.Since, Resync: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case se, ok := <-sub.C:
+			if !ok {
+				return errors.New("Subscriber is too slow to consume the events")
+			}
+			err := stream.Send(&EventReply{
+				StreamID:  es.StreamID,
+				Cursor:    se.Cursor,
+				Type:      se.Event.Type,
+				Data:      se.Event.Data,
+				Timestamp: se.Event.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
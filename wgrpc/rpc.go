@@ -11,25 +11,37 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+// The port of the main instance, the other instances use an offset port
 const ServerPort = 6970
 
 var WGRPCServer *WGServiceServerHandler
 
 func StartRPC(logger *device.Logger, connection *ztn.Connection, onexit func()) {
-	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ServerPort))
+	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ztn.CurrentInstance().Port(ServerPort)))
 	sharedutils.CheckError(err)
 	grpcServer := grpc.NewServer()
 
+	// Any local user can reach the port, the events are only streamed to the processes that can read the token
+	token, err := writeToken(ztn.CurrentInstance())
+	sharedutils.CheckError(err)
+
 	WGRPCServer = NewWGServiceServerHandler(connection, onexit)
+	WGRPCServer.token = token
 	RegisterWGServiceServer(grpcServer, WGRPCServer)
 
 	reflection.Register(grpcServer)
 	grpcServer.Serve(lis)
 }
 
+// WGRPCClient returns a client of the tunnel process of the current instance
 func WGRPCClient() WGServiceClient {
+	return WGRPCInstanceClient(ztn.CurrentInstance())
+}
+
+// WGRPCInstanceClient returns a client of the tunnel process of instance
+func WGRPCInstanceClient(instance ztn.Instance) WGServiceClient {
 	conn, err := grpc.Dial(
-		fmt.Sprintf("127.0.0.1:%d", ServerPort),
+		fmt.Sprintf("127.0.0.1:%d", instance.Port(ServerPort)),
 		grpc.WithInsecure(),
 	)
 	sharedutils.CheckError(err)
@@ -0,0 +1,61 @@
+package wgrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/inverse-inc/wireguard-go/ztn"
+	"google.golang.org/grpc/metadata"
+)
+
+// The file holding the token the clients must present to subscribe to the events, only the user running the tunnel can read it
+const tokenFile = "wgrpc_token"
+
+const tokenMetadataKey = "wgrpc-token"
+
+// writeToken generates the token of the RPC server of instance and stores it in its file
+func writeToken(instance ztn.Instance) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	// The file of a previous run is replaced rather than truncated so it can't keep broader permissions
+	path := instance.FilePath(tokenFile)
+	os.Remove(path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(token); err != nil {
+		f.Close()
+		return "", err
+	}
+	return token, f.Close()
+}
+
+// withToken returns a context that presents the token of the RPC server of instance
+func withToken(ctx context.Context, instance ztn.Instance) (context.Context, error) {
+	token, err := ioutil.ReadFile(instance.FilePath(tokenFile))
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, tokenMetadataKey, string(token)), nil
+}
+
+// checkToken returns an error unless the client presented the token of this server
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, t := range md.Get(tokenMetadataKey) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return errors.New("The client didn't present the token of the RPC server")
+}
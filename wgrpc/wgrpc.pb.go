@@ -68,9 +68,11 @@ type StatusReply struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Status               string `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
-	LastError            string `protobuf:"bytes,2,opt,name=lastError,proto3" json:"lastError,omitempty"`
-	CurrentBindTechnique string `protobuf:"bytes,3,opt,name=currentBindTechnique,proto3" json:"currentBindTechnique,omitempty"`
+	Status               string                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	LastError            string                `protobuf:"bytes,2,opt,name=lastError,proto3" json:"lastError,omitempty"`
+	CurrentBindTechnique string                `protobuf:"bytes,3,opt,name=currentBindTechnique,proto3" json:"currentBindTechnique,omitempty"`
+	Network              string                `protobuf:"bytes,4,opt,name=network,proto3" json:"network,omitempty"`
+	BindTechniqueScores  []*BindTechniqueScore `protobuf:"bytes,5,rep,name=bindTechniqueScores,proto3" json:"bindTechniqueScores,omitempty"`
 }
 
 func (x *StatusReply) Reset() {
@@ -126,6 +128,107 @@ func (x *StatusReply) GetCurrentBindTechnique() string {
 	return ""
 }
 
+func (x *StatusReply) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *StatusReply) GetBindTechniqueScores() []*BindTechniqueScore {
+	if x != nil {
+		return x.BindTechniqueScores
+	}
+	return nil
+}
+
+type BindTechniqueScore struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BindTechnique          string  `protobuf:"bytes,1,opt,name=bindTechnique,proto3" json:"bindTechnique,omitempty"`
+	Attempts               int64   `protobuf:"varint,2,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Successes              int64   `protobuf:"varint,3,opt,name=successes,proto3" json:"successes,omitempty"`
+	SuccessRate            float64 `protobuf:"fixed64,4,opt,name=successRate,proto3" json:"successRate,omitempty"`
+	AverageTimeToConnectMs int64   `protobuf:"varint,5,opt,name=averageTimeToConnectMs,proto3" json:"averageTimeToConnectMs,omitempty"`
+	Score                  float64 `protobuf:"fixed64,6,opt,name=score,proto3" json:"score,omitempty"`
+}
+
+func (x *BindTechniqueScore) Reset() {
+	*x = BindTechniqueScore{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BindTechniqueScore) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BindTechniqueScore) ProtoMessage() {}
+
+func (x *BindTechniqueScore) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BindTechniqueScore.ProtoReflect.Descriptor instead.
+func (*BindTechniqueScore) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BindTechniqueScore) GetBindTechnique() string {
+	if x != nil {
+		return x.BindTechnique
+	}
+	return ""
+}
+
+func (x *BindTechniqueScore) GetAttempts() int64 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *BindTechniqueScore) GetSuccesses() int64 {
+	if x != nil {
+		return x.Successes
+	}
+	return 0
+}
+
+func (x *BindTechniqueScore) GetSuccessRate() float64 {
+	if x != nil {
+		return x.SuccessRate
+	}
+	return 0
+}
+
+func (x *BindTechniqueScore) GetAverageTimeToConnectMs() int64 {
+	if x != nil {
+		return x.AverageTimeToConnectMs
+	}
+	return 0
+}
+
+func (x *BindTechniqueScore) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
 type PeerReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -139,7 +242,7 @@ type PeerReply struct {
 func (x *PeerReply) Reset() {
 	*x = PeerReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[2]
+		mi := &file_wgrpc_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -152,7 +255,7 @@ func (x *PeerReply) String() string {
 func (*PeerReply) ProtoMessage() {}
 
 func (x *PeerReply) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[2]
+	mi := &file_wgrpc_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -165,7 +268,7 @@ func (x *PeerReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PeerReply.ProtoReflect.Descriptor instead.
 func (*PeerReply) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{2}
+	return file_wgrpc_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PeerReply) GetIpAddress() string {
@@ -198,7 +301,7 @@ type PeersRequest struct {
 func (x *PeersRequest) Reset() {
 	*x = PeersRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[3]
+		mi := &file_wgrpc_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -211,7 +314,7 @@ func (x *PeersRequest) String() string {
 func (*PeersRequest) ProtoMessage() {}
 
 func (x *PeersRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[3]
+	mi := &file_wgrpc_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -224,7 +327,7 @@ func (x *PeersRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PeersRequest.ProtoReflect.Descriptor instead.
 func (*PeersRequest) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{3}
+	return file_wgrpc_proto_rawDescGZIP(), []int{4}
 }
 
 type PeersReply struct {
@@ -238,7 +341,7 @@ type PeersReply struct {
 func (x *PeersReply) Reset() {
 	*x = PeersReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[4]
+		mi := &file_wgrpc_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -251,7 +354,7 @@ func (x *PeersReply) String() string {
 func (*PeersReply) ProtoMessage() {}
 
 func (x *PeersReply) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[4]
+	mi := &file_wgrpc_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -264,7 +367,7 @@ func (x *PeersReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PeersReply.ProtoReflect.Descriptor instead.
 func (*PeersReply) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{4}
+	return file_wgrpc_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *PeersReply) GetPeers() []*PeerReply {
@@ -285,7 +388,7 @@ type StopRequest struct {
 func (x *StopRequest) Reset() {
 	*x = StopRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[5]
+		mi := &file_wgrpc_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -298,7 +401,7 @@ func (x *StopRequest) String() string {
 func (*StopRequest) ProtoMessage() {}
 
 func (x *StopRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[5]
+	mi := &file_wgrpc_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -311,7 +414,7 @@ func (x *StopRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StopRequest.ProtoReflect.Descriptor instead.
 func (*StopRequest) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{5}
+	return file_wgrpc_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *StopRequest) GetKillMasterProcess() bool {
@@ -330,7 +433,7 @@ type StopReply struct {
 func (x *StopReply) Reset() {
 	*x = StopReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[6]
+		mi := &file_wgrpc_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -343,7 +446,7 @@ func (x *StopReply) String() string {
 func (*StopReply) ProtoMessage() {}
 
 func (x *StopReply) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[6]
+	mi := &file_wgrpc_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -356,7 +459,7 @@ func (x *StopReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StopReply.ProtoReflect.Descriptor instead.
 func (*StopReply) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{6}
+	return file_wgrpc_proto_rawDescGZIP(), []int{7}
 }
 
 type PrintDebugRequest struct {
@@ -368,7 +471,7 @@ type PrintDebugRequest struct {
 func (x *PrintDebugRequest) Reset() {
 	*x = PrintDebugRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[7]
+		mi := &file_wgrpc_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -381,7 +484,7 @@ func (x *PrintDebugRequest) String() string {
 func (*PrintDebugRequest) ProtoMessage() {}
 
 func (x *PrintDebugRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[7]
+	mi := &file_wgrpc_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -394,7 +497,7 @@ func (x *PrintDebugRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PrintDebugRequest.ProtoReflect.Descriptor instead.
 func (*PrintDebugRequest) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{7}
+	return file_wgrpc_proto_rawDescGZIP(), []int{8}
 }
 
 type PrintDebugReply struct {
@@ -406,7 +509,7 @@ type PrintDebugReply struct {
 func (x *PrintDebugReply) Reset() {
 	*x = PrintDebugReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_wgrpc_proto_msgTypes[8]
+		mi := &file_wgrpc_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -419,7 +522,7 @@ func (x *PrintDebugReply) String() string {
 func (*PrintDebugReply) ProtoMessage() {}
 
 func (x *PrintDebugReply) ProtoReflect() protoreflect.Message {
-	mi := &file_wgrpc_proto_msgTypes[8]
+	mi := &file_wgrpc_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -432,139 +535,786 @@ func (x *PrintDebugReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PrintDebugReply.ProtoReflect.Descriptor instead.
 func (*PrintDebugReply) Descriptor() ([]byte, []int) {
-	return file_wgrpc_proto_rawDescGZIP(), []int{8}
+	return file_wgrpc_proto_rawDescGZIP(), []int{9}
 }
 
-var File_wgrpc_proto protoreflect.FileDescriptor
+type SubscribeEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_wgrpc_proto_rawDesc = []byte{
-	0x0a, 0x0b, 0x77, 0x67, 0x72, 0x70, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x0f, 0x0a,
-	0x0d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x77,
-	0x0a, 0x0b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x16, 0x0a,
-	0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
-	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x45, 0x72, 0x72,
-	0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x45, 0x72,
-	0x72, 0x6f, 0x72, 0x12, 0x32, 0x0a, 0x14, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42, 0x69,
-	0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x14, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42, 0x69, 0x6e, 0x64, 0x54, 0x65,
-	0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x22, 0x5d, 0x0a, 0x09, 0x50, 0x65, 0x65, 0x72, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x12, 0x1c, 0x0a, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73,
-	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65,
-	0x73, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x68, 0x6f,
-	0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x68, 0x6f,
-	0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x0e, 0x0a, 0x0c, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x2e, 0x0a, 0x0a, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52,
-	0x65, 0x70, 0x6c, 0x79, 0x12, 0x20, 0x0a, 0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20,
-	0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x50, 0x65, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x52,
-	0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x22, 0x3b, 0x0a, 0x0b, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2c, 0x0a, 0x11, 0x6b, 0x69, 0x6c, 0x6c, 0x4d, 0x61, 0x73,
-	0x74, 0x65, 0x72, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x11, 0x6b, 0x69, 0x6c, 0x6c, 0x4d, 0x61, 0x73, 0x74, 0x65, 0x72, 0x50, 0x72, 0x6f, 0x63,
-	0x65, 0x73, 0x73, 0x22, 0x0b, 0x0a, 0x09, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79,
-	0x22, 0x13, 0x0a, 0x11, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x11, 0x0a, 0x0f, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65,
-	0x62, 0x75, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x32, 0xbc, 0x01, 0x0a, 0x09, 0x57, 0x47, 0x53,
-	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x2b, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x12, 0x0e, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x0c, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c,
-	0x79, 0x22, 0x00, 0x12, 0x28, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x50, 0x65, 0x65, 0x72, 0x73, 0x12,
-	0x0d, 0x2e, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0b,
-	0x2e, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x22, 0x0a,
-	0x04, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x0c, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x0a, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
-	0x00, 0x12, 0x34, 0x0a, 0x0a, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x12,
-	0x12, 0x2e, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67,
-	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x07, 0x5a, 0x05, 0x77, 0x67, 0x72, 0x70, 0x63,
-	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	StreamID string `protobuf:"bytes,1,opt,name=streamID,proto3" json:"streamID,omitempty"`
+	Since    uint64 `protobuf:"varint,2,opt,name=since,proto3" json:"since,omitempty"`
 }
 
-var (
-	file_wgrpc_proto_rawDescOnce sync.Once
-	file_wgrpc_proto_rawDescData = file_wgrpc_proto_rawDesc
-)
+func (x *SubscribeEventsRequest) Reset() {
+	*x = SubscribeEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
 
-func file_wgrpc_proto_rawDescGZIP() []byte {
-	file_wgrpc_proto_rawDescOnce.Do(func() {
-		file_wgrpc_proto_rawDescData = protoimpl.X.CompressGZIP(file_wgrpc_proto_rawDescData)
-	})
-	return file_wgrpc_proto_rawDescData
+func (x *SubscribeEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_wgrpc_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
-var file_wgrpc_proto_goTypes = []interface{}{
-	(*StatusRequest)(nil),     // 0: StatusRequest
-	(*StatusReply)(nil),       // 1: StatusReply
-	(*PeerReply)(nil),         // 2: PeerReply
-	(*PeersRequest)(nil),      // 3: PeersRequest
-	(*PeersReply)(nil),        // 4: PeersReply
-	(*StopRequest)(nil),       // 5: StopRequest
-	(*StopReply)(nil),         // 6: StopReply
-	(*PrintDebugRequest)(nil), // 7: PrintDebugRequest
-	(*PrintDebugReply)(nil),   // 8: PrintDebugReply
+func (*SubscribeEventsRequest) ProtoMessage() {}
+
+func (x *SubscribeEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_wgrpc_proto_depIdxs = []int32{
-	2, // 0: PeersReply.peers:type_name -> PeerReply
-	0, // 1: WGService.GetStatus:input_type -> StatusRequest
-	3, // 2: WGService.GetPeers:input_type -> PeersRequest
-	5, // 3: WGService.Stop:input_type -> StopRequest
-	7, // 4: WGService.PrintDebug:input_type -> PrintDebugRequest
-	1, // 5: WGService.GetStatus:output_type -> StatusReply
-	4, // 6: WGService.GetPeers:output_type -> PeersReply
-	6, // 7: WGService.Stop:output_type -> StopReply
-	8, // 8: WGService.PrintDebug:output_type -> PrintDebugReply
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+
+// Deprecated: Use SubscribeEventsRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeEventsRequest) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{10}
 }
 
-func init() { file_wgrpc_proto_init() }
-func file_wgrpc_proto_init() {
-	if File_wgrpc_proto != nil {
-		return
+func (x *SubscribeEventsRequest) GetStreamID() string {
+	if x != nil {
+		return x.StreamID
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_wgrpc_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatusRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
+	return ""
+}
+
+func (x *SubscribeEventsRequest) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+type EventReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	StreamID  string `protobuf:"bytes,1,opt,name=streamID,proto3" json:"streamID,omitempty"`
+	Cursor    uint64 `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Resync    bool   `protobuf:"varint,3,opt,name=resync,proto3" json:"resync,omitempty"`
+	Type      string `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	Data      []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Timestamp int64  `protobuf:"varint,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *EventReply) Reset() {
+	*x = EventReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EventReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventReply) ProtoMessage() {}
+
+func (x *EventReply) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
 		}
-		file_wgrpc_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatusReply); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventReply.ProtoReflect.Descriptor instead.
+func (*EventReply) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *EventReply) GetStreamID() string {
+	if x != nil {
+		return x.StreamID
+	}
+	return ""
+}
+
+func (x *EventReply) GetCursor() uint64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *EventReply) GetResync() bool {
+	if x != nil {
+		return x.Resync
+	}
+	return false
+}
+
+func (x *EventReply) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *EventReply) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *EventReply) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+type RotateKeyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *RotateKeyRequest) Reset() {
+	*x = RotateKeyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RotateKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RotateKeyRequest) ProtoMessage() {}
+
+func (x *RotateKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
 		}
-		file_wgrpc_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PeerReply); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RotateKeyRequest.ProtoReflect.Descriptor instead.
+func (*RotateKeyRequest) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{12}
+}
+
+type RotateKeyReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PublicKey string `protobuf:"bytes,1,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
+}
+
+func (x *RotateKeyReply) Reset() {
+	*x = RotateKeyReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RotateKeyReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RotateKeyReply) ProtoMessage() {}
+
+func (x *RotateKeyReply) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RotateKeyReply.ProtoReflect.Descriptor instead.
+func (*RotateKeyReply) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RotateKeyReply) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+type DNSZonesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DNSZonesRequest) Reset() {
+	*x = DNSZonesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DNSZonesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSZonesRequest) ProtoMessage() {}
+
+func (x *DNSZonesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSZonesRequest.ProtoReflect.Descriptor instead.
+func (*DNSZonesRequest) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{14}
+}
+
+type DNSZonesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Domains        []string `protobuf:"bytes,1,rep,name=domains,proto3" json:"domains,omitempty"`
+	Names          []string `protobuf:"bytes,2,rep,name=names,proto3" json:"names,omitempty"`
+	InternalDomain string   `protobuf:"bytes,3,opt,name=internalDomain,proto3" json:"internalDomain,omitempty"`
+}
+
+func (x *DNSZonesReply) Reset() {
+	*x = DNSZonesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DNSZonesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSZonesReply) ProtoMessage() {}
+
+func (x *DNSZonesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSZonesReply.ProtoReflect.Descriptor instead.
+func (*DNSZonesReply) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *DNSZonesReply) GetDomains() []string {
+	if x != nil {
+		return x.Domains
+	}
+	return nil
+}
+
+func (x *DNSZonesReply) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *DNSZonesReply) GetInternalDomain() string {
+	if x != nil {
+		return x.InternalDomain
+	}
+	return ""
+}
+
+type BridgesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *BridgesRequest) Reset() {
+	*x = BridgesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BridgesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BridgesRequest) ProtoMessage() {}
+
+func (x *BridgesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BridgesRequest.ProtoReflect.Descriptor instead.
+func (*BridgesRequest) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{16}
+}
+
+type BridgeReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PeerID         string `protobuf:"bytes,1,opt,name=peerID,proto3" json:"peerID,omitempty"`
+	Hostname       string `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	IpAddress      string `protobuf:"bytes,3,opt,name=ipAddress,proto3" json:"ipAddress,omitempty"`
+	ConnectionType string `protobuf:"bytes,4,opt,name=connectionType,proto3" json:"connectionType,omitempty"`
+	Since          int64  `protobuf:"varint,5,opt,name=since,proto3" json:"since,omitempty"`
+	RxBytes        uint64 `protobuf:"varint,6,opt,name=rxBytes,proto3" json:"rxBytes,omitempty"`
+	RxPackets      uint64 `protobuf:"varint,7,opt,name=rxPackets,proto3" json:"rxPackets,omitempty"`
+	TxBytes        uint64 `protobuf:"varint,8,opt,name=txBytes,proto3" json:"txBytes,omitempty"`
+	TxPackets      uint64 `protobuf:"varint,9,opt,name=txPackets,proto3" json:"txPackets,omitempty"`
+	DroppedBytes   uint64 `protobuf:"varint,10,opt,name=droppedBytes,proto3" json:"droppedBytes,omitempty"`
+	DroppedPackets uint64 `protobuf:"varint,11,opt,name=droppedPackets,proto3" json:"droppedPackets,omitempty"`
+}
+
+func (x *BridgeReply) Reset() {
+	*x = BridgeReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BridgeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BridgeReply) ProtoMessage() {}
+
+func (x *BridgeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BridgeReply.ProtoReflect.Descriptor instead.
+func (*BridgeReply) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BridgeReply) GetPeerID() string {
+	if x != nil {
+		return x.PeerID
+	}
+	return ""
+}
+
+func (x *BridgeReply) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *BridgeReply) GetIpAddress() string {
+	if x != nil {
+		return x.IpAddress
+	}
+	return ""
+}
+
+func (x *BridgeReply) GetConnectionType() string {
+	if x != nil {
+		return x.ConnectionType
+	}
+	return ""
+}
+
+func (x *BridgeReply) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetRxBytes() uint64 {
+	if x != nil {
+		return x.RxBytes
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetRxPackets() uint64 {
+	if x != nil {
+		return x.RxPackets
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetTxBytes() uint64 {
+	if x != nil {
+		return x.TxBytes
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetTxPackets() uint64 {
+	if x != nil {
+		return x.TxPackets
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetDroppedBytes() uint64 {
+	if x != nil {
+		return x.DroppedBytes
+	}
+	return 0
+}
+
+func (x *BridgeReply) GetDroppedPackets() uint64 {
+	if x != nil {
+		return x.DroppedPackets
+	}
+	return 0
+}
+
+type BridgesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Bridges []*BridgeReply `protobuf:"bytes,1,rep,name=bridges,proto3" json:"bridges,omitempty"`
+}
+
+func (x *BridgesReply) Reset() {
+	*x = BridgesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_wgrpc_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BridgesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BridgesReply) ProtoMessage() {}
+
+func (x *BridgesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_wgrpc_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BridgesReply.ProtoReflect.Descriptor instead.
+func (*BridgesReply) Descriptor() ([]byte, []int) {
+	return file_wgrpc_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *BridgesReply) GetBridges() []*BridgeReply {
+	if x != nil {
+		return x.Bridges
+	}
+	return nil
+}
+
+var File_wgrpc_proto protoreflect.FileDescriptor
+
+var file_wgrpc_proto_rawDesc = []byte{
+	0x0a, 0x0b, 0x77, 0x67, 0x72, 0x70, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x0f, 0x0a,
+	0x0d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xd8,
+	0x01, 0x0a, 0x0b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x16,
+	0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x45, 0x72,
+	0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6c, 0x61, 0x73, 0x74, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x12, 0x32, 0x0a, 0x14, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42,
+	0x69, 0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x14, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x42, 0x69, 0x6e, 0x64, 0x54,
+	0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6e, 0x65, 0x74, 0x77,
+	0x6f, 0x72, 0x6b, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6e, 0x65, 0x74, 0x77, 0x6f,
+	0x72, 0x6b, 0x12, 0x45, 0x0a, 0x13, 0x62, 0x69, 0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69,
+	0x71, 0x75, 0x65, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x42, 0x69, 0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x53,
+	0x63, 0x6f, 0x72, 0x65, 0x52, 0x13, 0x62, 0x69, 0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69,
+	0x71, 0x75, 0x65, 0x53, 0x63, 0x6f, 0x72, 0x65, 0x73, 0x22, 0xe4, 0x01, 0x0a, 0x12, 0x42, 0x69,
+	0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x53, 0x63, 0x6f, 0x72, 0x65,
+	0x12, 0x24, 0x0a, 0x0d, 0x62, 0x69, 0x6e, 0x64, 0x54, 0x65, 0x63, 0x68, 0x6e, 0x69, 0x71, 0x75,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x62, 0x69, 0x6e, 0x64, 0x54, 0x65, 0x63,
+	0x68, 0x6e, 0x69, 0x71, 0x75, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70,
+	0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x61, 0x74, 0x74, 0x65, 0x6d, 0x70,
+	0x74, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x65, 0x73, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x65, 0x73,
+	0x12, 0x20, 0x0a, 0x0b, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x52, 0x61, 0x74, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x52, 0x61,
+	0x74, 0x65, 0x12, 0x36, 0x0a, 0x16, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x54, 0x69, 0x6d,
+	0x65, 0x54, 0x6f, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d, 0x73, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x16, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x54,
+	0x6f, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63,
+	0x6f, 0x72, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65,
+	0x22, 0x5d, 0x0a, 0x09, 0x50, 0x65, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x1c, 0x0a,
+	0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x73,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x68, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x68, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x22,
+	0x0e, 0x0a, 0x0c, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
+	0x2e, 0x0a, 0x0a, 0x50, 0x65, 0x65, 0x72, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x20, 0x0a,
+	0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x50,
+	0x65, 0x65, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x52, 0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x22,
+	0x3b, 0x0a, 0x0b, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2c,
+	0x0a, 0x11, 0x6b, 0x69, 0x6c, 0x6c, 0x4d, 0x61, 0x73, 0x74, 0x65, 0x72, 0x50, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11, 0x6b, 0x69, 0x6c, 0x6c, 0x4d,
+	0x61, 0x73, 0x74, 0x65, 0x72, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x22, 0x0b, 0x0a, 0x09,
+	0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x13, 0x0a, 0x11, 0x50, 0x72, 0x69,
+	0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x11,
+	0x0a, 0x0f, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x4a, 0x0a, 0x16, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x45, 0x76,
+	0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x73,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73,
+	0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65, 0x22, 0x9e, 0x01,
+	0x0a, 0x0a, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x1a, 0x0a, 0x08,
+	0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x75, 0x72, 0x73,
+	0x6f, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x63, 0x75, 0x72, 0x73, 0x6f, 0x72,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x79, 0x6e, 0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x72, 0x65, 0x73, 0x79, 0x6e, 0x63, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x04,
+	0x64, 0x61, 0x74, 0x61, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0x12,
+	0x0a, 0x10, 0x52, 0x6f, 0x74, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x22, 0x2e, 0x0a, 0x0e, 0x52, 0x6f, 0x74, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x52,
+	0x65, 0x70, 0x6c, 0x79, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b, 0x65,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x4b,
+	0x65, 0x79, 0x22, 0x11, 0x0a, 0x0f, 0x44, 0x4e, 0x53, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x67, 0x0a, 0x0d, 0x44, 0x4e, 0x53, 0x5a, 0x6f, 0x6e, 0x65,
+	0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x6f, 0x6d, 0x61, 0x69, 0x6e,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x64, 0x6f, 0x6d, 0x61, 0x69, 0x6e, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x05, 0x6e, 0x61, 0x6d, 0x65, 0x73, 0x12, 0x26, 0x0a, 0x0e, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x44, 0x6f, 0x6d, 0x61, 0x69, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x44, 0x6f, 0x6d, 0x61, 0x69, 0x6e, 0x22, 0x10,
+	0x0a, 0x0e, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0xd9, 0x02, 0x0a, 0x0b, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x12, 0x16, 0x0a, 0x06, 0x70, 0x65, 0x65, 0x72, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x70, 0x65, 0x65, 0x72, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x68, 0x6f, 0x73, 0x74,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x68, 0x6f, 0x73, 0x74,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x70, 0x41, 0x64, 0x64, 0x72, 0x65,
+	0x73, 0x73, 0x12, 0x26, 0x0a, 0x0e, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x63, 0x6f, 0x6e, 0x6e,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x69,
+	0x6e, 0x63, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x73, 0x69, 0x6e, 0x63, 0x65,
+	0x12, 0x18, 0x0a, 0x07, 0x72, 0x78, 0x42, 0x79, 0x74, 0x65, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x07, 0x72, 0x78, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x72, 0x78,
+	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x72,
+	0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x78, 0x42, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x74, 0x78, 0x42, 0x79, 0x74,
+	0x65, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18,
+	0x09, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x74, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x12, 0x22, 0x0a, 0x0c, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x42, 0x79, 0x74, 0x65, 0x73,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x42,
+	0x79, 0x74, 0x65, 0x73, 0x12, 0x26, 0x0a, 0x0e, 0x64, 0x72, 0x6f, 0x70, 0x70, 0x65, 0x64, 0x50,
+	0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x64, 0x72,
+	0x6f, 0x70, 0x70, 0x65, 0x64, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22, 0x36, 0x0a, 0x0c,
+	0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x26, 0x0a, 0x07,
+	0x62, 0x72, 0x69, 0x64, 0x67, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e,
+	0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x52, 0x07, 0x62, 0x72, 0x69,
+	0x64, 0x67, 0x65, 0x73, 0x32, 0x90, 0x03, 0x0a, 0x09, 0x57, 0x47, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x12, 0x2b, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12,
+	0x0e, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x0c, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12,
+	0x28, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x50, 0x65, 0x65, 0x72, 0x73, 0x12, 0x0d, 0x2e, 0x50, 0x65,
+	0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0b, 0x2e, 0x50, 0x65, 0x65,
+	0x72, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x22, 0x0a, 0x04, 0x53, 0x74, 0x6f,
+	0x70, 0x12, 0x0c, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x0a, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x34, 0x0a,
+	0x0a, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x12, 0x12, 0x2e, 0x50, 0x72,
+	0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x10, 0x2e, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x44, 0x65, 0x62, 0x75, 0x67, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x00, 0x12, 0x3b, 0x0a, 0x0f, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65,
+	0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x17, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69,
+	0x62, 0x65, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x0b, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x30, 0x01,
+	0x12, 0x31, 0x0a, 0x09, 0x52, 0x6f, 0x74, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x11, 0x2e,
+	0x52, 0x6f, 0x74, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x0f, 0x2e, 0x52, 0x6f, 0x74, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x00, 0x12, 0x31, 0x0a, 0x0b, 0x47, 0x65, 0x74, 0x44, 0x4e, 0x53, 0x5a, 0x6f, 0x6e,
+	0x65, 0x73, 0x12, 0x10, 0x2e, 0x44, 0x4e, 0x53, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x0e, 0x2e, 0x44, 0x4e, 0x53, 0x5a, 0x6f, 0x6e, 0x65, 0x73, 0x52,
+	0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x2f, 0x0a, 0x0b, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x72,
+	0x69, 0x64, 0x67, 0x65, 0x73, 0x12, 0x0f, 0x2e, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x42, 0x72, 0x69, 0x64, 0x67, 0x65, 0x73,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x07, 0x5a, 0x05, 0x77, 0x67, 0x72, 0x70, 0x63,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_wgrpc_proto_rawDescOnce sync.Once
+	file_wgrpc_proto_rawDescData = file_wgrpc_proto_rawDesc
+)
+
+func file_wgrpc_proto_rawDescGZIP() []byte {
+	file_wgrpc_proto_rawDescOnce.Do(func() {
+		file_wgrpc_proto_rawDescData = protoimpl.X.CompressGZIP(file_wgrpc_proto_rawDescData)
+	})
+	return file_wgrpc_proto_rawDescData
+}
+
+var file_wgrpc_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_wgrpc_proto_goTypes = []interface{}{
+	(*StatusRequest)(nil),          // 0: StatusRequest
+	(*StatusReply)(nil),            // 1: StatusReply
+	(*BindTechniqueScore)(nil),     // 2: BindTechniqueScore
+	(*PeerReply)(nil),              // 3: PeerReply
+	(*PeersRequest)(nil),           // 4: PeersRequest
+	(*PeersReply)(nil),             // 5: PeersReply
+	(*StopRequest)(nil),            // 6: StopRequest
+	(*StopReply)(nil),              // 7: StopReply
+	(*PrintDebugRequest)(nil),      // 8: PrintDebugRequest
+	(*PrintDebugReply)(nil),        // 9: PrintDebugReply
+	(*SubscribeEventsRequest)(nil), // 10: SubscribeEventsRequest
+	(*EventReply)(nil),             // 11: EventReply
+	(*RotateKeyRequest)(nil),       // 12: RotateKeyRequest
+	(*RotateKeyReply)(nil),         // 13: RotateKeyReply
+	(*DNSZonesRequest)(nil),        // 14: DNSZonesRequest
+	(*DNSZonesReply)(nil),          // 15: DNSZonesReply
+	(*BridgesRequest)(nil),         // 16: BridgesRequest
+	(*BridgeReply)(nil),            // 17: BridgeReply
+	(*BridgesReply)(nil),           // 18: BridgesReply
+}
+var file_wgrpc_proto_depIdxs = []int32{
+	2,  // 0: StatusReply.bindTechniqueScores:type_name -> BindTechniqueScore
+	3,  // 1: PeersReply.peers:type_name -> PeerReply
+	17, // 2: BridgesReply.bridges:type_name -> BridgeReply
+	0,  // 3: WGService.GetStatus:input_type -> StatusRequest
+	4,  // 4: WGService.GetPeers:input_type -> PeersRequest
+	6,  // 5: WGService.Stop:input_type -> StopRequest
+	8,  // 6: WGService.PrintDebug:input_type -> PrintDebugRequest
+	10, // 7: WGService.SubscribeEvents:input_type -> SubscribeEventsRequest
+	12, // 8: WGService.RotateKey:input_type -> RotateKeyRequest
+	14, // 9: WGService.GetDNSZones:input_type -> DNSZonesRequest
+	16, // 10: WGService.ListBridges:input_type -> BridgesRequest
+	1,  // 11: WGService.GetStatus:output_type -> StatusReply
+	5,  // 12: WGService.GetPeers:output_type -> PeersReply
+	7,  // 13: WGService.Stop:output_type -> StopReply
+	9,  // 14: WGService.PrintDebug:output_type -> PrintDebugReply
+	11, // 15: WGService.SubscribeEvents:output_type -> EventReply
+	13, // 16: WGService.RotateKey:output_type -> RotateKeyReply
+	15, // 17: WGService.GetDNSZones:output_type -> DNSZonesReply
+	18, // 18: WGService.ListBridges:output_type -> BridgesReply
+	11, // [11:19] is the sub-list for method output_type
+	3,  // [3:11] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_wgrpc_proto_init() }
+func file_wgrpc_proto_init() {
+	if File_wgrpc_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_wgrpc_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BindTechniqueScore); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
 				return &v.unknownFields
 			default:
 				return nil
 			}
 		}
 		file_wgrpc_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PeersRequest); i {
+			switch v := v.(*PeerReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -576,7 +1326,7 @@ func file_wgrpc_proto_init() {
 			}
 		}
 		file_wgrpc_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PeersReply); i {
+			switch v := v.(*PeersRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -588,7 +1338,7 @@ func file_wgrpc_proto_init() {
 			}
 		}
 		file_wgrpc_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StopRequest); i {
+			switch v := v.(*PeersReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -600,7 +1350,7 @@ func file_wgrpc_proto_init() {
 			}
 		}
 		file_wgrpc_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StopReply); i {
+			switch v := v.(*StopRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -612,7 +1362,7 @@ func file_wgrpc_proto_init() {
 			}
 		}
 		file_wgrpc_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PrintDebugRequest); i {
+			switch v := v.(*StopReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -624,6 +1374,18 @@ func file_wgrpc_proto_init() {
 			}
 		}
 		file_wgrpc_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PrintDebugRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*PrintDebugReply); i {
 			case 0:
 				return &v.state
@@ -635,6 +1397,114 @@ func file_wgrpc_proto_init() {
 				return nil
 			}
 		}
+		file_wgrpc_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubscribeEventsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EventReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RotateKeyRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RotateKeyReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DNSZonesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DNSZonesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BridgesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BridgeReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_wgrpc_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BridgesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -642,7 +1512,7 @@ func file_wgrpc_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_wgrpc_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   9,
+			NumMessages:   19,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -21,6 +21,10 @@ type WGServiceClient interface {
 	GetPeers(ctx context.Context, in *PeersRequest, opts ...grpc.CallOption) (*PeersReply, error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopReply, error)
 	PrintDebug(ctx context.Context, in *PrintDebugRequest, opts ...grpc.CallOption) (*PrintDebugReply, error)
+	SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (WGService_SubscribeEventsClient, error)
+	RotateKey(ctx context.Context, in *RotateKeyRequest, opts ...grpc.CallOption) (*RotateKeyReply, error)
+	GetDNSZones(ctx context.Context, in *DNSZonesRequest, opts ...grpc.CallOption) (*DNSZonesReply, error)
+	ListBridges(ctx context.Context, in *BridgesRequest, opts ...grpc.CallOption) (*BridgesReply, error)
 }
 
 type wGServiceClient struct {
@@ -67,6 +71,65 @@ func (c *wGServiceClient) PrintDebug(ctx context.Context, in *PrintDebugRequest,
 	return out, nil
 }
 
+func (c *wGServiceClient) SubscribeEvents(ctx context.Context, in *SubscribeEventsRequest, opts ...grpc.CallOption) (WGService_SubscribeEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_WGService_serviceDesc.Streams[0], "/WGService/SubscribeEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wGServiceSubscribeEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type WGService_SubscribeEventsClient interface {
+	Recv() (*EventReply, error)
+	grpc.ClientStream
+}
+
+type wGServiceSubscribeEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *wGServiceSubscribeEventsClient) Recv() (*EventReply, error) {
+	m := new(EventReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wGServiceClient) RotateKey(ctx context.Context, in *RotateKeyRequest, opts ...grpc.CallOption) (*RotateKeyReply, error) {
+	out := new(RotateKeyReply)
+	err := c.cc.Invoke(ctx, "/WGService/RotateKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wGServiceClient) GetDNSZones(ctx context.Context, in *DNSZonesRequest, opts ...grpc.CallOption) (*DNSZonesReply, error) {
+	out := new(DNSZonesReply)
+	err := c.cc.Invoke(ctx, "/WGService/GetDNSZones", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wGServiceClient) ListBridges(ctx context.Context, in *BridgesRequest, opts ...grpc.CallOption) (*BridgesReply, error) {
+	out := new(BridgesReply)
+	err := c.cc.Invoke(ctx, "/WGService/ListBridges", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WGServiceServer is the server API for WGService service.
 // All implementations must embed UnimplementedWGServiceServer
 // for forward compatibility
@@ -75,6 +138,10 @@ type WGServiceServer interface {
 	GetPeers(context.Context, *PeersRequest) (*PeersReply, error)
 	Stop(context.Context, *StopRequest) (*StopReply, error)
 	PrintDebug(context.Context, *PrintDebugRequest) (*PrintDebugReply, error)
+	SubscribeEvents(*SubscribeEventsRequest, WGService_SubscribeEventsServer) error
+	RotateKey(context.Context, *RotateKeyRequest) (*RotateKeyReply, error)
+	GetDNSZones(context.Context, *DNSZonesRequest) (*DNSZonesReply, error)
+	ListBridges(context.Context, *BridgesRequest) (*BridgesReply, error)
 	mustEmbedUnimplementedWGServiceServer()
 }
 
@@ -94,6 +161,18 @@ func (UnimplementedWGServiceServer) Stop(context.Context, *StopRequest) (*StopRe
 func (UnimplementedWGServiceServer) PrintDebug(context.Context, *PrintDebugRequest) (*PrintDebugReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PrintDebug not implemented")
 }
+func (UnimplementedWGServiceServer) SubscribeEvents(*SubscribeEventsRequest, WGService_SubscribeEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeEvents not implemented")
+}
+func (UnimplementedWGServiceServer) RotateKey(context.Context, *RotateKeyRequest) (*RotateKeyReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateKey not implemented")
+}
+func (UnimplementedWGServiceServer) GetDNSZones(context.Context, *DNSZonesRequest) (*DNSZonesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDNSZones not implemented")
+}
+func (UnimplementedWGServiceServer) ListBridges(context.Context, *BridgesRequest) (*BridgesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBridges not implemented")
+}
 func (UnimplementedWGServiceServer) mustEmbedUnimplementedWGServiceServer() {}
 
 // UnsafeWGServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -179,6 +258,81 @@ func _WGService_PrintDebug_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WGService_SubscribeEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WGServiceServer).SubscribeEvents(m, &wGServiceSubscribeEventsServer{stream})
+}
+
+type WGService_SubscribeEventsServer interface {
+	Send(*EventReply) error
+	grpc.ServerStream
+}
+
+type wGServiceSubscribeEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *wGServiceSubscribeEventsServer) Send(m *EventReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _WGService_RotateKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WGServiceServer).RotateKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/WGService/RotateKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WGServiceServer).RotateKey(ctx, req.(*RotateKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WGService_GetDNSZones_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DNSZonesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WGServiceServer).GetDNSZones(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/WGService/GetDNSZones",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WGServiceServer).GetDNSZones(ctx, req.(*DNSZonesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WGService_ListBridges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BridgesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WGServiceServer).ListBridges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/WGService/ListBridges",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WGServiceServer).ListBridges(ctx, req.(*BridgesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _WGService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "WGService",
 	HandlerType: (*WGServiceServer)(nil),
@@ -199,7 +353,25 @@ var _WGService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "PrintDebug",
 			Handler:    _WGService_PrintDebug_Handler,
 		},
+		{
+			MethodName: "RotateKey",
+			Handler:    _WGService_RotateKey_Handler,
+		},
+		{
+			MethodName: "GetDNSZones",
+			Handler:    _WGService_GetDNSZones_Handler,
+		},
+		{
+			MethodName: "ListBridges",
+			Handler:    _WGService_ListBridges_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeEvents",
+			Handler:       _WGService_SubscribeEvents_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "wgrpc.proto",
 }
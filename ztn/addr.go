@@ -0,0 +1,53 @@
+package ztn
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+const (
+	addrFamilyIPv4 = byte(4)
+	addrFamilyIPv6 = byte(6)
+)
+
+// The version of the encoding of the addresses, it must be incremented whenever their layout changes
+const addrEncodingVersion = byte(1)
+
+// The encoded address has a fixed length whatever its family so that it can be stripped from a packet without parsing it
+const encodedAddrLength = 2 + net.IPv6len + binary.MaxVarintLen64
+
+// encodeAddr writes the version, the family, the IP address and the port into buf which must hold at least encodedAddrLength bytes
+func encodeAddr(buf []byte, ip net.IP, port int) {
+	family := addrFamilyIPv6
+	if ip.To4() != nil {
+		family = addrFamilyIPv4
+	}
+	buf[0] = addrEncodingVersion
+	buf[1] = family
+	copy(buf[2:2+net.IPv6len], ip.To16())
+	binary.PutUvarint(buf[2+net.IPv6len:encodedAddrLength], uint64(port))
+}
+
+// decodeAddr reads an address written by encodeAddr
+// It returns nil when the address was encoded by an incompatible version
+func decodeAddr(buf []byte) *net.UDPAddr {
+	if buf[0] != addrEncodingVersion || (buf[1] != addrFamilyIPv4 && buf[1] != addrFamilyIPv6) {
+		return nil
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, buf[2:2+net.IPv6len])
+	if buf[1] == addrFamilyIPv4 {
+		ip = ip.To4()
+	}
+	port, _ := binary.Uvarint(buf[2+net.IPv6len : encodedAddrLength])
+	return &net.UDPAddr{IP: ip, Port: int(port)}
+}
+
+// isGlobalIPv6 returns whether ip is an IPv6 address that can be reached from the Internet
+func isGlobalIPv6(ip net.IP) bool {
+	if ip == nil || ip.To4() != nil || !ip.IsGlobalUnicast() {
+		return false
+	}
+	// Unique local addresses (fc00::/7) are private
+	return ip[0]&0xfe != 0xfc
+}
@@ -0,0 +1,87 @@
+package ztn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestEncodeAddr(t *testing.T) {
+	for _, addr := range []*net.UDPAddr{
+		{IP: net.ParseIP("192.0.2.10"), Port: 12673},
+		{IP: net.ParseIP("2001:db8::1"), Port: 65535},
+	} {
+		buf := make([]byte, encodedAddrLength)
+		encodeAddr(buf, addr.IP, addr.Port)
+		decoded := decodeAddr(buf)
+		if decoded.String() != addr.String() {
+			t.Error("Unexpected decoded address", decoded, "instead of", addr)
+		}
+
+		buf[0] = addrEncodingVersion + 1
+		if decoded := decodeAddr(buf); decoded != nil {
+			t.Error("An address encoded by another version was decoded", decoded)
+		}
+	}
+}
+
+func TestBindRequestPkt(t *testing.T) {
+	btb := &BindTechniqueBase{}
+	btb.InitID()
+
+	for _, ip := range []string{"198.51.100.1", "2001:db8:1::2"} {
+		buf := btb.BindRequestPkt(net.ParseIP(ip), 4242)
+		if !btb.IsMessage(buf) {
+			t.Error("The bind request packet isn't recognized")
+		}
+		parsedIP, port, err := btb.ParseBindRequestPkt(buf)
+		if err != nil || !parsedIP.Equal(net.ParseIP(ip)) || port != 4242 {
+			t.Error("Unexpected bind request", parsedIP, port, err)
+		}
+	}
+
+	if _, _, err := btb.ParseBindRequestPkt(btb.id); err == nil {
+		t.Error("A truncated bind request was accepted")
+	}
+}
+
+func TestMarker(t *testing.T) {
+	nc := &NetworkConnection{wgConnRemote: true}
+	raddr := &net.UDPAddr{IP: net.ParseIP("2001:db8::42"), Port: 51820}
+	data := []byte("wireguard packet")
+
+	msg := nc.addMarkerFromAddr(raddr, data)
+	if info := nc.infoFromMarker(msg); info.String() != raddr.String() {
+		t.Error("Unexpected address in the marker", info)
+	}
+	if marker, stripped := nc.stripMarker(msg); len(marker) != markerLength || string(stripped) != string(data) {
+		t.Error("The marker wasn't stripped from the packet", stripped)
+	}
+}
+
+func TestIPv6ConnectionType(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	nc := &NetworkConnection{BindTechnique: BindSTUN}
+	pc := &PeerConnection{networkConnection: nc, logger: logger}
+	nee := &NetworkEndpointEvent{BindTechnique: BindSTUN, PublicEndpointV6: "[2001:db8::2]:12673"}
+
+	if ct := pc.FindConnectionType(nee); ct == ConnectionTypeWANIPv6 {
+		t.Error("IPv6 was used while this device has no IPv6 address")
+	}
+
+	nc.publicAddrV6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12673}
+	if ct := pc.FindConnectionType(nee); ct != ConnectionTypeWANIPv6 {
+		t.Error("IPv6 wasn't preferred when both sides have it", ct)
+	}
+	pc.try = 2
+	if ct := pc.FindConnectionType(nee); ct == ConnectionTypeWANIPv6 {
+		t.Error("IPv6 was used on a try meant for the other techniques")
+	}
+
+	for ip, global := range map[string]bool{"2001:db8::1": true, "fd00::1": false, "fe80::1": false, "192.0.2.1": false} {
+		if isGlobalIPv6(net.ParseIP(ip)) != global {
+			t.Error("Unexpected result for", ip)
+		}
+	}
+}
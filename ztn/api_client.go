@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/inverse-inc/packetfence/go/log"
 	"github.com/inverse-inc/packetfence/go/sharedutils"
@@ -18,19 +19,69 @@ import (
 var APIClient *unifiedapiclient.Client
 var APIClientCtx context.Context
 
+// The configuration the API client was setup with, including the answers given on the CLI
+var APIClientConfig *Config
+
+// ErrUnsupportedEndpoint is returned when the version of the server doesn't implement an endpoint of the API
+var ErrUnsupportedEndpoint = errors.New("The server doesn't implement this endpoint, it must be upgraded")
+
+// The paths the server last answered with a 404, the API client doesn't give the status of the replies
+var missingEndpoints sync.Map
+
+// endpointStatusTransport records the paths the server doesn't implement
+type endpointStatusTransport struct {
+	http.RoundTripper
+}
+
+func (t endpointStatusTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		missingEndpoints.Store(r.URL.Path, true)
+	} else {
+		missingEndpoints.Delete(r.URL.Path)
+	}
+	return resp, nil
+}
+
+// newAPIHTTPClient returns the HTTP client of the API client, it records the endpoints the server doesn't implement
+func newAPIHTTPClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: endpointStatusTransport{transport},
+	}
+}
+
+// callOptionalEndpoint POSTs payload to an endpoint that the older versions of the server don't implement
+// ErrUnsupportedEndpoint is returned when the server answered with a 404
+// The enroll and rotate_key endpoints of the remote_clients API aren't implemented by all the versions of PacketFence
+func callOptionalEndpoint(path string, payload interface{}) error {
+	err := GetAPIClient().CallWithBody(APIClientCtx, "POST", path, payload, &unifiedapiclient.DummyReply{})
+	if err == nil {
+		return nil
+	}
+	if _, missing := missingEndpoints.Load(path); missing {
+		return ErrUnsupportedEndpoint
+	}
+	return err
+}
+
 // TODO: replace with prompts or configuration
 func SetupAPIClientCLI() {
-	server := sharedutils.EnvOrDefault(EnvServer, "")
+	config := GetConfig()
+
+	server := config.Server
 	if server == "" {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Server: ")
 		server, _ = reader.ReadString('\n')
 		server = strings.Trim(server, "\r\n")
 	} else {
-		fmt.Println("Using environment provided server:", server)
+		fmt.Println("Using configured server:", server)
 	}
 
-	port := sharedutils.EnvOrDefault(EnvServerPort, "")
+	port := config.ServerPort
 	if port == "" {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Server port (default 9999): ")
@@ -41,62 +92,68 @@ func SetupAPIClientCLI() {
 			port = "9999"
 		}
 	} else {
-		fmt.Println("Using environment provided server port:", port)
+		fmt.Println("Using configured server port:", port)
 	}
 
-	verifySslStr := sharedutils.EnvOrDefault(EnvServerVerifyTLS, "")
-	if verifySslStr == "" {
+	verifySsl := config.ServerVerifyTLS
+	if !config.IsSet("server_verify_tls") {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Verify TLS identity of server? (Y/n): ")
-		verifySslStr, _ = reader.ReadString('\n')
-		verifySslStr = strings.Trim(port, "\r\n")
+		verifySslStr, _ := reader.ReadString('\n')
+		verifySslStr = strings.Trim(verifySslStr, "\r\n")
 
-		if verifySslStr == "" {
-			verifySslStr = "y"
+		if verifySslStr != "" {
+			verifySsl, _ = parseConfigBool(verifySslStr)
 		}
 	} else {
-		fmt.Println("Using environment provided server verify TLS:", verifySslStr)
+		fmt.Println("Using configured server verify TLS:", verifySsl)
 	}
 
-	username := sharedutils.EnvOrDefault(EnvUsername, "")
+	username := config.Username
 	if username == "" {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Username: ")
 		username, _ = reader.ReadString('\n')
 		username = strings.Trim(username, "\r\n")
 	} else {
-		fmt.Println("Using environment provided username:", username)
+		fmt.Println("Using configured username:", username)
 	}
 
 	fmt.Print("Enter Password for " + username + ": ")
 	password := ReadPassword()
 
-	setupAPIClientFromData(username, password, server, port, verifySslStr)
-}
-
-func mustGetenv(k string) string {
-	if v := os.Getenv(k); v == "" {
-		panic("Key " + k + " is empty in the enviorment")
-	} else {
-		return v
+	if enrollmentPending && config.EnrollmentToken == "" {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Print("This device isn't enrolled yet. Enrollment token (leave empty to use your credentials): ")
+		cliEnrollmentToken, _ = reader.ReadString('\n')
+		cliEnrollmentToken = strings.Trim(cliEnrollmentToken, "\r\n")
 	}
+
+	// The answers only apply to this session, the rest of the trust settings come from the configuration
+	sessionConfig := *config
+	sessionConfig.ServerVerifyTLS = verifySsl
+	tlsConfig, err := sessionConfig.ServerTLSConfig()
+	sharedutils.CheckError(err)
+
+	APIClientConfig = &sessionConfig
+	setupAPIClientFromData(username, password, server, port, tlsConfig)
 }
 
 func SetupAPIClientEnv() {
-	pass, err := base64.StdEncoding.DecodeString(mustGetenv(EnvPassword))
+	config := GetConfig()
+	err := config.Require("server", "server_port", "username", "password")
 	sharedutils.CheckError(err)
-	setupAPIClientFromData(mustGetenv(EnvUsername), string(pass), mustGetenv(EnvServer), mustGetenv(EnvServerPort), mustGetenv(EnvServerVerifyTLS))
+	tlsConfig, err := config.ServerTLSConfig()
+	sharedutils.CheckError(err)
+	APIClientConfig = config
+	setupAPIClientFromData(config.Username, config.Password, config.Server, config.ServerPort, tlsConfig)
 }
 
-func setupAPIClientFromData(username, password, serverName, serverPort, verifySslStr string) {
-	verifySsl := (verifySslStr == "y" || verifySslStr == "yes")
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !verifySsl},
-		},
-	}
-
-	unifiedapiclient.SetHTTPClient(httpClient)
+// setupAPIClientFromData creates the API client, the long-poll clients of the events share its HTTP client and therefore its TLS configuration
+func setupAPIClientFromData(username, password, serverName, serverPort string, tlsConfig *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	unifiedapiclient.SetHTTPClient(newAPIHTTPClient(transport))
 	APIClientCtx = log.LoggerNewContext(context.Background())
 	APIClient = unifiedapiclient.New(APIClientCtx, username, password, "https", serverName, serverPort)
 	APIClient.URILogDebug = true
@@ -104,7 +161,7 @@ func setupAPIClientFromData(username, password, serverName, serverPort, verifySs
 
 func GetAPIClient() *unifiedapiclient.Client {
 	if APIClient == nil {
-		if RunningInCLI() && (sharedutils.EnvOrDefault(EnvCLIInterractive, "true") == "true") {
+		if RunningInCLI() && GetConfig().CLIInteractive {
 			SetupAPIClientCLI()
 		} else {
 			SetupAPIClientEnv()
@@ -0,0 +1,146 @@
+package ztn
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/inverse-inc/packetfence/go/unifiedapiclient"
+	"github.com/inverse-inc/wireguard-go/device"
+	"github.com/inverse-inc/wireguard-go/ztn/ztntest"
+)
+
+// setupFakeServer points the API client to a fake server, the returned function restores it
+func setupFakeServer() (*ztntest.Server, func()) {
+	srv := ztntest.NewServer()
+	unifiedapiclient.SetHTTPClient(newAPIHTTPClient(srv.Client().Transport))
+	APIClientCtx = context.Background()
+	APIClient = unifiedapiclient.New(APIClientCtx, srv.Username, srv.Password, "https", srv.Host(), srv.Port())
+	return srv, func() {
+		APIClient = nil
+		srv.Close()
+	}
+}
+
+func newTestProfile(srv *ztntest.Server, ip string, hostname string) (Profile, string) {
+	priv, pub := ztntest.GenerateKeys()
+	profile := Profile{PrivateKey: base64.StdEncoding.EncodeToString(priv[:])}
+	profile.PublicKey = base64.StdEncoding.EncodeToString(pub[:])
+	srv.SetProfile(remoteclients.Peer{
+		PublicKey:        profile.PublicKey,
+		WireguardIP:      net.ParseIP(ip),
+		WireguardNetmask: 24,
+		Hostname:         hostname,
+	})
+	return profile, base64.URLEncoding.EncodeToString(pub[:])
+}
+
+func TestRemoteClientsAPI(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	profile, _ := newTestProfile(srv, "100.64.0.1", "agent1")
+	_, peerID := newTestProfile(srv, "100.64.0.2", "agent2")
+
+	if _, err := DoServerChallenge(&profile); err != nil {
+		t.Fatal("Unable to solve the server challenge", err)
+	}
+
+	if err := profile.FillProfileFromServer(nil, logger); err != nil {
+		t.Fatal("Unable to fill the profile from the server", err)
+	}
+	if !profile.WireguardIP.Equal(net.ParseIP("100.64.0.1")) {
+		t.Error("Unexpected IP in the profile", profile.WireguardIP)
+	}
+	if requests := srv.ProfileRequests(); len(requests) != 1 || requests[0].PublicKey != profile.PublicKey || requests[0].MAC == "" {
+		t.Error("Unexpected profile requests", requests)
+	}
+
+	peerProfile, err := GetPeerProfile(peerID)
+	if err != nil {
+		t.Fatal("Unable to get the peer profile", err)
+	}
+	if peerProfile.Hostname != "agent2" {
+		t.Error("Unexpected peer hostname", peerProfile.Hostname)
+	}
+	if _, err := remoteclients.B64KeyToBytes(peerProfile.PublicKey); err != nil {
+		t.Error("Public key of the peer isn't converted to standard base64", peerProfile.PublicKey)
+	}
+
+	if err := GLPPublish("test-category", Event{Type: EventTypeNetworkEndpoint}); err != nil {
+		t.Fatal("Unable to publish an event", err)
+	}
+	if events := srv.Events("test-category"); len(events) != 1 || events[0].Type != EventTypeNetworkEndpoint {
+		t.Error("Published event wasn't received", events)
+	}
+
+	// The challenge can't be solved without the private key matching the public key
+	impostor := profile
+	priv, _ := ztntest.GenerateKeys()
+	impostor.PrivateKey = base64.StdEncoding.EncodeToString(priv[:])
+	if err := impostor.FillProfileFromServer(nil, logger); err == nil {
+		t.Error("Impostor was able to fetch the profile")
+	}
+
+	srv.RemoveProfile(profile.PublicKey)
+	if err := profile.FillProfileFromServer(nil, logger); err == nil {
+		t.Error("Removed client was able to fetch its profile")
+	}
+}
+
+func TestFillProfileFromServerOrCache(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	dir, err := ioutil.TempDir("", "profile-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profile, _ := newTestProfile(srv, "100.64.0.1", "agent1")
+	cache := NewProfileCache(filepath.Join(dir, "profile.cache"), profile.PrivateKey)
+	if fromCache, err := profile.FillProfileFromServerOrCache(nil, logger, cache); err != nil || fromCache {
+		t.Fatal("Unable to fill the profile from the server", err)
+	}
+
+	// A revoked device must not start from its cache
+	srv.RemoveProfile(profile.PublicKey)
+	revoked := Profile{PrivateKey: profile.PrivateKey}
+	revoked.PublicKey = profile.PublicKey
+	if fromCache, err := revoked.FillProfileFromServerOrCache(nil, logger, cache); err == nil || fromCache {
+		t.Fatal("The cache was used while the server rejected the device")
+	}
+
+	srv.Close()
+	offline := Profile{PrivateKey: profile.PrivateKey}
+	offline.PublicKey = profile.PublicKey
+	if fromCache, err := offline.FillProfileFromServerOrCache(nil, logger, cache); err != nil || !fromCache {
+		t.Fatal("The cache wasn't used while the server is unreachable", err)
+	}
+	if !offline.WireguardIP.Equal(net.ParseIP("100.64.0.1")) {
+		t.Error("Unexpected IP in the cached profile", offline.WireguardIP)
+	}
+}
+
+func TestCallOptionalEndpoint(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+
+	path := "/api/v1/remote_clients/enroll"
+	if err := callOptionalEndpoint(path, enrollRequest{}); err == nil || err == ErrUnsupportedEndpoint {
+		t.Error("Unexpected error for an invalid request to an implemented endpoint", err)
+	}
+
+	srv.RemoveEndpoint(path)
+	if err := callOptionalEndpoint(path, enrollRequest{}); err != ErrUnsupportedEndpoint {
+		t.Error("The endpoint the server doesn't implement wasn't detected", err)
+	}
+}
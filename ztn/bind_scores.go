@@ -0,0 +1,126 @@
+package ztn
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/jackpal/gateway"
+)
+
+// A technique that takes this long to connect gets half the score of one that connects right away
+var bindScoreTimeToConnectHalving = 30 * time.Second
+
+// BindTechniqueScore is what was observed when using a bind technique on a network
+type BindTechniqueScore struct {
+	Attempts           int           `json:"attempts"`
+	Successes          int           `json:"successes"`
+	TotalTimeToConnect time.Duration `json:"total_time_to_connect"`
+}
+
+// SuccessRate returns the ratio of the attempts that connected, smoothed so that a technique that was never tried has a rate of 0.5
+func (s BindTechniqueScore) SuccessRate() float64 {
+	return float64(s.Successes+1) / float64(s.Attempts+2)
+}
+
+// AverageTimeToConnect returns the average time the successful attempts took to receive the first packet of a peer
+func (s BindTechniqueScore) AverageTimeToConnect() time.Duration {
+	if s.Successes == 0 {
+		return 0
+	}
+	return s.TotalTimeToConnect / time.Duration(s.Successes)
+}
+
+// Score orders the bind techniques, the techniques that connect more often and faster have a higher score
+func (s BindTechniqueScore) Score() float64 {
+	return s.SuccessRate() / (1 + float64(s.AverageTimeToConnect())/float64(bindScoreTimeToConnectHalving))
+}
+
+// BindScores holds the scores of the bind techniques for each of the networks this device was connected to
+// It is stored on disk so the techniques that worked on a network are tried first when connecting to it again
+type BindScores struct {
+	sync.Mutex
+	Networks map[string]map[BindTechnique]*BindTechniqueScore `json:"networks"`
+
+	path string
+}
+
+func NewBindScores(path string) *BindScores {
+	return &BindScores{
+		path:     path,
+		Networks: map[string]map[BindTechnique]*BindTechniqueScore{},
+	}
+}
+
+// Load reads the scores from disk
+func (bs *BindScores) Load() error {
+	bs.Lock()
+	defer bs.Unlock()
+
+	data, err := ioutil.ReadFile(bs.path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, bs); err != nil {
+		return err
+	}
+	if bs.Networks == nil {
+		bs.Networks = map[string]map[BindTechnique]*BindTechniqueScore{}
+	}
+	return nil
+}
+
+func (bs *BindScores) save() error {
+	data, err := json.Marshal(bs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(bs.path, data)
+}
+
+// Record adds the result of an attempt to use a bind technique on a network and saves the scores
+func (bs *BindScores) Record(network string, bt BindTechnique, success bool, timeToConnect time.Duration) error {
+	bs.Lock()
+	defer bs.Unlock()
+
+	if bs.Networks[network] == nil {
+		bs.Networks[network] = map[BindTechnique]*BindTechniqueScore{}
+	}
+	score := bs.Networks[network][bt]
+	if score == nil {
+		score = &BindTechniqueScore{}
+		bs.Networks[network][bt] = score
+	}
+	score.Attempts++
+	if success {
+		score.Successes++
+		score.TotalTimeToConnect += timeToConnect
+	}
+	return bs.save()
+}
+
+// Scores returns a copy of the scores of a network
+func (bs *BindScores) Scores(network string) map[BindTechnique]BindTechniqueScore {
+	bs.Lock()
+	defer bs.Unlock()
+
+	scores := map[BindTechnique]BindTechniqueScore{}
+	for bt, score := range bs.Networks[network] {
+		scores[bt] = *score
+	}
+	return scores
+}
+
+// networkID identifies the network this device is connected to using the MAC address of its gateway or, when it can't be found, its public IP
+func networkID(publicIP string) string {
+	if gatewayIP, err := gateway.DiscoverGateway(); err == nil {
+		if mac, err := gatewayMAC(gatewayIP); err == nil {
+			return "gateway:" + mac.String()
+		}
+	}
+	if publicIP != "" {
+		return "public-ip:" + publicIP
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package ztn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBindScores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bind-scores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bind_scores.json")
+
+	scores := NewBindScores(path)
+	scores.Record("gateway:00:11:22:33:44:55", BindSTUN, false, 10*time.Second)
+	scores.Record("gateway:00:11:22:33:44:55", BindSTUN, false, 10*time.Second)
+	scores.Record("gateway:00:11:22:33:44:55", BindUPNPIGD, true, 2*time.Second)
+	scores.Record("gateway:00:11:22:33:44:55", BindNATPMP, true, 40*time.Second)
+	scores.Record("public-ip:203.0.113.7", BindThroughPeer, true, time.Second)
+
+	loaded := NewBindScores(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal("Unable to load the scores:", err)
+	}
+	network := loaded.Scores("gateway:00:11:22:33:44:55")
+	if s := network[BindSTUN]; s.Attempts != 2 || s.Successes != 0 {
+		t.Error("Unexpected score after loading", s)
+	}
+	if s := network[BindUPNPIGD]; s.AverageTimeToConnect() != 2*time.Second {
+		t.Error("Unexpected time to connect", s.AverageTimeToConnect())
+	}
+	if _, ok := network[BindThroughPeer]; ok {
+		t.Error("The scores of another network were mixed in")
+	}
+
+	if !(network[BindUPNPIGD].Score() > network[BindNATPMP].Score() && network[BindNATPMP].Score() > network[BindSTUN].Score()) {
+		t.Error("The scores don't favor the techniques that connect more often and faster", network)
+	}
+
+	bts := &BindTechniquesStruct{}
+	for _, bt := range []BindTechnique{BindSTUN, BindUPNPIGD, BindNATPMP, BindDirectPublic} {
+		bts.Add(bt)
+	}
+	bts.SetScores(network)
+	// The technique that was never tried on this network comes before the ones that failed or were slow
+	for _, expected := range []BindTechnique{BindUPNPIGD, BindDirectPublic, BindNATPMP, BindSTUN} {
+		if bt := bts.Next(); bt != expected {
+			t.Error("Got", bt, "instead of", expected)
+		}
+	}
+}
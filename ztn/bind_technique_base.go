@@ -2,7 +2,7 @@ package ztn
 
 import (
 	"crypto/rand"
-	"encoding/binary"
+	"errors"
 	"net"
 
 	"github.com/inverse-inc/packetfence/go/sharedutils"
@@ -48,19 +48,21 @@ func (btm *BindTechniqueBase) AddIDToPacket(buf []byte) {
 	}
 }
 
+// BindRequestPkt builds the packet announcing the external address obtained by the bind technique, it can be an IPv4 or an IPv6 address
 func (btm *BindTechniqueBase) BindRequestPkt(externalIP net.IP, externalPort int) []byte {
 	var buf = defaultBufferPool.Get()
 	btm.AddIDToPacket(buf)
-	buf[len(btm.id)+1] = externalIP[12]
-	buf[len(btm.id)+2] = externalIP[13]
-	buf[len(btm.id)+3] = externalIP[14]
-	buf[len(btm.id)+4] = externalIP[15]
-	binary.PutUvarint(buf[len(btm.id)+5:], uint64(externalPort))
-	return buf
+	encodeAddr(buf[len(btm.id):], externalIP, externalPort)
+	return buf[:len(btm.id)+encodedAddrLength]
 }
 
 func (btb *BindTechniqueBase) ParseBindRequestPkt(buf []byte) (net.IP, int, error) {
-	ip := net.IPv4(buf[len(btb.id)+1], buf[len(btb.id)+2], buf[len(btb.id)+3], buf[len(btb.id)+4])
-	port, _ := binary.Uvarint(buf[len(btb.id)+5:])
-	return ip, int(port), nil
+	if len(buf) < len(btb.id)+encodedAddrLength {
+		return nil, 0, errors.New("bind request packet is too short")
+	}
+	addr := decodeAddr(buf[len(btb.id):])
+	if addr == nil {
+		return nil, 0, errors.New("bind request packet was built by an incompatible version")
+	}
+	return addr.IP, addr.Port, nil
 }
@@ -20,31 +20,37 @@ func (bt BindTechnique) Weight() int {
 }
 
 var bindTechniquePriorities = map[BindTechnique]int{
-	BindDirectPublic: 11,
-	BindUPNPIGD:      21,
-	BindSTUN:         31,
-	BindNATPMP:       41,
-	BindThroughPeer:  51,
+	BindDirectPublic:   11,
+	BindUPNPIGD:        21,
+	BindPCP:            26,
+	BindSTUN:           31,
+	BindNATPMP:         41,
+	BindPortPrediction: 46,
+	BindThroughPeer:    51,
 }
 
 var BindTechniqueNames = map[string]BindTechnique{
-	"DIRECT_PUBLIC": BindDirectPublic,
-	"NATPMP":        BindNATPMP,
-	"STUN":          BindSTUN,
-	"THROUGH_PEER":  BindThroughPeer,
-	"UPNPIGD":       BindUPNPIGD,
+	"DIRECT_PUBLIC":   BindDirectPublic,
+	"NATPMP":          BindNATPMP,
+	"PCP":             BindPCP,
+	"PORT_PREDICTION": BindPortPrediction,
+	"STUN":            BindSTUN,
+	"THROUGH_PEER":    BindThroughPeer,
+	"UPNPIGD":         BindUPNPIGD,
 }
 
 const (
 	// These will get ordered in the BindTechniques.
 	// Lower string == tried first if available
 	// NAT PMP hasn't worked well in a few places so its left to be tried last
-	BindAutomatic    = BindTechnique("AUTOMATIC")
-	BindDirectPublic = BindTechnique("DIRECT_PUBLIC")
-	BindNATPMP       = BindTechnique("NATPMP")
-	BindSTUN         = BindTechnique("STUN")
-	BindThroughPeer  = BindTechnique("THROUGH_PEER")
-	BindUPNPIGD      = BindTechnique("UPNPIGD")
+	BindAutomatic      = BindTechnique("AUTOMATIC")
+	BindDirectPublic   = BindTechnique("DIRECT_PUBLIC")
+	BindNATPMP         = BindTechnique("NATPMP")
+	BindPCP            = BindTechnique("PCP")
+	BindPortPrediction = BindTechnique("PORT_PREDICTION")
+	BindSTUN           = BindTechnique("STUN")
+	BindThroughPeer    = BindTechnique("THROUGH_PEER")
+	BindUPNPIGD        = BindTechnique("UPNPIGD")
 )
 
 var DefaultBindTechnique = BindSTUN
@@ -54,6 +60,8 @@ type BindTechniquesStruct struct {
 	bindTechniques map[BindTechnique]bool
 	sorted         []BindTechnique
 	index          int
+	// The scores observed on the current network, the techniques are sorted by priority when there are none
+	scores map[BindTechnique]float64
 }
 
 func (bts *BindTechniquesStruct) CopyNew() *BindTechniquesStruct {
@@ -69,6 +77,12 @@ func (bts *BindTechniquesStruct) CopyNew() *BindTechniquesStruct {
 	for k, v := range bts.bindTechniques {
 		newBts.bindTechniques[k] = v
 	}
+	if bts.scores != nil {
+		newBts.scores = map[BindTechnique]float64{}
+		for k, v := range bts.scores {
+			newBts.scores[k] = v
+		}
+	}
 	return newBts
 }
 
@@ -88,6 +102,27 @@ func (bts *BindTechniquesStruct) Add(bt BindTechnique) {
 	sort.Sort(bts)
 }
 
+// SetScores orders the techniques by decreasing score and starts over from the best one
+// The techniques without a score get the score of a technique that was never tried
+func (bts *BindTechniquesStruct) SetScores(scores map[BindTechnique]BindTechniqueScore) {
+	bts.Lock()
+	defer bts.Unlock()
+
+	bts.scores = map[BindTechnique]float64{}
+	for bt, score := range scores {
+		bts.scores[bt] = score.Score()
+	}
+	sort.Sort(bts)
+	bts.index = 0
+}
+
+func (bts *BindTechniquesStruct) score(bt BindTechnique) float64 {
+	if score, ok := bts.scores[bt]; ok {
+		return score
+	}
+	return BindTechniqueScore{}.Score()
+}
+
 func (bts *BindTechniquesStruct) Next() BindTechnique {
 	bts.Lock()
 	defer bts.Unlock()
@@ -106,6 +141,11 @@ func (bts *BindTechniquesStruct) Len() int {
 }
 
 func (bts *BindTechniquesStruct) Less(i, j int) bool {
+	if bts.scores != nil {
+		if si, sj := bts.score(bts.sorted[i]), bts.score(bts.sorted[j]); si != sj {
+			return si > sj
+		}
+	}
 	return bts.sorted[i].Priority() < bts.sorted[j].Priority()
 }
 
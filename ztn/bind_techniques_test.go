@@ -9,9 +9,9 @@ func TestBindTechniques(t *testing.T) {
 	}
 
 	BindTechniques.Add(BindSTUN)
-	BindTechniques.Add(BindUPNPGID)
+	BindTechniques.Add(BindUPNPIGD)
 
-	if BindTechniques.Next() != BindUPNPGID {
+	if BindTechniques.Next() != BindUPNPIGD {
 		t.Error("Invalid bind technique")
 	}
 
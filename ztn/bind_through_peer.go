@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/inverse-inc/packetfence/go/sharedutils"
 	"github.com/inverse-inc/wireguard-go/util"
@@ -23,6 +24,8 @@ type BindThroughPeerAgent struct {
 	remoteID          uint64
 	remoteToken       uint64
 	remotePSC         string
+	// The address the relay forwards the packets of the peers from
+	relayAddr *net.UDPAddr
 }
 
 func NewBindThroughPeerAgent(connection *Connection, networkConnection *NetworkConnection) *BindThroughPeerAgent {
@@ -46,58 +49,90 @@ func (btp *BindThroughPeerAgent) findBridgeablePeers() []*PeerConnection {
 	return pcs
 }
 
-func (btp *BindThroughPeerAgent) BindRequest(conn *net.UDPConn, sendTo chan *pkt) error {
-	btp.Lock()
-	defer btp.Unlock()
+// setupForwarding asks a peer to bridge for this device and tells the bridge where to forward the packets
+func (btp *BindThroughPeerAgent) setupForwarding(pc *PeerConnection, serverAddr string, conn *net.UDPConn) (*SetupForwardingReply, error) {
+	hostname, err := os.Hostname()
+	sharedutils.CheckError(err)
 
-	if btp.remotePort != 0 {
-		return nil
+	btp.networkConnection.logger.Info.Println("Attempting to setup forwarding with peer", pc.PeerProfile.WireguardIP)
+
+	c, pscConn := ConnectPeerServiceClient(serverAddr)
+	defer pscConn.Close()
+	res, err := c.SetupForwarding(context.Background(), &SetupForwardingRequest{Name: hostname, PeerConnectionType: pc.ConnectionType, PublicKey: pc.MyProfile.PublicKey})
+	if err != nil {
+		return nil, err
 	}
 
-	hostname, err := os.Hostname()
+	addr, err := net.ResolveUDPAddr(udp, res.Raddr)
 	sharedutils.CheckError(err)
 
-	pcs := btp.findBridgeablePeers()
-	for _, pc := range pcs {
-		btp.networkConnection.logger.Info.Println("Attempting to setup forwarding with peer", pc.PeerProfile.WireguardIP)
+	data := make([]byte, 1024)
+	binary.PutUvarint(data, res.Id)
+	binary.PutUvarint(data[binary.MaxVarintLen64:], res.Token)
+	binary.PutUvarint(data[2*binary.MaxVarintLen64:], MsgNcBindPeerBridge)
 
-		serverAddr := fmt.Sprintf("%s:%d", pc.PeerProfile.WireguardIP.String(), PeerServiceServerPort)
-		c, pscConn := ConnectPeerServiceClient(serverAddr)
-		defer pscConn.Close()
-		res, err := c.SetupForwarding(context.Background(), &SetupForwardingRequest{Name: hostname, PeerConnectionType: pc.ConnectionType})
-		if err != nil {
-			btp.networkConnection.logger.Error.Println("Failed to setup forwarding with peer", pc.PeerProfile.WireguardIP, "due to the following error:", err)
-			continue
-		}
+	if err := util.UDPSend(data, conn, addr); err != nil {
+		return nil, fmt.Errorf("Failed to write to %s via connection %s: %s", addr, conn.LocalAddr(), err)
+	}
+	return res, nil
+}
 
-		addr, err := net.ResolveUDPAddr("udp4", res.Raddr)
-		sharedutils.CheckError(err)
+// useRelay records the bridge set up by a peer, the lock must be held
+func (btp *BindThroughPeerAgent) useRelay(serverAddr string, res *SetupForwardingReply) {
+	// The peer sends 4 bytes for an IPv4 address and 16 for an IPv6 one
+	btp.remoteIP = net.IP(res.PublicIP)
+	btp.remotePort = int(res.PublicPort)
 
-		data := make([]byte, 1024)
-		binary.PutUvarint(data, res.Id)
-		binary.PutUvarint(data[binary.MaxVarintLen64:], res.Token)
-		binary.PutUvarint(data[2*binary.MaxVarintLen64:], MsgNcBindPeerBridge)
+	btp.remotePSC = serverAddr
+	btp.remoteID = res.Id
+	btp.remoteToken = res.Token
+	btp.relayAddr, _ = net.ResolveUDPAddr(udp, res.Raddr)
+}
 
-		util.UDPSend(data, conn, addr)
-		if err != nil {
-			btp.networkConnection.logger.Error.Println("Failed to write to", addr, "via connection", conn, "due to the following error:", err)
-			continue
-		} else {
-			btp.remoteIP = net.IPv4(res.PublicIP[0], res.PublicIP[1], res.PublicIP[2], res.PublicIP[3])
-			btp.remotePort = int(res.PublicPort)
+// RelayAddr returns the address the relay forwards the packets of the peers from
+func (btp *BindThroughPeerAgent) RelayAddr() *net.UDPAddr {
+	btp.Lock()
+	defer btp.Unlock()
+	return btp.relayAddr
+}
 
-			btp.remotePSC = serverAddr
-			btp.remoteID = res.Id
-			btp.remoteToken = res.Token
+// release tears down the bridge of the relay so that the next BindRequest sets up a new one
+func (btp *BindThroughPeerAgent) release() {
+	btp.Lock()
+	serverAddr, id, token := btp.remotePSC, btp.remoteID, btp.remoteToken
+	bound := btp.remotePort != 0
+	btp.remoteIP = nil
+	btp.remotePort = 0
+	btp.relayAddr = nil
+	btp.Unlock()
+	if bound {
+		btp.stopForwarding(serverAddr, id, token)
+	}
+}
 
-			btp.networkConnection.logger.Info.Println("Succeeded setting up forwarding with peer", pc.PeerProfile.WireguardIP)
+// BindRequest bridges through the peer with the best round trip time and load, the peers that can't be probed are tried last
+func (btp *BindThroughPeerAgent) BindRequest(conn *net.UDPConn, sendTo chan *pkt) error {
+	btp.Lock()
+	defer btp.Unlock()
+
+	if btp.remotePort != 0 {
+		return nil
+	}
 
-			go func() {
-				sendTo <- &pkt{message: btp.BindRequestPkt(btp.remoteIP, btp.remotePort)}
-			}()
-			return nil
+	for _, probe := range rankRelays(btp.probeRelays(btp.findBridgeablePeers())) {
+		res, err := btp.setupForwarding(probe.pc, probe.serverAddr, conn)
+		if err != nil {
+			btp.networkConnection.logger.Error.Println("Failed to setup forwarding with peer", probe.pc.PeerProfile.WireguardIP, "due to the following error:", err)
+			continue
 		}
 
+		btp.useRelay(probe.serverAddr, res)
+		btp.networkConnection.logger.Info.Println("Succeeded setting up forwarding with peer", probe.pc.PeerProfile.WireguardIP)
+
+		go func() {
+			sendTo <- &pkt{message: btp.BindRequestPkt(btp.remoteIP, btp.remotePort)}
+		}()
+		return nil
 	}
 
 	go func() {
@@ -106,10 +141,73 @@ func (btp *BindThroughPeerAgent) BindRequest(conn *net.UDPConn, sendTo chan *pkt
 	return errors.New("Couldn't find a peer to bridge through")
 }
 
-func (btp *BindThroughPeerAgent) ParseBindRequestPkt(buf []byte) (net.IP, int, error) {
-	ip := net.IPv4(buf[len(btp.id)+1], buf[len(btp.id)+2], buf[len(btp.id)+3], buf[len(btp.id)+4])
-	port, _ := binary.Uvarint(buf[len(btp.id)+5:])
-	return ip, int(port), nil
+// How long the previous bridge is kept after a migration so that the peers have time to move to the new one
+var migratedRelayGracePeriod = 30 * time.Second
+
+// Migrate bridges through a better peer than the current one when there is one and returns whether it did
+// The bridge of the new peer is set up before the current one is torn down, which happens once the peers had time to move to the new one
+func (btp *BindThroughPeerAgent) Migrate(conn *net.UDPConn, sendTo chan *pkt) bool {
+	btp.Lock()
+	currentAddr := btp.remotePSC
+	currentID := btp.remoteID
+	currentToken := btp.remoteToken
+	bound := btp.remotePort != 0
+	btp.Unlock()
+	if !bound {
+		return false
+	}
+
+	probes := btp.probeRelays(btp.findBridgeablePeers())
+	current := relayProbe{serverAddr: currentAddr}
+	for _, p := range probes {
+		if p.serverAddr == currentAddr {
+			current = p
+		}
+	}
+
+	for _, candidate := range rankRelays(probes) {
+		if candidate.serverAddr == currentAddr || candidate.capacity == nil {
+			continue
+		}
+		if !betterRelay(candidate, current) {
+			return false
+		}
+
+		res, err := btp.setupForwarding(candidate.pc, candidate.serverAddr, conn)
+		if err != nil {
+			btp.networkConnection.logger.Error.Println("Failed to migrate to peer", candidate.pc.PeerProfile.WireguardIP, "due to the following error:", err)
+			return false
+		}
+
+		btp.Lock()
+		btp.useRelay(candidate.serverAddr, res)
+		btp.Unlock()
+		btp.networkConnection.logger.Info.Println("Migrated the forwarding from", currentAddr, "to peer", candidate.pc.PeerProfile.WireguardIP, "which answered in", candidate.rtt)
+
+		sendTo <- &pkt{message: btp.BindRequestPkt(net.IP(res.PublicIP), int(res.PublicPort))}
+
+		time.AfterFunc(migratedRelayGracePeriod, func() {
+			btp.stopForwarding(currentAddr, currentID, currentToken)
+		})
+		return true
+	}
+	return false
+}
+
+// stopForwarding asks the peer to tear down a bridge this device doesn't use anymore
+func (btp *BindThroughPeerAgent) stopForwarding(serverAddr string, id, token uint64) {
+	c, conn := ConnectPeerServiceClient(serverAddr)
+	defer conn.Close()
+	res, err := c.StopForwarding(context.Background(), &StopForwardingRequest{Id: id, Token: token})
+	if err != nil {
+		btp.networkConnection.logger.Error.Println("Unable to tear down the previous forwarding with", serverAddr, ". Error:", err)
+		return
+	}
+	if res.Result {
+		btp.networkConnection.logger.Info.Println("Tore down the previous forwarding with", serverAddr)
+	} else {
+		btp.networkConnection.logger.Debug.Println("The previous forwarding with", serverAddr, "was already torn down")
+	}
 }
 
 func (btp *BindThroughPeerAgent) StillAlive() bool {
@@ -0,0 +1,126 @@
+package ztn
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The smallest burst of a token bucket so that a full packet can always go through
+const minTokenBucketBurst = 64 * 1024
+
+// tokenBucket limits a rate of bytes, the packets that don't fit are dropped
+// The bucket holds at most a second worth of tokens
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket that allows kbps kilobits per second or nil when kbps is 0, which doesn't limit anything
+func newTokenBucket(kbps int) *tokenBucket {
+	if kbps <= 0 {
+		return nil
+	}
+	rate := float64(kbps) * 1000 / 8
+	burst := rate
+	if burst < minTokenBucketBurst {
+		burst = minTokenBucketBurst
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+// allow takes n bytes worth of tokens from the bucket and returns whether there were enough of them
+func (tb *tokenBucket) allow(n int, now time.Time) bool {
+	if tb == nil {
+		return true
+	}
+	tb.Lock()
+	defer tb.Unlock()
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+	if tb.tokens < float64(n) {
+		return false
+	}
+	tb.tokens -= float64(n)
+	return true
+}
+
+// bridgeCounters counts the traffic of a bridge, the fields are accessed atomically
+type bridgeCounters struct {
+	// Received from the peers of the bridged device and forwarded to it
+	rxBytes   uint64
+	rxPackets uint64
+	// Received from the bridged device and forwarded to its peers
+	txBytes   uint64
+	txPackets uint64
+	// Dropped because they exceeded the bandwidth limits
+	droppedBytes   uint64
+	droppedPackets uint64
+}
+
+// bridgeShaper enforces the bandwidth limits of a bridge and counts its traffic
+// The bucket of the bridge is its own while the total one is shared by all the bridges of this device
+type bridgeShaper struct {
+	// First in the struct so the counters are 64-bit aligned for the atomic operations
+	counters bridgeCounters
+	bucket   *tokenBucket
+	total    *tokenBucket
+}
+
+func newBridgeShaper(kbps int, total *tokenBucket) *bridgeShaper {
+	return &bridgeShaper{bucket: newTokenBucket(kbps), total: total}
+}
+
+// forward counts a packet of n bytes and returns whether it can be forwarded
+// toBridged tells whether the packet goes to the bridged device or comes from it
+func (bs *bridgeShaper) forward(n int, toBridged bool, now time.Time) bool {
+	if bs == nil {
+		return true
+	}
+	if !bs.bucket.allow(n, now) || !bs.total.allow(n, now) {
+		atomic.AddUint64(&bs.counters.droppedBytes, uint64(n))
+		atomic.AddUint64(&bs.counters.droppedPackets, 1)
+		return false
+	}
+	if toBridged {
+		atomic.AddUint64(&bs.counters.rxBytes, uint64(n))
+		atomic.AddUint64(&bs.counters.rxPackets, 1)
+	} else {
+		atomic.AddUint64(&bs.counters.txBytes, uint64(n))
+		atomic.AddUint64(&bs.counters.txPackets, 1)
+	}
+	return true
+}
+
+// BridgeStats is the traffic relayed by a bridge this device offers to one of its peers
+type BridgeStats struct {
+	PeerID         string    `json:"peer_id"`
+	Hostname       string    `json:"hostname"`
+	IP             string    `json:"ip"`
+	ConnectionType string    `json:"connection_type"`
+	Since          time.Time `json:"since"`
+	RxBytes        uint64    `json:"rx_bytes"`
+	RxPackets      uint64    `json:"rx_packets"`
+	TxBytes        uint64    `json:"tx_bytes"`
+	TxPackets      uint64    `json:"tx_packets"`
+	DroppedBytes   uint64    `json:"dropped_bytes"`
+	DroppedPackets uint64    `json:"dropped_packets"`
+}
+
+// fillStats copies the counters of the bridge in stats
+func (bs *bridgeShaper) fillStats(stats *BridgeStats) {
+	stats.RxBytes = atomic.LoadUint64(&bs.counters.rxBytes)
+	stats.RxPackets = atomic.LoadUint64(&bs.counters.rxPackets)
+	stats.TxBytes = atomic.LoadUint64(&bs.counters.txBytes)
+	stats.TxPackets = atomic.LoadUint64(&bs.counters.txPackets)
+	stats.DroppedBytes = atomic.LoadUint64(&bs.counters.droppedBytes)
+	stats.DroppedPackets = atomic.LoadUint64(&bs.counters.droppedPackets)
+}
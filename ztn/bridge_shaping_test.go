@@ -0,0 +1,78 @@
+package ztn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	if newTokenBucket(0) != nil {
+		t.Fatal("A bucket was created without a limit")
+	}
+	var unlimited *tokenBucket
+	if !unlimited.allow(1<<20, time.Now()) {
+		t.Fatal("The lack of a bucket limited the traffic")
+	}
+
+	// 8 Mbit/s is 1 MB/s
+	tb := newTokenBucket(8000)
+	now := time.Now()
+	if !tb.allow(1000000, now) {
+		t.Fatal("The burst of a second wasn't allowed")
+	}
+	if tb.allow(1500, now) {
+		t.Fatal("A packet was allowed while the bucket is empty")
+	}
+	now = now.Add(10 * time.Millisecond)
+	if !tb.allow(10000, now) {
+		t.Fatal("The tokens of 10ms weren't refilled")
+	}
+	if tb.allow(1500, now) {
+		t.Fatal("More than the rate was allowed")
+	}
+	// The tokens don't pile up past the burst
+	now = now.Add(time.Minute)
+	if tb.allow(1000001, now) {
+		t.Fatal("More than the burst was allowed")
+	}
+
+	// The burst of a slow bucket still lets a full packet through
+	if !newTokenBucket(8).allow(1500, time.Now()) {
+		t.Fatal("A packet larger than the rate was never allowed")
+	}
+}
+
+func TestBridgeShaper(t *testing.T) {
+	var unshaped *bridgeShaper
+	if !unshaped.forward(1500, true, time.Now()) {
+		t.Fatal("A connection that doesn't bridge dropped a packet")
+	}
+
+	total := newTokenBucket(8000)
+	first := newBridgeShaper(0, total)
+	second := newBridgeShaper(800, total)
+	now := time.Now()
+
+	if !first.forward(900000, true, now) || !first.forward(1000, false, now) {
+		t.Fatal("The first bridge was limited within the total bandwidth")
+	}
+	if !second.forward(90000, true, now) {
+		t.Fatal("The second bridge was limited within its bandwidth")
+	}
+	if second.forward(20000, false, now) {
+		t.Fatal("The second bridge exceeded its bandwidth")
+	}
+	if first.forward(200000, true, now) {
+		t.Fatal("The first bridge exceeded the total bandwidth")
+	}
+
+	stats := BridgeStats{}
+	first.fillStats(&stats)
+	if stats.RxBytes != 900000 || stats.RxPackets != 1 || stats.TxBytes != 1000 || stats.TxPackets != 1 || stats.DroppedBytes != 200000 || stats.DroppedPackets != 1 {
+		t.Fatalf("Wrong counters for the first bridge: %+v", stats)
+	}
+	second.fillStats(&stats)
+	if stats.RxBytes != 90000 || stats.TxPackets != 0 || stats.DroppedPackets != 1 {
+		t.Fatalf("Wrong counters for the second bridge: %+v", stats)
+	}
+}
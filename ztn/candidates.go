@@ -0,0 +1,462 @@
+package ztn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	securerandom "github.com/theckman/go-securerandom"
+)
+
+// CandidateType is where the address of a candidate comes from, as in ICE (RFC 8445)
+type CandidateType string
+
+const (
+	// An address of a local interface
+	CandidateHost = CandidateType("host")
+	// A port mapped or forwarded on the router using UPnP IGD, NAT-PMP or the public port of the configuration
+	CandidateMapped = CandidateType("mapped")
+	// The address seen by the STUN server
+	CandidateServerReflexive = CandidateType("srflx")
+	// An address on which a symmetric NAT is expected to allocate the next port
+	CandidatePredicted = CandidateType("predicted")
+	// The address of the peer that bridges the connection
+	CandidateRelay = CandidateType("relay")
+)
+
+var candidateTypePreferences = map[CandidateType]uint32{
+	CandidateHost:            126,
+	CandidateMapped:          110,
+	CandidateServerReflexive: 100,
+	CandidatePredicted:       90,
+	CandidateRelay:           0,
+}
+
+// Candidate is an endpoint on which the main network connection can be reached
+type Candidate struct {
+	Type     CandidateType `json:"type"`
+	Endpoint string        `json:"endpoint"`
+	Priority uint32        `json:"priority"`
+	// The interface of the underlay socket the candidate belongs to, empty for the main connection socket
+	Interface string `json:"interface,omitempty"`
+}
+
+// candidatePriority computes the priority of a candidate as in section 5.1.2.1 of RFC 8445, there is a single component
+func candidatePriority(t CandidateType, localPreference uint32) uint32 {
+	return candidateTypePreferences[t]<<24 | (localPreference&0xffff)<<8 | (256 - 1)
+}
+
+// candidatePairPriority computes the priority of a pair as in section 6.1.2.3 of RFC 8445
+func candidatePairPriority(controlling, controlled uint32) uint64 {
+	min, max := uint64(controlling), uint64(controlled)
+	if min > max {
+		min, max = max, min
+	}
+	priority := 1<<32*min + 2*max
+	if controlling > controlled {
+		priority++
+	}
+	return priority
+}
+
+// bindTechniqueCandidateType returns the type of the candidate obtained through a bind technique
+func bindTechniqueCandidateType(bt BindTechnique) CandidateType {
+	switch bt {
+	case BindSTUN:
+		return CandidateServerReflexive
+	case BindThroughPeer:
+		return CandidateRelay
+	case BindPortPrediction:
+		return CandidatePredicted
+	default:
+		return CandidateMapped
+	}
+}
+
+// hostCandidateIPs returns the addresses of the local interfaces that can be reached by the peers
+func hostCandidateIPs() []net.IP {
+	ips := []net.IP{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ips
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			// The link-local addresses would need the zone of the interface on the peer side
+			if !ok || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips
+}
+
+// Candidates returns the endpoints on which this connection can be reached, ordered by decreasing priority
+// The candidates come from the local interfaces, the STUN server, the public address of the bind technique in use, the addresses gathered with the other techniques and the underlay sockets
+// The predicted ports differ for each peer, see withPredictedCandidates
+func (nc *NetworkConnection) Candidates() []Candidate {
+	candidates := []Candidate{}
+	if nc.localConn == nil {
+		return candidates
+	}
+	port := nc.localConn.LocalAddr().(*net.UDPAddr).Port
+
+	addCandidate := func(candidate Candidate) {
+		for _, c := range candidates {
+			if c.Endpoint == candidate.Endpoint {
+				return
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	add := func(t CandidateType, addr *net.UDPAddr, localPreference uint32) {
+		addCandidate(Candidate{Type: t, Endpoint: addr.String(), Priority: candidatePriority(t, localPreference)})
+	}
+
+	for i, ip := range hostCandidateIPs() {
+		// IPv6 is preferred since it doesn't go through a NAT
+		preference := uint32(65535 - i)
+		if ip.To4() != nil {
+			preference -= 32768
+		} else if !GetConfig().UseIPv6 {
+			continue
+		}
+		add(CandidateHost, &net.UDPAddr{IP: ip, Port: port}, preference)
+	}
+
+	if publicAddr := nc.GetPublicAddr(); publicAddr != nil && publicAddr.Port != 0 {
+		add(bindTechniqueCandidateType(nc.BindTechnique), publicAddr, 65535)
+	}
+	if reflexiveAddr := nc.GetReflexiveAddr(); reflexiveAddr != nil {
+		add(CandidateServerReflexive, reflexiveAddr, 65535)
+	}
+	for bt, addr := range nc.gatheredCandidateAddrs() {
+		add(bindTechniqueCandidateType(bt), addr, uint32(65535-bt.Priority()))
+	}
+
+	for _, c := range nc.underlayCandidates() {
+		addCandidate(c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Priority > candidates[j].Priority
+	})
+	return candidates
+}
+
+// withPredictedCandidates adds the ports predicted for a peer to the candidates, ordered by decreasing priority
+// The peer sends its checks across all the predicted ports since the NAT may have allocated some of them to other connections
+func withPredictedCandidates(candidates []Candidate, publicAddr *net.UDPAddr, ports []int) []Candidate {
+	if publicAddr == nil || len(ports) == 0 {
+		return candidates
+	}
+	result := append([]Candidate{}, candidates...)
+	for i, port := range ports {
+		endpoint := (&net.UDPAddr{IP: publicAddr.IP, Port: port}).String()
+		found := false
+		for _, c := range result {
+			found = found || c.Endpoint == endpoint
+		}
+		if !found {
+			result = append(result, Candidate{Type: CandidatePredicted, Endpoint: endpoint, Priority: candidatePriority(CandidatePredicted, uint32(65535-i))})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Priority > result[j].Priority
+	})
+	return result
+}
+
+// How often the candidates of the bind techniques that aren't in use are gathered again when they couldn't be obtained
+var candidateGatheringInterval = 2 * time.Minute
+
+// portMapper is a bind technique that maps a port of the router to a local port
+type portMapper interface {
+	BindTechniqueInterface
+	BindRequest(conn *net.UDPConn, localPort int, sendTo chan *pkt) error
+}
+
+// gatherCandidates obtains the addresses of the bind techniques other than the one in use so that they are published as candidates too
+// The ports of the router are mapped to conn and a relay is set up once a connected peer offers bridging
+// The addresses are dropped when conn was replaced in the meantime
+func (nc *NetworkConnection) gatherCandidates(conn *net.UDPConn, localPort int, mappers map[BindTechnique]portMapper, relay *BindThroughPeerAgent) {
+	// Only the main network connection publishes candidates, the ones that bridge for the peers don't
+	if nc.Connection == nil {
+		return
+	}
+
+	for bt, mapper := range mappers {
+		if bt == nc.BindTechnique || nc.gatheredCandidateAddr(bt) != nil {
+			continue
+		}
+		sendTo := make(chan *pkt, 1)
+		if err := mapper.BindRequest(conn, localPort, sendTo); err != nil {
+			nc.logger.Debug.Println("Unable to gather the", bt, "candidate:", err)
+			continue
+		}
+		if addr := readBindRequestAddr(mapper, sendTo); addr != nil {
+			nc.logger.Info.Println("Gathered the", bt, "candidate", addr)
+			nc.setGatheredCandidate(conn, bt, addr, nil)
+		}
+	}
+
+	if nc.BindTechnique == BindThroughPeer {
+		return
+	}
+	if nc.gatheredCandidateAddr(BindThroughPeer) != nil {
+		if relay.StillAlive() {
+			return
+		}
+		nc.logger.Info.Println("The relay of the relay candidate stopped forwarding, setting up another one")
+		nc.setGatheredCandidate(conn, BindThroughPeer, nil, nil)
+		relay.release()
+	}
+	sendTo := make(chan *pkt, 1)
+	if err := relay.BindRequest(conn, sendTo); err != nil {
+		nc.logger.Debug.Println("Unable to gather the relay candidate:", err)
+		return
+	}
+	if addr := readBindRequestAddr(relay, sendTo); addr != nil {
+		nc.logger.Info.Println("Gathered the relay candidate", addr)
+		nc.setGatheredCandidate(conn, BindThroughPeer, addr, relay.RelayAddr())
+	}
+}
+
+// readBindRequestAddr returns the address announced by a bind technique on sendTo, nil when it didn't obtain one
+func readBindRequestAddr(method BindTechniqueInterface, sendTo chan *pkt) *net.UDPAddr {
+	select {
+	case p := <-sendTo:
+		defer defaultBufferPool.Put(p.message)
+		ip, port, err := method.ParseBindRequestPkt(p.message)
+		if err != nil || port == 0 {
+			return nil
+		}
+		return &net.UDPAddr{IP: ip, Port: port}
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+// setGatheredCandidate records the address of a bind technique that isn't in use, relayAddr is the address the relay forwards from for the relay candidate
+func (nc *NetworkConnection) setGatheredCandidate(conn *net.UDPConn, bt BindTechnique, addr *net.UDPAddr, relayAddr *net.UDPAddr) {
+	nc.gatheredLock.Lock()
+	defer nc.gatheredLock.Unlock()
+	if conn != nc.localConn {
+		return
+	}
+	if addr == nil {
+		delete(nc.gatheredAddrs, bt)
+	} else {
+		nc.gatheredAddrs[bt] = addr
+	}
+	if bt == BindThroughPeer {
+		nc.gatheredRelayAddr = relayAddr
+	}
+}
+
+func (nc *NetworkConnection) gatheredCandidateAddr(bt BindTechnique) *net.UDPAddr {
+	nc.gatheredLock.Lock()
+	defer nc.gatheredLock.Unlock()
+	return nc.gatheredAddrs[bt]
+}
+
+func (nc *NetworkConnection) gatheredCandidateAddrs() map[BindTechnique]*net.UDPAddr {
+	nc.gatheredLock.Lock()
+	defer nc.gatheredLock.Unlock()
+	addrs := map[BindTechnique]*net.UDPAddr{}
+	for bt, addr := range nc.gatheredAddrs {
+		addrs[bt] = addr
+	}
+	return addrs
+}
+
+// fromRelayCandidate returns whether a packet was forwarded by the relay of the relay candidate, it then carries a marker
+func (nc *NetworkConnection) fromRelayCandidate(raddr *net.UDPAddr) bool {
+	nc.gatheredLock.Lock()
+	defer nc.gatheredLock.Unlock()
+	return nc.gatheredRelayAddr != nil && sameUDPAddr(nc.gatheredRelayAddr, raddr)
+}
+
+// releaseRelayCandidate tears down the bridge of the relay candidate when the public port is closed
+func (nc *NetworkConnection) releaseRelayCandidate(relay *BindThroughPeerAgent) {
+	if nc.BindTechnique != BindThroughPeer && nc.gatheredCandidateAddr(BindThroughPeer) != nil {
+		go relay.release()
+	}
+}
+
+// The connectivity checks are sent on the main network connection socket, the magic differentiates them from the WireGuard packets
+var connectivityCheckMagic = []byte("ZTNCHECK")
+
+const (
+	connectivityCheckRequest  = byte(1)
+	connectivityCheckResponse = byte(2)
+)
+
+const connectivityCheckLength = 8 + 1 + 8
+
+// How long the checks are sent when no pair works and how long to wait for a better pair once one works
+var ConnectivityCheckTimeout = 5 * time.Second
+var ConnectivityCheckNominationDelay = 1 * time.Second
+var connectivityCheckInterval = 100 * time.Millisecond
+
+func isConnectivityCheck(b []byte) bool {
+	return len(b) >= connectivityCheckLength && bytes.Equal(b[:len(connectivityCheckMagic)], connectivityCheckMagic)
+}
+
+func connectivityCheckPkt(kind byte, txID uint64) []byte {
+	b := make([]byte, connectivityCheckLength)
+	copy(b, connectivityCheckMagic)
+	b[len(connectivityCheckMagic)] = kind
+	binary.BigEndian.PutUint64(b[len(connectivityCheckMagic)+1:], txID)
+	return b
+}
+
+func parseConnectivityCheckPkt(b []byte) (byte, uint64) {
+	return b[len(connectivityCheckMagic)], binary.BigEndian.Uint64(b[len(connectivityCheckMagic)+1:])
+}
+
+// handleConnectivityCheck answers the requests and delivers the responses to the check that is waiting for them
+// The marker is added to the response when the request went through a bridge
+func (nc *NetworkConnection) handleConnectivityCheck(conn *net.UDPConn, raddr *net.UDPAddr, b []byte, marker []byte) {
+	kind, txID := parseConnectivityCheckPkt(b)
+	switch kind {
+	case connectivityCheckRequest:
+		nc.logger.Debug.Println("Answering connectivity check from", raddr)
+		res := connectivityCheckPkt(connectivityCheckResponse, txID)
+		if marker != nil {
+			res = nc.addMarker(append([]byte{}, marker...), res)
+		}
+		udpSend(res, conn, raddr)
+	case connectivityCheckResponse:
+		nc.checksLock.Lock()
+		defer nc.checksLock.Unlock()
+		if c, ok := nc.checks[txID]; ok {
+			select {
+			case c <- true:
+			default:
+			}
+		}
+	}
+}
+
+// candidateConn returns the socket a local candidate belongs to, nil when its underlay socket was closed
+func (nc *NetworkConnection) candidateConn(c Candidate) *net.UDPConn {
+	if c.Interface == "" {
+		return nc.localConn
+	}
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	for _, u := range nc.underlays {
+		if u.iface == c.Interface {
+			return u.conn
+		}
+	}
+	return nil
+}
+
+// CheckCandidates sends connectivity checks to all the remote candidates in parallel and returns the endpoint of the best working pair along with the socket it was checked from
+// Each remote candidate is paired with the best local candidate of the same address family on each socket, the checks of a pair are sent from the socket of its local candidate
+func (nc *NetworkConnection) CheckCandidates(local, remote []Candidate, controlling bool) (*net.UDPAddr, *net.UDPConn, error) {
+	type pair struct {
+		raddr    *net.UDPAddr
+		conn     *net.UDPConn
+		priority uint64
+		txID     uint64
+		ok       chan bool
+	}
+
+	pairs := []*pair{}
+	for _, rc := range remote {
+		raddr, err := net.ResolveUDPAddr(udp, rc.Endpoint)
+		if err != nil {
+			continue
+		}
+		paired := map[*net.UDPConn]bool{}
+		for _, lc := range local {
+			laddr, err := net.ResolveUDPAddr(udp, lc.Endpoint)
+			if err != nil || (laddr.IP.To4() == nil) != (raddr.IP.To4() == nil) {
+				continue
+			}
+			conn := nc.candidateConn(lc)
+			if conn == nil || paired[conn] {
+				continue
+			}
+			paired[conn] = true
+			p := &pair{raddr: raddr, conn: conn, ok: make(chan bool, 1)}
+			if controlling {
+				p.priority = candidatePairPriority(lc.Priority, rc.Priority)
+			} else {
+				p.priority = candidatePairPriority(rc.Priority, lc.Priority)
+			}
+			p.txID, err = securerandom.Uint64()
+			sharedutils.CheckError(err)
+			pairs = append(pairs, p)
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil, nil, errors.New("no candidate pair to check")
+	}
+
+	nc.checksLock.Lock()
+	for _, p := range pairs {
+		nc.checks[p.txID] = p.ok
+	}
+	nc.checksLock.Unlock()
+	defer func() {
+		nc.checksLock.Lock()
+		defer nc.checksLock.Unlock()
+		for _, p := range pairs {
+			delete(nc.checks, p.txID)
+		}
+	}()
+
+	var best *pair
+	timeout := time.After(ConnectivityCheckTimeout)
+	var nominate <-chan time.Time
+	ticker := time.NewTicker(connectivityCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, p := range pairs {
+			select {
+			case <-p.ok:
+				nc.logger.Debug.Println("Connectivity check succeeded with", p.raddr, "from", p.conn.LocalAddr())
+				if best == nil || p.priority > best.priority {
+					best = p
+				}
+				if nominate == nil {
+					nominate = time.After(ConnectivityCheckNominationDelay)
+				}
+			default:
+			}
+		}
+
+		select {
+		case <-ticker.C:
+			for _, p := range pairs {
+				udpSend(connectivityCheckPkt(connectivityCheckRequest, p.txID), p.conn, p.raddr)
+			}
+		case <-nominate:
+			return best.raddr, best.conn, nil
+		case <-timeout:
+			if best != nil {
+				return best.raddr, best.conn, nil
+			}
+			return nil, nil, errors.New("no candidate pair is working")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ztn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestCandidatePriority(t *testing.T) {
+	host := candidatePriority(CandidateHost, 0)
+	mapped := candidatePriority(CandidateMapped, 65535)
+	srflx := candidatePriority(CandidateServerReflexive, 65535)
+	relay := candidatePriority(CandidateRelay, 65535)
+	if !(host > mapped && mapped > srflx && srflx > relay) {
+		t.Error("The candidate types aren't ordered by preference", host, mapped, srflx, relay)
+	}
+	if candidatePriority(CandidateHost, 2) <= candidatePriority(CandidateHost, 1) {
+		t.Error("The local preference isn't used")
+	}
+
+	if candidatePairPriority(10, 20) != candidatePairPriority(20, 10)-1 {
+		t.Error("The controlling agent doesn't break the ties between symmetric pairs")
+	}
+	if candidatePairPriority(host, relay) >= candidatePairPriority(srflx, srflx) {
+		t.Error("A pair with a relay candidate was preferred over a pair of reflexive candidates")
+	}
+}
+
+// serveConnectivityChecks answers the connectivity checks received on a new socket with nc, only the ones sent from onlyFrom when it isn't nil
+func serveConnectivityChecks(t *testing.T, nc *NetworkConnection, onlyFrom net.Addr) *net.UDPConn {
+	conn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, raddr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if onlyFrom != nil && raddr.String() != onlyFrom.String() {
+				continue
+			}
+			if isConnectivityCheck(buf[:n]) {
+				nc.handleConnectivityCheck(conn, raddr, buf[:n], nil)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestCheckCandidates(t *testing.T) {
+	defer func(timeout, delay time.Duration) {
+		ConnectivityCheckTimeout, ConnectivityCheckNominationDelay = timeout, delay
+	}(ConnectivityCheckTimeout, ConnectivityCheckNominationDelay)
+	ConnectivityCheckTimeout, ConnectivityCheckNominationDelay = 1*time.Second, 300*time.Millisecond
+
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	newNC := func() *NetworkConnection {
+		return &NetworkConnection{logger: logger, checks: map[uint64]chan bool{}}
+	}
+
+	a, b := newNC(), newNC()
+	a.localConn = serveConnectivityChecks(t, a, nil)
+	defer a.localConn.Close()
+	b1, b2 := serveConnectivityChecks(t, b, nil), serveConnectivityChecks(t, b, nil)
+	defer b1.Close()
+	defer b2.Close()
+
+	unreachable, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unreachable.Close()
+
+	local := []Candidate{{Type: CandidateHost, Endpoint: a.localConn.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 1)}}
+	remote := []Candidate{
+		{Type: CandidateHost, Endpoint: unreachable.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 2)},
+		{Type: CandidateServerReflexive, Endpoint: b2.LocalAddr().String(), Priority: candidatePriority(CandidateServerReflexive, 1)},
+		{Type: CandidateHost, Endpoint: b1.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 1)},
+		{Type: CandidateHost, Endpoint: "[2001:db8::1]:12673", Priority: candidatePriority(CandidateHost, 3)},
+	}
+
+	raddr, conn, err := a.CheckCandidates(local, remote, true)
+	if err != nil {
+		t.Fatal("No working pair was found:", err)
+	}
+	if raddr.String() != b1.LocalAddr().String() || conn != a.localConn {
+		t.Error("The best working pair wasn't selected", raddr)
+	}
+
+	// The checks of a pair are sent from the socket of its local candidate
+	wwan := serveConnectivityChecks(t, a, nil)
+	defer wwan.Close()
+	a.underlays = []*underlaySocket{{iface: "wwan0", conn: wwan}}
+	b3 := serveConnectivityChecks(t, b, wwan.LocalAddr())
+	defer b3.Close()
+	withUnderlay := append(local, Candidate{Type: CandidateHost, Endpoint: wwan.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 0), Interface: "wwan0"})
+	raddr, conn, err = a.CheckCandidates(withUnderlay, []Candidate{{Type: CandidateHost, Endpoint: b3.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 1)}}, true)
+	if err != nil {
+		t.Fatal("The pair of the underlay socket didn't work:", err)
+	}
+	if conn != wwan {
+		t.Error("The pair wasn't checked from the socket of its local candidate", conn.LocalAddr())
+	}
+
+	if _, _, err := a.CheckCandidates(local, remote[:1], true); err == nil {
+		t.Error("A candidate that never answered was selected")
+	}
+	if len(a.checks) != 0 {
+		t.Error("The checks weren't cleaned up")
+	}
+}
@@ -0,0 +1,570 @@
+package ztn
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	"github.com/inverse-inc/wireguard-go/util"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the agent
+// It is loaded from a YAML file and the environment variables override the values of the file
+type Config struct {
+	Server          string
+	ServerPort      string
+	ServerVerifyTLS bool
+	Username        string
+	Password        string
+
+	// PEM bundle of the certificate authorities trusted for the server instead of the system ones
+	ServerCAFile string
+	// Base64 encoded SHA-256 hashes of the public keys accepted for the server
+	ServerPinnedKeys []string
+	ClientCertFile   string
+	ClientKeyFile    string
+
+	// Authorizes the enrollment of a device that has no keys yet, the credentials are used when it is empty
+	EnrollmentToken string
+
+	HonorRoutes              bool
+	GatewayOutboundInterface string
+
+	// Empty when the bind technique is selected automatically
+	BindTechnique       BindTechnique
+	StaticBindTechnique bool
+	PublicPortIP        net.IP
+	// Whether the IPv6 address of this host is offered to the peers
+	UseIPv6 bool
+
+	OffersBridging        bool
+	MaxPeerBridges        int
+	MaxPeerBridgesPerPeer int
+	// The bandwidth limits of each bridge and of all the bridges, 0 means unlimited
+	MaxPeerBridgeKbps  int
+	MaxPeerBridgesKbps int
+
+	// Whether the endpoint events of the peers that don't seal them yet are accepted and published, only while upgrading the devices
+	AcceptUnsealedEndpointEvents bool
+
+	// Whether the peers on the local networks are found with broadcasted beacons
+	LANDiscovery bool
+
+	CLI            bool
+	CLIInteractive bool
+	SetupDNS       bool
+	LogLevel       string
+
+	ProfileCacheMaxAge     time.Duration
+	ProfileRefreshInterval time.Duration
+	// Zero when the keys are only rotated on demand
+	KeyRotationInterval time.Duration
+
+	// The configuration files of the additional ZTN connections of this machine
+	Instances []string
+
+	// The file the configuration was loaded from
+	Path string
+	// Where the value of each key comes from
+	Sources map[string]string
+}
+
+const configSourceDefault = "default"
+
+type configKey struct {
+	name         string
+	env          string
+	defaultValue string
+	secret       bool
+	// Whether the key applies to the whole process, the additional instances take its value from the main configuration
+	global bool
+	// Whether the key accepts a list in the file, the list is handled as a comma separated value
+	list bool
+	// Decodes the value of the environment variable when it isn't in the same format as in the file
+	decodeEnv func(string) (string, error)
+	set       func(c *Config, v string) error
+	get       func(c *Config) string
+}
+
+var configKeys = []configKey{
+	stringConfigKey("server", EnvServer, func(c *Config) *string { return &c.Server }),
+	{
+		name: "server_port", env: EnvServerPort,
+		set: func(c *Config, v string) error {
+			if v != "" {
+				if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+					return fmt.Errorf("%s is not a valid port", v)
+				}
+			}
+			c.ServerPort = v
+			return nil
+		},
+		get: func(c *Config) string { return c.ServerPort },
+	},
+	boolConfigKey("server_verify_tls", EnvServerVerifyTLS, "true", func(c *Config) *bool { return &c.ServerVerifyTLS }),
+	stringConfigKey("server_ca_file", EnvServerCAFile, func(c *Config) *string { return &c.ServerCAFile }),
+	{
+		name: "server_pinned_keys", env: EnvServerPinnedKeys, list: true,
+		set: func(c *Config, v string) error {
+			pins := []string{}
+			for _, pin := range strings.Split(v, ",") {
+				pin = strings.TrimSpace(pin)
+				if pin == "" {
+					continue
+				}
+				if err := util.ValidateSPKIPin(pin); err != nil {
+					return err
+				}
+				pins = append(pins, pin)
+			}
+			c.ServerPinnedKeys = pins
+			return nil
+		},
+		get: func(c *Config) string { return strings.Join(c.ServerPinnedKeys, ",") },
+	},
+	stringConfigKey("client_cert_file", EnvClientCertFile, func(c *Config) *string { return &c.ClientCertFile }),
+	stringConfigKey("client_key_file", EnvClientKeyFile, func(c *Config) *string { return &c.ClientKeyFile }),
+	{
+		name: "enrollment_token", env: EnvEnrollmentToken, secret: true,
+		set: func(c *Config, v string) error { c.EnrollmentToken = v; return nil },
+		get: func(c *Config) string { return c.EnrollmentToken },
+	},
+	stringConfigKey("username", EnvUsername, func(c *Config) *string { return &c.Username }),
+	{
+		// The password is base64 encoded in the environment
+		name: "password", env: EnvPassword, secret: true,
+		decodeEnv: func(v string) (string, error) {
+			pass, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return "", errors.New("the password isn't base64 encoded")
+			}
+			return string(pass), nil
+		},
+		set: func(c *Config, v string) error { c.Password = v; return nil },
+		get: func(c *Config) string { return c.Password },
+	},
+	boolConfigKey("honor_routes", EnvHonorRoutes, "true", func(c *Config) *bool { return &c.HonorRoutes }),
+	stringConfigKey("gateway_outbound_interface", EnvGatewayOutboundInterface, func(c *Config) *string { return &c.GatewayOutboundInterface }),
+	{
+		name: "bind_technique", env: EnvBindTechnique,
+		set: func(c *Config, v string) error {
+			if v == "" || v == string(BindAutomatic) {
+				c.BindTechnique = ""
+				return nil
+			}
+			bt, ok := BindTechniqueNames[v]
+			if !ok {
+				names := []string{string(BindAutomatic)}
+				for name := range BindTechniqueNames {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return fmt.Errorf("unknown bind technique %s, must be one of %s", v, strings.Join(names, ", "))
+			}
+			c.BindTechnique = bt
+			return nil
+		},
+		get: func(c *Config) string {
+			if c.BindTechnique == "" {
+				return string(BindAutomatic)
+			}
+			return string(c.BindTechnique)
+		},
+	},
+	boolConfigKey("static_bind_technique", EnvStaticBindTechnique, "false", func(c *Config) *bool { return &c.StaticBindTechnique }),
+	{
+		name: "public_port_ip", env: EnvPublicPortIP,
+		set: func(c *Config, v string) error {
+			if v == "" {
+				c.PublicPortIP = nil
+				return nil
+			}
+			ip := net.ParseIP(v)
+			if ip == nil || ip.To4() == nil {
+				return fmt.Errorf("%s is not a valid IPv4 address", v)
+			}
+			c.PublicPortIP = ip
+			return nil
+		},
+		get: func(c *Config) string {
+			if c.PublicPortIP == nil {
+				return ""
+			}
+			return c.PublicPortIP.String()
+		},
+	},
+	boolConfigKey("use_ipv6", EnvUseIPv6, "true", func(c *Config) *bool { return &c.UseIPv6 }),
+	boolConfigKey("offers_bridging", EnvOffersBridging, "false", func(c *Config) *bool { return &c.OffersBridging }),
+	intConfigKey("max_peer_bridges", EnvMaxPeerBridges, "16", 0, func(c *Config) *int { return &c.MaxPeerBridges }),
+	// Bridging for a peer requires at least one bridge per peer
+	intConfigKey("max_peer_bridges_per_peer", EnvMaxPeerBridgesPerPeer, "2", 1, func(c *Config) *int { return &c.MaxPeerBridgesPerPeer }),
+	intConfigKey("max_peer_bridge_kbps", EnvMaxPeerBridgeKbps, "0", 0, func(c *Config) *int { return &c.MaxPeerBridgeKbps }),
+	intConfigKey("max_peer_bridges_kbps", EnvMaxPeerBridgesKbps, "0", 0, func(c *Config) *int { return &c.MaxPeerBridgesKbps }),
+	boolConfigKey("accept_unsealed_endpoint_events", EnvAcceptUnsealedEndpointEvents, "false", func(c *Config) *bool { return &c.AcceptUnsealedEndpointEvents }),
+	boolConfigKey("lan_discovery", EnvLANDiscovery, "false", func(c *Config) *bool { return &c.LANDiscovery }),
+	globalConfigKey(boolConfigKey("cli", EnvCLI, "true", func(c *Config) *bool { return &c.CLI })),
+	globalConfigKey(boolConfigKey("cli_interactive", EnvCLIInterractive, "true", func(c *Config) *bool { return &c.CLIInteractive })),
+	globalConfigKey(boolConfigKey("setup_dns", EnvSetupDNS, "true", func(c *Config) *bool { return &c.SetupDNS })),
+	{
+		name: "log_level", env: EnvLogLevel, defaultValue: "info", global: true,
+		set: func(c *Config, v string) error {
+			switch v {
+			case "debug", "info", "error", "silent":
+				c.LogLevel = v
+				return nil
+			}
+			return fmt.Errorf("unknown log level %s, must be one of debug, info, error, silent", v)
+		},
+		get: func(c *Config) string { return c.LogLevel },
+	},
+	durationConfigKey("profile_cache_max_age", EnvProfileCacheMaxAge, DefaultProfileCacheMaxAge.String(), func(c *Config) *time.Duration { return &c.ProfileCacheMaxAge }),
+	durationConfigKey("profile_refresh_interval", EnvProfileRefreshInterval, DefaultProfileRefreshInterval.String(), func(c *Config) *time.Duration { return &c.ProfileRefreshInterval }),
+	{
+		name: "key_rotation_interval", env: EnvKeyRotationInterval, defaultValue: "0",
+		set: func(c *Config, v string) (err error) {
+			if v == "" || v == "0" {
+				c.KeyRotationInterval = 0
+				return nil
+			}
+			c.KeyRotationInterval, err = parseConfigDuration(v)
+			return err
+		},
+		get: func(c *Config) string { return c.KeyRotationInterval.String() },
+	},
+	{
+		name: "instances", env: EnvInstances, list: true, global: true,
+		set: func(c *Config, v string) error {
+			instances := []string{}
+			for _, configFile := range strings.Split(v, ",") {
+				configFile = strings.TrimSpace(configFile)
+				if configFile == "" {
+					continue
+				}
+				if name := instanceName(configFile); !instanceNameRegexp.MatchString(name) || name == "main" {
+					return fmt.Errorf("%s can't be used as an instance name, the name of the file must only contain letters, digits, - and _ and must not be main", name)
+				}
+				instances = append(instances, configFile)
+			}
+			c.Instances = instances
+			return nil
+		},
+		get: func(c *Config) string { return strings.Join(c.Instances, ",") },
+	},
+}
+
+func globalConfigKey(k configKey) configKey {
+	k.global = true
+	return k
+}
+
+func stringConfigKey(name, env string, field func(c *Config) *string) configKey {
+	return configKey{
+		name: name, env: env,
+		set: func(c *Config, v string) error { *field(c) = v; return nil },
+		get: func(c *Config) string { return *field(c) },
+	}
+}
+
+func boolConfigKey(name, env, defaultValue string, field func(c *Config) *bool) configKey {
+	return configKey{
+		name: name, env: env, defaultValue: defaultValue,
+		set: func(c *Config, v string) (err error) { *field(c), err = parseConfigBool(v); return err },
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+	}
+}
+
+// intConfigKey is an integer key that must be at least min
+func intConfigKey(name, env, defaultValue string, min int, field func(c *Config) *int) configKey {
+	return configKey{
+		name: name, env: env, defaultValue: defaultValue,
+		set: func(c *Config, v string) error {
+			i, err := strconv.Atoi(v)
+			if err != nil || i < min {
+				return fmt.Errorf("%s is not an integer greater than or equal to %d", v, min)
+			}
+			*field(c) = i
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+	}
+}
+
+func durationConfigKey(name, env, defaultValue string, field func(c *Config) *time.Duration) configKey {
+	return configKey{
+		name: name, env: env, defaultValue: defaultValue,
+		set: func(c *Config, v string) (err error) { *field(c), err = parseConfigDuration(v); return err },
+		get: func(c *Config) string { return field(c).String() },
+	}
+}
+
+func parseConfigBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "y", "1", "enabled":
+		return true, nil
+	case "false", "no", "n", "0", "disabled":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s is not a valid boolean", v)
+}
+
+func parseConfigDuration(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s is not a valid duration", v)
+	}
+	return d, nil
+}
+
+// ConfigErrors holds all the problems found while loading the configuration
+type ConfigErrors []error
+
+func (errs ConfigErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadConfig loads the configuration from the YAML file at path and overrides its values with the environment variables
+// path can be empty in which case only the defaults and the environment are used
+// The configuration is returned along with the errors so that the valid part of it can be inspected
+func LoadConfig(path string) (*Config, error) {
+	return loadConfig(path, true)
+}
+
+// LoadInstanceConfig loads the configuration of an additional instance from its file
+// The environment only holds the settings of the main instance so it doesn't apply, the global keys are taken from main
+func LoadInstanceConfig(main *Config, path string) (*Config, error) {
+	c, err := loadConfig(path, false)
+	errs := ConfigErrors{}
+	if err != nil {
+		errs = append(errs, err.(ConfigErrors)...)
+	}
+
+	for _, k := range configKeys {
+		if !k.global {
+			continue
+		}
+		if c.IsSet(k.name) {
+			errs = append(errs, fmt.Errorf("%s can only be set in the main configuration", k.name))
+		}
+		if err := k.set(c, k.get(main)); err != nil {
+			panic("Invalid value for global configuration key " + k.name + ": " + err.Error())
+		}
+		c.Sources[k.name] = main.Sources[k.name]
+	}
+	c.Instances = nil
+	// The additional instances can't prompt on the terminal they share with the main one
+	c.CLIInteractive = false
+	c.Sources["cli_interactive"] = "additional instance"
+
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
+}
+
+func loadConfig(path string, useEnv bool) (*Config, error) {
+	c := &Config{Path: path, Sources: map[string]string{}}
+	errs := ConfigErrors{}
+
+	for _, k := range configKeys {
+		if err := k.set(c, k.defaultValue); err != nil {
+			panic("Invalid default value for configuration key " + k.name + ": " + err.Error())
+		}
+		c.Sources[k.name] = configSourceDefault
+	}
+
+	if path != "" {
+		errs = append(errs, c.loadFile(path)...)
+	}
+
+	for _, k := range configKeys {
+		if !useEnv {
+			break
+		}
+		v := os.Getenv(k.env)
+		if v == "" {
+			continue
+		}
+		var err error
+		if k.decodeEnv != nil {
+			v, err = k.decodeEnv(v)
+		}
+		if err == nil {
+			err = k.set(c, v)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid value for %s in environment variable %s: %s", k.name, k.env, err))
+			continue
+		}
+		c.Sources[k.name] = "environment variable " + k.env
+	}
+
+	errs = append(errs, c.validate()...)
+
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(path string) ConfigErrors {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ConfigErrors{err}
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return ConfigErrors{fmt.Errorf("Unable to parse %s: %s", path, err)}
+	}
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := ConfigErrors{}
+	for _, name := range names {
+		k, ok := findConfigKey(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("Unknown key %s in %s", name, path))
+			continue
+		}
+
+		var v string
+		switch value := values[name].(type) {
+		case nil:
+			v = ""
+		case []interface{}:
+			if !k.list {
+				errs = append(errs, fmt.Errorf("Invalid value for %s in %s: must be a single value", name, path))
+				continue
+			}
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			v = strings.Join(items, ",")
+		case map[interface{}]interface{}:
+			errs = append(errs, fmt.Errorf("Invalid value for %s in %s: must be a single value", name, path))
+			continue
+		default:
+			v = fmt.Sprint(value)
+		}
+
+		if err := k.set(c, v); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid value for %s in %s: %s", name, path, err))
+			continue
+		}
+		c.Sources[name] = path
+	}
+	return errs
+}
+
+// validate checks the values that depend on each other
+func (c *Config) validate() ConfigErrors {
+	errs := ConfigErrors{}
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		errs = append(errs, errors.New("client_cert_file and client_key_file must be set together"))
+	}
+	names := map[string]bool{}
+	for _, configFile := range c.Instances {
+		name := instanceName(configFile)
+		if names[name] {
+			errs = append(errs, fmt.Errorf("More than one instance is named %s, the names of the files of the instances must be unique", name))
+		}
+		names[name] = true
+	}
+	return errs
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return configKey{}, false
+}
+
+// IsSet returns whether the key was set in the file or in the environment
+func (c *Config) IsSet(name string) bool {
+	source, ok := c.Sources[name]
+	return ok && source != configSourceDefault
+}
+
+// Require returns an error naming the keys which don't have a value
+func (c *Config) Require(names ...string) error {
+	missing := []string{}
+	for _, name := range names {
+		if k, ok := findConfigKey(name); ok && k.get(c) == "" {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, k.env))
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("Missing value for " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Describe returns the effective configuration along with the source of each value
+func (c *Config) Describe() string {
+	var sb strings.Builder
+	for _, k := range configKeys {
+		v := k.get(c)
+		if k.secret && v != "" {
+			v = "********"
+		}
+		fmt.Fprintf(&sb, "%-31s = %-30s (%s)\n", k.name, v, c.Sources[k.name])
+	}
+	return sb.String()
+}
+
+var currentConfig *Config
+var currentMainConfig *Config
+var currentConfigLock sync.Mutex
+
+// GetConfig returns the configuration of the instance of this process
+// For the main instance, it is loaded from the file defined in WG_CONFIG_FILE and from the environment
+// It is loaded on the first call and an invalid configuration is a fatal error
+func GetConfig() *Config {
+	instance := CurrentInstance()
+	if instance.IsMain() {
+		return mainConfig()
+	}
+
+	main := mainConfig()
+	currentConfigLock.Lock()
+	defer currentConfigLock.Unlock()
+	if currentConfig == nil {
+		c, err := LoadInstanceConfig(main, instance.ConfigFile)
+		sharedutils.CheckError(err)
+		currentConfig = c
+	}
+	return currentConfig
+}
+
+func mainConfig() *Config {
+	currentConfigLock.Lock()
+	defer currentConfigLock.Unlock()
+	if currentMainConfig == nil {
+		c, err := LoadConfig(sharedutils.EnvOrDefault(EnvConfigFile, ""))
+		sharedutils.CheckError(err)
+		currentMainConfig = c
+	}
+	return currentMainConfig
+}
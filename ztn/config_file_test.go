@@ -0,0 +1,91 @@
+package ztn
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "ztn-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `
+server: ztn.example.com
+server_port: 9999
+bind_technique: UPNPIGD
+profile_refresh_interval: 1m
+honor_routes: no
+`)
+	defer cleanup()
+
+	os.Setenv(EnvServer, "override.example.com")
+	os.Setenv(EnvPassword, base64.StdEncoding.EncodeToString([]byte("secret")))
+	defer os.Unsetenv(EnvServer)
+	defer os.Unsetenv(EnvPassword)
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal("Unexpected error while loading a valid configuration", err)
+	}
+
+	if c.Server != "override.example.com" || c.Sources["server"] != "environment variable "+EnvServer {
+		t.Error("Environment didn't override the file", c.Server, c.Sources["server"])
+	}
+	if c.ServerPort != "9999" || c.Sources["server_port"] != path {
+		t.Error("Unexpected server port", c.ServerPort, c.Sources["server_port"])
+	}
+	if c.BindTechnique != BindUPNPIGD || c.ProfileRefreshInterval != time.Minute || c.HonorRoutes {
+		t.Error("Values from the file weren't applied", c.BindTechnique, c.ProfileRefreshInterval, c.HonorRoutes)
+	}
+	if c.Password != "secret" {
+		t.Error("Password from the environment wasn't decoded", c.Password)
+	}
+	if !c.SetupDNS || c.IsSet("setup_dns") {
+		t.Error("Default value wasn't applied for setup_dns")
+	}
+	if err := c.Require("server", "username"); err == nil || !strings.Contains(err.Error(), "username") {
+		t.Error("Missing username wasn't reported", err)
+	}
+	if strings.Contains(c.Describe(), "secret") {
+		t.Error("Password is shown in the description of the configuration")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `
+server_prot: 9999
+bind_technique: UPNP
+max_peer_bridges: many
+max_peer_bridges_per_peer: 0
+`)
+	defer cleanup()
+
+	os.Setenv(EnvHonorRoutes, "maybe")
+	defer os.Unsetenv(EnvHonorRoutes)
+
+	_, err := LoadConfig(path)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 5 {
+		t.Fatal("Unexpected errors", err)
+	}
+
+	for _, key := range []string{"server_prot", "bind_technique", "max_peer_bridges", "max_peer_bridges_per_peer", "honor_routes"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Error("Error doesn't name the bad key", key)
+		}
+	}
+}
@@ -14,6 +14,8 @@ type Connection struct {
 	Status    string
 	LastError error
 
+	ProfileCache *ProfileCache
+
 	logger *device.Logger
 }
 
@@ -36,6 +38,17 @@ func (c *Connection) StartPeer(device *device.Device, profile Profile, peerID st
 	}
 
 	peerProfile, err := GetPeerProfile(peerID)
+	if c.ProfileCache != nil {
+		if err == nil {
+			if cacheErr := c.ProfileCache.SetPeer(peerID, peerProfile); cacheErr != nil {
+				c.logger.Error.Println("Unable to save profile of peer", peerID, "in the cache:", cacheErr)
+			}
+		} else if cached, ok := c.ProfileCache.GetPeer(peerID); ok {
+			c.logger.Info.Println("Unable to fetch profile for peer", peerID, "from the server, using the cached one. Error:", err)
+			peerProfile, err = cached, nil
+		}
+	}
+
 	if err != nil {
 		c.logger.Error.Println("Unable to fetch profile for peer", peerID, ". Error:", err)
 		c.logger.Error.Println(debug.Stack())
@@ -43,7 +56,7 @@ func (c *Connection) StartPeer(device *device.Device, profile Profile, peerID st
 		c.logger.Info.Println("Starting connection to peer", peerID)
 		c.Peers[peerID] = NewPeerConnection(device, c.logger, profile, peerProfile, networkConnection)
 		go func(peerID string, peerProfile PeerProfile, pc *PeerConnection) {
-			for {
+			for !pc.Stopped() {
 				func() {
 					defer func() {
 						if r := recover(); r != nil {
@@ -57,3 +70,97 @@ func (c *Connection) StartPeer(device *device.Device, profile Profile, peerID st
 		}(peerID, peerProfile, c.Peers[peerID])
 	}
 }
+
+// StopPeer tears down the connection to a peer and forgets about it
+func (c *Connection) StopPeer(peerID string) {
+	c.Lock()
+	pc := c.Peers[peerID]
+	delete(c.Peers, peerID)
+	c.Unlock()
+
+	if pc == nil {
+		c.logger.Debug.Println("Not stopping", peerID, "since it isn't in the known peers")
+		return
+	}
+
+	c.logger.Info.Println("Stopping connection to peer", peerID)
+	pc.Stop()
+}
+
+// StopPeers tears down the connections to all the peers
+func (c *Connection) StopPeers() {
+	c.Lock()
+	peerIDs := []string{}
+	for peerID := range c.Peers {
+		peerIDs = append(peerIDs, peerID)
+	}
+	c.Unlock()
+
+	for _, peerID := range peerIDs {
+		c.StopPeer(peerID)
+	}
+}
+
+// RestartPeer tears down the connection to a peer and starts it again using a freshly fetched peer profile
+func (c *Connection) RestartPeer(device *device.Device, profile Profile, peerID string, networkConnection *NetworkConnection) {
+	c.StopPeer(peerID)
+	c.StartPeer(device, profile, peerID, networkConnection)
+}
+
+// ReconnectPeer reestablishes the connection to a peer while keeping its profile
+func (c *Connection) ReconnectPeer(peerID string) {
+	c.Lock()
+	pc := c.Peers[peerID]
+	c.Unlock()
+
+	if pc == nil {
+		c.logger.Debug.Println("Not reconnecting", peerID, "since it isn't in the known peers")
+		return
+	}
+	pc.Reconnect()
+}
+
+// ReconnectPeers reestablishes the connections to all the peers
+func (c *Connection) ReconnectPeers() {
+	c.Lock()
+	defer c.Unlock()
+	for _, pc := range c.Peers {
+		pc.Reconnect()
+	}
+}
+
+// HandleNetworkChange opens a new public port if the path to the Internet changed and reestablishes the connections to the peers whose path changed
+// The connections to the peers that are still reachable the same way are left untouched
+func (c *Connection) HandleNetworkChange(networkConnection *NetworkConnection) {
+	rebound := networkConnection.HandleNetworkChange()
+
+	c.Lock()
+	defer c.Unlock()
+	for peerID, pc := range c.Peers {
+		if pc.PathChanged(rebound) {
+			c.logger.Info.Println("The path to peer", peerID, "changed, reconnecting")
+			pc.Reconnect()
+		} else {
+			c.logger.Debug.Println("The path to peer", peerID, "is unchanged")
+		}
+	}
+}
+
+// HandlePublicAddrChange moves the peers that reach this device through its public address to the new one
+// The connected peers are given the new address and update their endpoint without reconnecting, the other ones are connected again
+func (c *Connection) HandlePublicAddrChange() {
+	c.Lock()
+	defer c.Unlock()
+	for peerID, pc := range c.Peers {
+		if !pc.PathChanged(true) {
+			continue
+		}
+		if pc.Connected() {
+			c.logger.Info.Println("The public address used by peer", peerID, "changed, publishing it")
+			pc.RepublishEndpoint()
+		} else {
+			c.logger.Info.Println("The public address used by peer", peerID, "changed, reconnecting")
+			pc.Reconnect()
+		}
+	}
+}
@@ -31,6 +31,9 @@ const (
 	ConnectionTypeWANIN   = "WAN IN"
 	ConnectionTypeWANOUT  = "WAN OUT"
 	ConnectionTypeWANSTUN = "WAN STUN"
+	ConnectionTypeWANIPv6 = "WAN IPv6"
+	// The best candidate pair that passed the connectivity checks
+	ConnectionTypeICE = "ICE"
 )
 
 func PublicPortTTL() int {
@@ -0,0 +1,107 @@
+package ztn
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+// The suffix of the file holding the keys of an enrollment until the server accepted them
+const enrollingAuthFileSuffix = ".enrolling"
+
+// Set while enrolling so that the CLI asks for an enrollment token along with the credentials
+var enrollmentPending bool
+var cliEnrollmentToken string
+
+type enrollRequest struct {
+	PublicKey string `json:"public_key"`
+	Token     string `json:"token,omitempty"`
+	Hostname  string `json:"hostname"`
+}
+
+// NeedsEnrollment returns whether this device has no keys yet
+func NeedsEnrollment(authFile string) bool {
+	_, err := os.Stat(authFile)
+	return os.IsNotExist(err)
+}
+
+// Enroll registers this device on the server using the enrollment token of the configuration or the one entered on the CLI
+// Without a token, the device is registered using the credentials of the API client
+func Enroll(authFile string, logger *device.Logger) error {
+	enrollmentPending = true
+	defer func() { enrollmentPending = false }()
+
+	GetAPIClient()
+
+	token := GetConfig().EnrollmentToken
+	if token == "" {
+		token = cliEnrollmentToken
+	}
+	return EnrollDevice(authFile, token, logger)
+}
+
+// EnrollDevice generates the keys of this device, registers its public key on the server and saves the keys in authFile
+// The keys are saved aside before registering them so that they are never lost once the server knows them
+// They are kept when the outcome of the registration is unknown and the next enrollment registers them again
+// authFile only appears once the registration succeeded since the other processes wait for it
+func EnrollDevice(authFile string, token string, logger *device.Logger) error {
+	if !NeedsEnrollment(authFile) {
+		return fmt.Errorf("%s already exists, this device is already enrolled", authFile)
+	}
+
+	pendingFile := authFile + enrollingAuthFileSuffix
+	privateKey, publicKey, err := readAuthFileKeys(pendingFile)
+	if err == nil {
+		logger.Info.Println("Resuming the enrollment of the public key", publicKey)
+	} else {
+		priv, pub, err := generateKeyPair()
+		if err != nil {
+			return err
+		}
+		privateKey = base64.StdEncoding.EncodeToString(priv[:])
+		publicKey = base64.StdEncoding.EncodeToString(pub[:])
+		if err := writeAuthFile(pendingFile, privateKey, publicKey); err != nil {
+			return fmt.Errorf("Unable to save the keys in %s: %s", pendingFile, err)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	err = callOptionalEndpoint(
+		"/api/v1/remote_clients/enroll",
+		enrollRequest{
+			PublicKey: b64keyToURLb64(publicKey),
+			Token:     token,
+			Hostname:  hostname,
+		},
+	)
+	if err == ErrUnsupportedEndpoint {
+		os.Remove(pendingFile)
+		return fmt.Errorf("The server doesn't support the enrollment, the keys of this device must be provisioned in %s", authFile)
+	} else if err != nil {
+		// The server may have registered the keys even though its reply was lost or the keys of a previous attempt were registered
+		pending := Profile{PrivateKey: privateKey}
+		pending.PublicKey = publicKey
+		if keyAccepted(pending, logger) {
+			logger.Info.Println("The public key was already registered")
+		} else if registrationOutcomeUnknown(err) {
+			return fmt.Errorf("Unable to register this device on the server, the keys are kept in %s to retry: %s", pendingFile, err)
+		} else {
+			os.Remove(pendingFile)
+			return fmt.Errorf("Unable to register this device on the server: %s", err)
+		}
+	}
+
+	return os.Rename(pendingFile, authFile)
+}
+
+// registrationOutcomeUnknown returns whether the server may have processed a request that failed
+// The API client returns the errors of the HTTP client as is and the server answered when it returned another error
+func registrationOutcomeUnknown(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,160 @@
+package ztn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestEnrollDevice(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	dir, err := ioutil.TempDir("", "ztn-enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	enroll := func(name, token string) (Profile, error) {
+		authFile := filepath.Join(dir, name)
+		if err := EnrollDevice(authFile, token, logger); err != nil {
+			return Profile{}, err
+		}
+
+		stat, err := os.Stat(authFile)
+		if err != nil {
+			t.Fatal("The auth file wasn't written", err)
+		}
+		if stat.Mode().Perm() != 0600 {
+			t.Error("Unexpected permissions on the auth file", stat.Mode().Perm())
+		}
+
+		profile := Profile{}
+		data, _ := ioutil.ReadFile(authFile)
+		if err := json.Unmarshal(data, &profile); err != nil {
+			t.Fatal("Unable to decode the auth file", err)
+		}
+		return profile, profile.FillProfileFromServer(nil, logger)
+	}
+
+	profile, err := enroll("credentials.json", "")
+	if err != nil {
+		t.Fatal("Unable to use the profile of the device enrolled with the credentials", err)
+	}
+	if profile.WireguardIP == nil || profile.Hostname == "" {
+		t.Error("Unexpected profile for the enrolled device", profile.WireguardIP, profile.Hostname)
+	}
+
+	srv.AddEnrollmentToken("secret-token", net.ParseIP("100.64.0.10"))
+	profile, err = enroll("token.json", "secret-token")
+	if err != nil {
+		t.Fatal("Unable to use the profile of the device enrolled with a token", err)
+	}
+	if !profile.WireguardIP.Equal(net.ParseIP("100.64.0.10")) {
+		t.Error("The device enrolled with a token didn't get the IP of the token", profile.WireguardIP)
+	}
+
+	if _, err := enroll("reused.json", "secret-token"); err == nil {
+		t.Error("An enrollment token was used twice")
+	}
+	if !NeedsEnrollment(filepath.Join(dir, "reused.json")) {
+		t.Error("The keys of a failed enrollment were kept")
+	}
+
+	if err := EnrollDevice(filepath.Join(dir, "token.json"), "", logger); err == nil {
+		t.Error("An enrolled device was enrolled again")
+	}
+}
+
+func TestEnrollDeviceUnsupported(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	srv.RemoveEndpoint("/api/v1/remote_clients/enroll")
+
+	dir, err := ioutil.TempDir("", "ztn-enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	authFile := filepath.Join(dir, "auth.json")
+	if err := EnrollDevice(authFile, "", logger); err == nil || !strings.Contains(err.Error(), "doesn't support the enrollment") {
+		t.Error("The server that doesn't implement the enrollment wasn't reported", err)
+	}
+	if !NeedsEnrollment(authFile) {
+		t.Error("The keys were saved while the server doesn't support the enrollment")
+	}
+	if _, err := os.Stat(authFile + ".enrolling"); !os.IsNotExist(err) {
+		t.Error("The keys the server can't have registered were kept", err)
+	}
+}
+
+func TestEnrollDeviceRetry(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	dir, err := ioutil.TempDir("", "ztn-enroll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "auth.json")
+	pendingFile := authFile + enrollingAuthFileSuffix
+
+	// The server may have registered the keys, they must be kept
+	srv.Close()
+	if err := EnrollDevice(authFile, "", logger); err == nil {
+		t.Fatal("The enrollment succeeded while the server is unreachable")
+	}
+	teardown()
+	_, pendingPublicKey, err := readAuthFileKeys(pendingFile)
+	if err != nil {
+		t.Fatal("The keys weren't kept after an error whose outcome is unknown", err)
+	}
+
+	srv, teardown = setupFakeServer()
+	defer teardown()
+	if err := EnrollDevice(authFile, "", logger); err != nil {
+		t.Fatal("Unable to resume the enrollment", err)
+	}
+	if _, publicKey, _ := readAuthFileKeys(authFile); publicKey != pendingPublicKey {
+		t.Error("The enrollment wasn't retried with the same keys", publicKey, pendingPublicKey)
+	}
+
+	// The server registered the keys but the reply was lost, the token can't be used again
+	os.Remove(authFile)
+	privateKey, publicKey, _ := generateKeyPair()
+	writeAuthFile(pendingFile, base64.StdEncoding.EncodeToString(privateKey[:]), base64.StdEncoding.EncodeToString(publicKey[:]))
+	srv.SetProfile(remoteclients.Peer{
+		PublicKey:        base64.StdEncoding.EncodeToString(publicKey[:]),
+		WireguardIP:      net.ParseIP("100.64.0.10"),
+		WireguardNetmask: 24,
+		Hostname:         "agent1",
+	})
+	if err := EnrollDevice(authFile, "used-token", logger); err != nil {
+		t.Fatal("The keys the server already registered weren't used", err)
+	}
+	if _, err := os.Stat(pendingFile); !os.IsNotExist(err) {
+		t.Error("The pending keys weren't committed", err)
+	}
+
+	// The server refused the keys
+	os.Remove(authFile)
+	if err := EnrollDevice(authFile, "invalid-token", logger); err == nil {
+		t.Fatal("The enrollment succeeded with an invalid token")
+	}
+	if _, err := os.Stat(pendingFile); !os.IsNotExist(err) {
+		t.Error("The keys refused by the server were kept", err)
+	}
+}
@@ -1,13 +1,22 @@
 package ztn
 
 const (
+	EnvConfigFile = "WG_CONFIG_FILE"
+
 	EnvServer          = "WG_SERVER"
 	EnvServerPort      = "WG_SERVER_PORT"
 	EnvServerVerifyTLS = "WG_SERVER_VERIFY_TLS"
 
+	EnvServerCAFile     = "WG_SERVER_CA_FILE"
+	EnvServerPinnedKeys = "WG_SERVER_PINNED_KEYS"
+	EnvClientCertFile   = "WG_CLIENT_CERT_FILE"
+	EnvClientKeyFile    = "WG_CLIENT_KEY_FILE"
+
 	EnvUsername = "WG_USERNAME"
 	EnvPassword = "WG_PASSWORD"
 
+	EnvEnrollmentToken = "WG_ENROLLMENT_TOKEN"
+
 	EnvHonorRoutes = "WG_HONOR_ROUTES"
 
 	EnvBindTechnique       = "WG_BIND_TECHNIQUE"
@@ -15,8 +24,17 @@ const (
 
 	EnvPublicPortIP = "WG_PUBLIC_PORT_IP"
 
-	EnvOffersBridging = "WG_OFFERS_BRIDGING"
-	EnvMaxPeerBridges = "WG_MAX_PEER_BRIDGES"
+	EnvUseIPv6 = "WG_USE_IPV6"
+
+	EnvOffersBridging        = "WG_OFFERS_BRIDGING"
+	EnvMaxPeerBridges        = "WG_MAX_PEER_BRIDGES"
+	EnvMaxPeerBridgesPerPeer = "WG_MAX_PEER_BRIDGES_PER_PEER"
+	EnvMaxPeerBridgeKbps     = "WG_MAX_PEER_BRIDGE_KBPS"
+	EnvMaxPeerBridgesKbps    = "WG_MAX_PEER_BRIDGES_KBPS"
+
+	EnvAcceptUnsealedEndpointEvents = "WG_ACCEPT_UNSEALED_ENDPOINT_EVENTS"
+
+	EnvLANDiscovery = "WG_LAN_DISCOVERY"
 
 	EnvGatewayOutboundInterface = "WG_GATEWAY_OUTBOUND_INTERFACE"
 
@@ -26,4 +44,15 @@ const (
 	EnvGUIPID = "WG_GUI_PID"
 
 	EnvSetupDNS = "WG_SETUP_DNS"
+
+	EnvLogLevel = "LOG_LEVEL"
+
+	EnvProfileCacheMaxAge     = "WG_PROFILE_CACHE_MAX_AGE"
+	EnvProfileRefreshInterval = "WG_PROFILE_REFRESH_INTERVAL"
+
+	EnvKeyRotationInterval = "WG_KEY_ROTATION_INTERVAL"
+
+	EnvInstances = "WG_INSTANCES"
+	// Set by the master process on the tunnel process of each instance
+	EnvInstance = "WG_INSTANCE"
 )
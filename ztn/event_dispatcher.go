@@ -0,0 +1,115 @@
+package ztn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+type typedEvent interface {
+	Validate() error
+}
+
+type eventRegistration struct {
+	new      func() typedEvent
+	handlers []func(typedEvent)
+}
+
+// EventDispatcher decodes the events sent by the server into their typed structs and dispatches them to the handlers registered for their type
+type EventDispatcher struct {
+	sync.Mutex
+	registrations map[string]*eventRegistration
+	unknownEvents map[string]uint64
+}
+
+func NewEventDispatcher() *EventDispatcher {
+	ed := &EventDispatcher{
+		registrations: map[string]*eventRegistration{},
+		unknownEvents: map[string]uint64{},
+	}
+	ed.register(EventTypeNewPeer, func() typedEvent { return &NewPeerEvent{} })
+	ed.register(EventTypePeerRemoved, func() typedEvent { return &PeerRemovedEvent{} })
+	ed.register(EventTypePeerUpdated, func() typedEvent { return &PeerUpdatedEvent{} })
+	ed.register(EventTypeProfileUpdated, func() typedEvent { return &ProfileUpdatedEvent{} })
+	ed.register(EventTypeACLUpdated, func() typedEvent { return &ACLUpdatedEvent{} })
+	ed.register(EventTypeForceReconnect, func() typedEvent { return &ForceReconnectEvent{} })
+	return ed
+}
+
+func (ed *EventDispatcher) register(eventType string, new func() typedEvent) {
+	ed.registrations[eventType] = &eventRegistration{new: new}
+}
+
+func (ed *EventDispatcher) addHandler(eventType string, h func(typedEvent)) {
+	ed.Lock()
+	defer ed.Unlock()
+	reg := ed.registrations[eventType]
+	reg.handlers = append(reg.handlers, h)
+}
+
+func (ed *EventDispatcher) OnNewPeer(h func(NewPeerEvent)) {
+	ed.addHandler(EventTypeNewPeer, func(e typedEvent) { h(*e.(*NewPeerEvent)) })
+}
+
+func (ed *EventDispatcher) OnPeerRemoved(h func(PeerRemovedEvent)) {
+	ed.addHandler(EventTypePeerRemoved, func(e typedEvent) { h(*e.(*PeerRemovedEvent)) })
+}
+
+func (ed *EventDispatcher) OnPeerUpdated(h func(PeerUpdatedEvent)) {
+	ed.addHandler(EventTypePeerUpdated, func(e typedEvent) { h(*e.(*PeerUpdatedEvent)) })
+}
+
+func (ed *EventDispatcher) OnProfileUpdated(h func(ProfileUpdatedEvent)) {
+	ed.addHandler(EventTypeProfileUpdated, func(e typedEvent) { h(*e.(*ProfileUpdatedEvent)) })
+}
+
+func (ed *EventDispatcher) OnACLUpdated(h func(ACLUpdatedEvent)) {
+	ed.addHandler(EventTypeACLUpdated, func(e typedEvent) { h(*e.(*ACLUpdatedEvent)) })
+}
+
+func (ed *EventDispatcher) OnForceReconnect(h func(ForceReconnectEvent)) {
+	ed.addHandler(EventTypeForceReconnect, func(e typedEvent) { h(*e.(*ForceReconnectEvent)) })
+}
+
+// Dispatch decodes the event and calls the handlers registered for its type
+// An error is returned when the type is unknown or when the payload is malformed, in which case no handler is called
+func (ed *EventDispatcher) Dispatch(e Event) error {
+	ed.Lock()
+	reg, ok := ed.registrations[e.Type]
+	if !ok {
+		ed.unknownEvents[e.Type]++
+		ed.Unlock()
+		return fmt.Errorf("Unknown event type %s", e.Type)
+	}
+	handlers := make([]func(typedEvent), len(reg.handlers))
+	copy(handlers, reg.handlers)
+	ed.Unlock()
+
+	te := reg.new()
+	// Some events don't carry any data
+	if len(e.Data) > 0 {
+		if err := json.Unmarshal(e.Data, te); err != nil {
+			return fmt.Errorf("Malformed %s event: %s", e.Type, err)
+		}
+	}
+
+	if err := te.Validate(); err != nil {
+		return fmt.Errorf("Invalid %s event: %s", e.Type, err)
+	}
+
+	for _, h := range handlers {
+		h(te)
+	}
+	return nil
+}
+
+// UnknownEvents returns the amount of events received for each unknown type
+func (ed *EventDispatcher) UnknownEvents() map[string]uint64 {
+	ed.Lock()
+	defer ed.Unlock()
+	counts := map[string]uint64{}
+	for t, c := range ed.unknownEvents {
+		counts[t] = c
+	}
+	return counts
+}
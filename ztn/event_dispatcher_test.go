@@ -0,0 +1,66 @@
+package ztn
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventDispatcher(t *testing.T) {
+	ed := NewEventDispatcher()
+
+	removed := []string{}
+	ed.OnPeerRemoved(func(e PeerRemovedEvent) {
+		removed = append(removed, e.ID)
+	})
+
+	profileUpdates := 0
+	ed.OnProfileUpdated(func(e ProfileUpdatedEvent) {
+		profileUpdates++
+	})
+
+	if err := ed.Dispatch(Event{Type: EventTypePeerRemoved, Data: json.RawMessage(`{"id":"peer1"}`)}); err != nil {
+		t.Error("Unexpected error while dispatching a valid event", err)
+	}
+
+	if len(removed) != 1 || removed[0] != "peer1" {
+		t.Error("Handler wasn't called with the right event", removed)
+	}
+
+	// Missing ID
+	if err := ed.Dispatch(Event{Type: EventTypePeerRemoved, Data: json.RawMessage(`{}`)}); err == nil {
+		t.Error("Event without an ID wasn't rejected")
+	}
+
+	// Wrong type for the ID
+	if err := ed.Dispatch(Event{Type: EventTypePeerRemoved, Data: json.RawMessage(`{"id":42}`)}); err == nil {
+		t.Error("Malformed event wasn't rejected")
+	}
+
+	if len(removed) != 1 {
+		t.Error("Handler was called for an invalid event", removed)
+	}
+
+	// Events without data
+	if err := ed.Dispatch(Event{Type: EventTypeProfileUpdated}); err != nil {
+		t.Error("Unexpected error while dispatching an event without data", err)
+	}
+
+	if profileUpdates != 1 {
+		t.Error("Handler wasn't called for an event without data")
+	}
+
+	// Known type without any handler
+	if err := ed.Dispatch(Event{Type: EventTypeNewPeer, Data: json.RawMessage(`{"id":"peer2"}`)}); err != nil {
+		t.Error("Unexpected error while dispatching an event without handlers", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ed.Dispatch(Event{Type: "unknown_event"}); err == nil {
+			t.Error("Unknown event wasn't rejected")
+		}
+	}
+
+	if c := ed.UnknownEvents()["unknown_event"]; c != 2 {
+		t.Error("Unknown events weren't counted properly", c)
+	}
+}
@@ -0,0 +1,236 @@
+package ztn
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	"github.com/inverse-inc/packetfence/go/unifiedapiclient/glpclient"
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+// Amount of events kept in memory so that subscribers can resume from their cursor after reconnecting
+var DefaultEventBacklogSize = 256
+
+// Amount of new events that can be queued for a subscriber before it is considered too slow and gets disconnected
+const eventSubscriberQueueSize = 64
+
+// StreamEvent is an event received from the server along with its position in the stream
+// The cursor is the sequence ID of the event, distinct events always get distinct cursors even when their content is the same
+type StreamEvent struct {
+	Cursor uint64
+	Event  Event
+}
+
+// EventSubscriber receives the events of an EventSubscription on its channel
+// The channel is closed when the subscriber is too slow to consume the events, it must then subscribe again with the cursor of the last event it handled
+type EventSubscriber struct {
+	C <-chan StreamEvent
+	// The cursor from which the subscriber receives the events
+	Since uint64
+	// Whether the subscriber missed events that aren't available anymore and must resynchronize its state
+	Resync bool
+
+	id uint64
+	c  chan StreamEvent
+}
+
+// EventSubscription keeps a single private event stream with the server for this device and fans the events out to the local subscribers
+type EventSubscription struct {
+	sync.Mutex
+	// Identifies this stream, a subscriber resuming with another stream ID has missed events
+	StreamID string
+
+	connection       *Connection
+	logger           *device.Logger
+	cursor           uint64
+	backlog          []StreamEvent
+	backlogSize      int
+	subscribers      map[uint64]*EventSubscriber
+	nextSubscriberID uint64
+	// Receives the profile to reopen the stream with when the keys of this device change
+	profileChan chan Profile
+}
+
+func NewEventSubscription(connection *Connection, logger *device.Logger) *EventSubscription {
+	return &EventSubscription{
+		StreamID:    fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano()),
+		connection:  connection,
+		logger:      logger.AddPrepend("(EVENTS) "),
+		backlogSize: DefaultEventBacklogSize,
+		subscribers: map[uint64]*EventSubscriber{},
+		profileChan: make(chan Profile, 1),
+	}
+}
+
+// Start opens the private event stream of the profile and publishes the events it receives until the process exits
+// The stream is reopened when SetProfile is called, the cursor continues so the subscribers aren't affected
+func (es *EventSubscription) Start(profile Profile) {
+	for {
+		c := es.openPrivateClient(profile)
+		c.Start(APIClientCtx)
+
+		reopen := false
+		for !reopen {
+			select {
+			case e, ok := <-c.EventsChan:
+				if !ok {
+					c.Stop()
+					return
+				}
+				event := Event{}
+				err := json.Unmarshal(e.Data, &event)
+				if err != nil {
+					es.logger.Error.Println("Unable to decode event:", err)
+					continue
+				}
+				es.publish(event)
+			case profile = <-es.profileChan:
+				es.logger.Info.Println("Reopening the events stream with the new keys")
+				c.Stop()
+				reopen = true
+			}
+		}
+	}
+}
+
+// SetProfile reopens the private event stream using the keys of the profile
+func (es *EventSubscription) SetProfile(profile Profile) {
+	// Only the latest profile matters if the previous one wasn't picked up yet
+	select {
+	case <-es.profileChan:
+	default:
+	}
+	es.profileChan <- profile
+}
+
+func (es *EventSubscription) openPrivateClient(profile Profile) *glpclient.Client {
+	chal, err := GetServerChallenge(&profile)
+	if err != nil {
+		es.logger.Error.Println("Got an error while starting to listen events", err)
+		if es.connection != nil {
+			es.connection.Update(func() {
+				es.connection.Status = STATUS_ERROR
+				es.connection.LastError = err
+			})
+		}
+	}
+
+	// The server may be unreachable when running from the cached profile, wait for it to come back
+	for err != nil {
+		time.Sleep(10 * time.Second)
+		chal, err = GetServerChallenge(&profile)
+	}
+
+	priv, err := remoteclients.B64KeyToBytes(profile.PrivateKey)
+	sharedutils.CheckError(err)
+	pub, err := remoteclients.B64KeyToBytes(profile.PublicKey)
+	sharedutils.CheckError(err)
+	serverPub, err := remoteclients.URLB64KeyToBytes(chal.PublicKey)
+	sharedutils.CheckError(err)
+
+	c := GLPPrivateClient(priv, pub, serverPub)
+	c.LogErrors = true
+	return c
+}
+
+// publish records the event in the backlog with the next cursor and sends it to the subscribers
+// The long-poll only returns the events following the last one it received so every event is published, even when identical to a previous one
+func (es *EventSubscription) publish(e Event) {
+	es.Lock()
+	defer es.Unlock()
+
+	es.cursor++
+	se := StreamEvent{Cursor: es.cursor, Event: e}
+	es.backlog = append(es.backlog, se)
+	if len(es.backlog) > es.backlogSize {
+		es.backlog = es.backlog[len(es.backlog)-es.backlogSize:]
+	}
+
+	for id, sub := range es.subscribers {
+		select {
+		case sub.c <- se:
+		default:
+			es.logger.Error.Println("Subscriber", id, "is too slow to consume the events, disconnecting it")
+			delete(es.subscribers, id)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber that receives the events following the since cursor of the stream identified by streamID
+// An empty streamID subscribes to the new events only
+func (es *EventSubscription) Subscribe(streamID string, since uint64) *EventSubscriber {
+	es.Lock()
+	defer es.Unlock()
+
+	sub := &EventSubscriber{Since: since}
+
+	if streamID == "" {
+		sub.Since = es.cursor
+	} else if streamID != es.StreamID {
+		// The stream was restarted since the subscriber last received events
+		sub.Resync = true
+		sub.Since = es.cursor
+	} else if since > es.cursor {
+		// The cursor doesn't belong to this stream so the events the subscriber missed can't be known
+		sub.Resync = true
+		sub.Since = es.cursor
+	} else if len(es.backlog) > 0 && since+1 < es.backlog[0].Cursor {
+		// The events following the cursor aren't in the backlog anymore
+		sub.Resync = true
+		sub.Since = es.cursor
+	}
+
+	sub.c = make(chan StreamEvent, len(es.backlog)+eventSubscriberQueueSize)
+	sub.C = sub.c
+	for _, se := range es.backlog {
+		if se.Cursor > sub.Since {
+			sub.c <- se
+		}
+	}
+
+	es.nextSubscriberID++
+	sub.id = es.nextSubscriberID
+	es.subscribers[sub.id] = sub
+	return sub
+}
+
+func (es *EventSubscription) Unsubscribe(sub *EventSubscriber) {
+	es.Lock()
+	defer es.Unlock()
+	if _, ok := es.subscribers[sub.id]; ok {
+		delete(es.subscribers, sub.id)
+		close(sub.c)
+	}
+}
+
+// Listen dispatches the events of the subscription in this process
+// onResync is called when events were missed and the state must be fetched again from the server
+func (es *EventSubscription) Listen(dispatcher *EventDispatcher, onResync func()) {
+	streamID := ""
+	var cursor uint64
+	for {
+		sub := es.Subscribe(streamID, cursor)
+		streamID = es.StreamID
+		cursor = sub.Since
+		if sub.Resync {
+			onResync()
+		}
+		for se := range sub.C {
+			// The cursor is the sequence ID of the event, the events that were already handled are dropped
+			if se.Cursor <= cursor {
+				continue
+			}
+			cursor = se.Cursor
+			if err := dispatcher.Dispatch(se.Event); err != nil {
+				es.logger.Error.Println("Unable to handle event:", err)
+			}
+		}
+		es.logger.Info.Println("Resuming the events from cursor", cursor)
+	}
+}
@@ -0,0 +1,64 @@
+package ztn
+
+import (
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestEventSubscription(t *testing.T) {
+	es := NewEventSubscription(nil, device.NewLogger(device.LogLevelSilent, ""))
+	es.backlogSize = 3
+
+	sub := es.Subscribe("", 0)
+
+	// Distinct events with the same content get distinct cursors
+	es.publish(Event{Type: EventTypeProfileUpdated})
+	es.publish(Event{Type: EventTypeProfileUpdated})
+
+	for _, cursor := range []uint64{1, 2} {
+		se := <-sub.C
+		if se.Cursor != cursor {
+			t.Error("Unexpected cursor", se.Cursor, "expected", cursor)
+		}
+	}
+	es.Unsubscribe(sub)
+
+	es.publish(Event{Type: EventTypeProfileUpdated})
+
+	// Resuming from the last cursor replays the events that were missed
+	resumed := es.Subscribe(es.StreamID, 2)
+	if resumed.Resync {
+		t.Error("Subscriber resuming from a cursor in the backlog shouldn't need to resync")
+	}
+	if se := <-resumed.C; se.Cursor != 3 {
+		t.Error("Unexpected cursor", se.Cursor, "expected", 3)
+	}
+	es.Unsubscribe(resumed)
+
+	es.publish(Event{Type: EventTypeProfileUpdated})
+	es.publish(Event{Type: EventTypeProfileUpdated})
+
+	// The event following cursor 1 isn't in the backlog anymore
+	if !es.Subscribe(es.StreamID, 1).Resync {
+		t.Error("Subscriber resuming from a cursor outside the backlog should resync")
+	}
+
+	if !es.Subscribe("another-stream", 5).Resync {
+		t.Error("Subscriber resuming from another stream should resync")
+	}
+
+	// A subscriber of a previous stream can have a cursor past the one of the restarted stream
+	stale := es.Subscribe("another-stream", 1000)
+	if !stale.Resync || stale.Since != 5 {
+		t.Error("Subscriber resuming from another stream with a large cursor should resync from the current cursor", stale.Resync, stale.Since)
+	}
+	es.publish(Event{Type: EventTypeProfileUpdated})
+	if se := <-stale.C; se.Cursor != 6 {
+		t.Error("Unexpected cursor", se.Cursor, "expected", 6)
+	}
+
+	if !es.Subscribe(es.StreamID, 1000).Resync {
+		t.Error("Subscriber with a cursor past the one of the stream should resync")
+	}
+}
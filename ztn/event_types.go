@@ -0,0 +1,90 @@
+package ztn
+
+import "errors"
+
+const (
+	EventTypeNewPeer         = "new_peer"
+	EventTypePeerRemoved     = "peer_removed"
+	EventTypePeerUpdated     = "peer_updated"
+	EventTypeProfileUpdated  = "profile_updated"
+	EventTypeACLUpdated      = "acl_updated"
+	EventTypeForceReconnect  = "force_reconnect"
+	EventTypeNetworkEndpoint = "network_endpoint"
+	// A network endpoint event encrypted to the peer, see SealedNetworkEndpointEvent
+	EventTypeSealedNetworkEndpoint = "sealed_network_endpoint"
+	// The traffic of the bridges this device offers to its peers, sent to the server
+	EventTypeBridgeStats = "bridge_stats"
+)
+
+var errMissingPeerID = errors.New("Missing peer ID in event")
+
+// A new peer was allowed to connect to this device
+type NewPeerEvent struct {
+	ID string `json:"id"`
+}
+
+func (e *NewPeerEvent) Validate() error {
+	if e.ID == "" {
+		return errMissingPeerID
+	}
+	return nil
+}
+
+// A peer was revoked and connections to it must be torn down
+type PeerRemovedEvent struct {
+	ID string `json:"id"`
+}
+
+func (e *PeerRemovedEvent) Validate() error {
+	if e.ID == "" {
+		return errMissingPeerID
+	}
+	return nil
+}
+
+// The profile of a peer has changed (IP address, gateway status, ...)
+type PeerUpdatedEvent struct {
+	ID string `json:"id"`
+}
+
+func (e *PeerUpdatedEvent) Validate() error {
+	if e.ID == "" {
+		return errMissingPeerID
+	}
+	return nil
+}
+
+// The profile of this device has changed and must be fetched again
+type ProfileUpdatedEvent struct {
+}
+
+func (e *ProfileUpdatedEvent) Validate() error {
+	return nil
+}
+
+// The ACLs of this device have changed
+// When the ACLs are part of the event, they can be applied without fetching the profile
+type ACLUpdatedEvent struct {
+	ACLs []string `json:"acls,omitempty"`
+}
+
+func (e *ACLUpdatedEvent) Validate() error {
+	return nil
+}
+
+// The connection to a peer must be reestablished
+// When no ID is provided, all the peers must reconnect
+type ForceReconnectEvent struct {
+	ID string `json:"id,omitempty"`
+}
+
+func (e *ForceReconnectEvent) Validate() error {
+	return nil
+}
+
+// The traffic of the bridges a device offers to its peers
+type BridgeStatsEvent struct {
+	// The public key of the device that bridges
+	ID      string        `json:"id"`
+	Bridges []BridgeStats `json:"bridges"`
+}
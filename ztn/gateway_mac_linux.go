@@ -0,0 +1,40 @@
+// +build linux
+
+package ztn
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// gatewayMAC finds the MAC address of the gateway in the ARP table of the kernel
+func gatewayMAC(gatewayIP net.IP) (net.HardwareAddr, error) {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !net.ParseIP(fields[0]).Equal(gatewayIP) {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		// An incomplete entry has an empty MAC address
+		if mac.String() == "00:00:00:00:00:00" {
+			break
+		}
+		return mac, nil
+	}
+	return nil, errors.New("Unable to find the MAC address of the gateway")
+}
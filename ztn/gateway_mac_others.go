@@ -0,0 +1,13 @@
+// +build !linux
+
+package ztn
+
+import (
+	"errors"
+	"net"
+)
+
+// gatewayMAC isn't implemented outside of Linux, the networks are then identified by their public IP
+func gatewayMAC(gatewayIP net.IP) (net.HardwareAddr, error) {
+	return nil, errors.New("Finding the MAC address of the gateway isn't supported on this platform")
+}
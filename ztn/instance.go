@@ -0,0 +1,124 @@
+package ztn
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+)
+
+// The ports of an instance are offset by its index times this value from the ports of the main instance
+const instancePortStride = 10
+
+var instanceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Instance is one of the ZTN connections of this machine
+// Each instance runs in its own tunnel process with its own configuration, keys, interface and ports
+type Instance struct {
+	// 0 for the main instance which uses the configuration of WG_CONFIG_FILE and of the environment
+	Index int
+	// Empty for the main instance
+	Name       string
+	ConfigFile string
+}
+
+// IsMain returns whether this is the instance defined by the main configuration
+func (i Instance) IsMain() bool {
+	return i.Index == 0
+}
+
+// Port returns the port this instance uses instead of the base port used by the main instance
+func (i Instance) Port(base int) int {
+	return base + i.Index*instancePortStride
+}
+
+// InterfaceName returns the name of the TUN interface of this instance, the main instance uses prefix followed by first
+func (i Instance) InterfaceName(prefix string, first int) string {
+	return prefix + strconv.Itoa(first+i.Index)
+}
+
+// FilePath returns the path of a file of this instance in the home directory of the user
+// The files of the main instance keep the names they had before the instances existed
+func (i Instance) FilePath(name string) string {
+	usr, err := user.Current()
+	sharedutils.CheckError(err)
+	if !i.IsMain() {
+		ext := path.Ext(name)
+		name = strings.TrimSuffix(name, ext) + "-" + i.Name + ext
+	}
+	return path.Join(usr.HomeDir, name)
+}
+
+// Env returns the environment variable that selects this instance in a tunnel process
+func (i Instance) Env() string {
+	return fmt.Sprintf("%s=%d", EnvInstance, i.Index)
+}
+
+func (i Instance) String() string {
+	if i.IsMain() {
+		return "main"
+	}
+	return i.Name
+}
+
+// instanceName returns the name of the instance configured in configFile
+func instanceName(configFile string) string {
+	base := filepath.Base(configFile)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Instances returns the main instance followed by the additional instances of the main configuration
+func Instances() []Instance {
+	instances := []Instance{{Index: 0}}
+	for i, configFile := range mainConfig().Instances {
+		instances = append(instances, Instance{Index: i + 1, Name: instanceName(configFile), ConfigFile: configFile})
+	}
+	return instances
+}
+
+// FindInstance returns the instance with the given name, the main instance is named main
+func FindInstance(name string) (Instance, error) {
+	for _, instance := range Instances() {
+		if instance.String() == name {
+			return instance, nil
+		}
+	}
+	return Instance{}, fmt.Errorf("Unknown instance %s", name)
+}
+
+// CurrentInstance returns the instance of this process which is selected by WG_INSTANCE
+func CurrentInstance() Instance {
+	v := os.Getenv(EnvInstance)
+	if v == "" || v == "0" {
+		return Instance{Index: 0}
+	}
+
+	index, err := strconv.Atoi(v)
+	sharedutils.CheckError(err)
+	instances := Instances()
+	if index < 0 || index >= len(instances) {
+		panic(fmt.Sprintf("Invalid value %s for %s, there are %d instances", v, EnvInstance, len(instances)))
+	}
+	return instances[index]
+}
+
+// AuthFilePath returns the path of the file holding the keys of this device for the current instance
+func AuthFilePath() string {
+	return CurrentInstance().FilePath("auth.json")
+}
+
+// BindScoresPath returns the path of the scores of the bind techniques of the current instance
+func BindScoresPath() string {
+	return CurrentInstance().FilePath("bind_scores.json")
+}
+
+// ProfileCachePath returns the path of the profile cache of the current instance
+func ProfileCachePath() string {
+	return CurrentInstance().FilePath("profile_cache.dat")
+}
@@ -0,0 +1,81 @@
+package ztn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstance(t *testing.T) {
+	main := Instance{Index: 0}
+	customer := Instance{Index: 2, Name: "customer", ConfigFile: "/etc/ztn/customer.yml"}
+
+	if main.Port(6970) != 6970 || customer.Port(6970) != 6990 {
+		t.Error("Unexpected ports", main.Port(6970), customer.Port(6970))
+	}
+	if main.InterfaceName("wg", 0) != "wg0" || customer.InterfaceName("utun", 8) != "utun10" {
+		t.Error("Unexpected interface names", main.InterfaceName("wg", 0), customer.InterfaceName("utun", 8))
+	}
+	if filepath.Base(main.FilePath("auth.json")) != "auth.json" || filepath.Base(customer.FilePath("auth.json")) != "auth-customer.json" {
+		t.Error("Unexpected file paths", main.FilePath("auth.json"), customer.FilePath("auth.json"))
+	}
+	if main.String() != "main" || customer.Env() != EnvInstance+"=2" {
+		t.Error("Unexpected name or environment", main.String(), customer.Env())
+	}
+}
+
+func TestLoadInstanceConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ztn-instances")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	customerFile := filepath.Join(dir, "customer.yml")
+	ioutil.WriteFile(customerFile, []byte("server: customer.example.com\nusername: consultant\n"), 0600)
+	mainFile := filepath.Join(dir, "main.yml")
+	ioutil.WriteFile(mainFile, []byte("server: ztn.example.com\nlog_level: debug\ninstances:\n  - "+customerFile+"\n"), 0600)
+
+	os.Setenv(EnvUsername, "main-user")
+	defer os.Unsetenv(EnvUsername)
+
+	main, err := LoadConfig(mainFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(main.Instances) != 1 || instanceName(main.Instances[0]) != "customer" {
+		t.Fatal("Unexpected instances", main.Instances)
+	}
+
+	c, err := LoadInstanceConfig(main, customerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "customer.example.com" || c.Username != "consultant" {
+		t.Error("The environment of the main instance was applied to the additional instance", c.Server, c.Username)
+	}
+	if c.LogLevel != "debug" || c.Sources["log_level"] != mainFile {
+		t.Error("The global keys weren't taken from the main configuration", c.LogLevel, c.Sources["log_level"])
+	}
+	if c.CLIInteractive || len(c.Instances) != 0 {
+		t.Error("An additional instance must not be interactive nor have instances", c.CLIInteractive, c.Instances)
+	}
+
+	ioutil.WriteFile(customerFile, []byte("server: customer.example.com\nsetup_dns: false\n"), 0600)
+	if _, err := LoadInstanceConfig(main, customerFile); err == nil || !strings.Contains(err.Error(), "setup_dns") {
+		t.Error("A global key set in an additional instance wasn't rejected", err)
+	}
+
+	other := filepath.Join(dir, "other", "customer.yml")
+	ioutil.WriteFile(mainFile, []byte("instances: ["+customerFile+", "+other+"]\n"), 0600)
+	if _, err := LoadConfig(mainFile); err == nil || !strings.Contains(err.Error(), "More than one instance is named customer") {
+		t.Error("Instances with the same name weren't rejected", err)
+	}
+
+	ioutil.WriteFile(mainFile, []byte("instances: [/etc/ztn/main.yml]\n"), 0600)
+	if _, err := LoadConfig(mainFile); err == nil {
+		t.Error("An instance named main wasn't rejected")
+	}
+}
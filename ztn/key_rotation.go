@@ -0,0 +1,264 @@
+package ztn
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"golang.org/x/crypto/curve25519"
+)
+
+// The suffix of the file holding the keys of a rotation until the server accepted them
+const rotatingAuthFileSuffix = ".rotating"
+
+type rotateKeyRequest struct {
+	PublicKey    string `json:"public_key"`
+	Auth         string `json:"auth"`
+	NewPublicKey string `json:"new_public_key"`
+}
+
+// KeyRotator replaces the WireGuard key pair of this device, either periodically or on demand
+// The new public key is registered on the server using a challenge solved with the current key so that only the holder of the current key can replace it
+type KeyRotator struct {
+	sync.Mutex
+	connection        *Connection
+	device            *device.Device
+	networkConnection *NetworkConnection
+	eventSubscription *EventSubscription
+	logger            *device.Logger
+	// The file where the key pair is persisted, its modification time is the time of the last rotation
+	authFile string
+}
+
+func NewKeyRotator(connection *Connection, d *device.Device, networkConnection *NetworkConnection, eventSubscription *EventSubscription, logger *device.Logger, authFile string) *KeyRotator {
+	return &KeyRotator{
+		connection:        connection,
+		device:            d,
+		networkConnection: networkConnection,
+		eventSubscription: eventSubscription,
+		logger:            logger.AddPrepend("(KEYS) "),
+		authFile:          authFile,
+	}
+}
+
+// Start rotates the keys when they are older than the key_rotation_interval of the configuration
+// It returns immediately when the keys are only rotated on demand
+func (kr *KeyRotator) Start() {
+	interval := GetConfig().KeyRotationInterval
+	if interval == 0 {
+		kr.logger.Debug.Println("Keys are only rotated on demand")
+		return
+	}
+
+	for {
+		wait := interval
+		if stat, err := os.Stat(kr.authFile); err == nil {
+			wait = time.Until(stat.ModTime().Add(interval))
+		}
+
+		if wait > 0 {
+			kr.logger.Info.Println("Next key rotation in", wait.Round(time.Second))
+			time.Sleep(wait)
+		}
+
+		if _, err := kr.Rotate(); err == ErrUnsupportedEndpoint {
+			kr.logger.Error.Println("The server doesn't support the key rotation, the keys won't be rotated")
+			return
+		} else if err != nil {
+			kr.logger.Error.Println("Unable to rotate the keys, will retry in 1 minute:", err)
+			time.Sleep(1 * time.Minute)
+		}
+	}
+}
+
+// Rotate generates a new key pair, registers it on the server and applies it to the running tunnel
+// The new keys are saved in a pending file before being registered and it only replaces the auth file once the server accepted them
+// A rotation that failed is retried with the keys of the pending file since the server may have registered them
+// The peers are reconnected using the new key without restarting the process
+// ErrUnsupportedEndpoint is returned when the server doesn't implement the rotation
+func (kr *KeyRotator) Rotate() (string, error) {
+	kr.Lock()
+	defer kr.Unlock()
+
+	var current Profile
+	kr.connection.Update(func() {
+		current = *kr.connection.Profile
+	})
+
+	rotated := current
+	pendingFile := kr.authFile + rotatingAuthFileSuffix
+	if privateKey, publicKey, err := readAuthFileKeys(pendingFile); err == nil {
+		kr.logger.Info.Println("Resuming the rotation to the public key", publicKey)
+		rotated.PrivateKey = privateKey
+		rotated.PublicKey = publicKey
+	} else {
+		priv, pub, err := generateKeyPair()
+		if err != nil {
+			return "", err
+		}
+		rotated.PrivateKey = base64.StdEncoding.EncodeToString(priv[:])
+		rotated.PublicKey = base64.StdEncoding.EncodeToString(pub[:])
+		if err := writeAuthFileFrom(pendingFile, kr.authFile, rotated.PrivateKey, rotated.PublicKey); err != nil {
+			return "", fmt.Errorf("Unable to save the new keys in %s: %s", pendingFile, err)
+		}
+	}
+
+	kr.logger.Info.Println("Registering the new public key", rotated.PublicKey)
+	if err := RegisterRotatedKey(&current, rotated.PublicKey); err == ErrUnsupportedEndpoint {
+		// The server can't have registered the keys
+		os.Remove(pendingFile)
+		return "", err
+	} else if err != nil {
+		// The server may have registered the key even though its reply was lost
+		if !keyAccepted(rotated, kr.logger) {
+			return "", fmt.Errorf("Unable to register the new public key: %s", err)
+		}
+		kr.logger.Info.Println("The new public key was already registered")
+	}
+
+	// The server only accepts the new key from now on so it must be used even if the auth file can't be replaced
+	if err := os.Rename(pendingFile, kr.authFile); err != nil {
+		kr.logger.Error.Println("Unable to replace", kr.authFile, "by", pendingFile, "the new keys will be recovered from it on the next start:", err)
+	}
+
+	kr.apply(rotated)
+	return rotated.PublicKey, nil
+}
+
+// RecoverKeyRotation replaces the auth file by the pending file of a rotation that was interrupted after the server accepted the new keys
+// The pending file is kept when the server doesn't know its keys so that the next rotation registers them
+func RecoverKeyRotation(authFile string, logger *device.Logger) error {
+	pendingFile := authFile + rotatingAuthFileSuffix
+	privateKey, publicKey, err := readAuthFileKeys(pendingFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	pending := Profile{PrivateKey: privateKey}
+	pending.PublicKey = publicKey
+	if !keyAccepted(pending, logger) {
+		logger.Info.Println("The keys of the interrupted rotation in", pendingFile, "aren't registered, they will be registered on the next rotation")
+		return nil
+	}
+
+	logger.Info.Println("Completing the interrupted rotation to the public key", publicKey)
+	return os.Rename(pendingFile, authFile)
+}
+
+// keyAccepted returns whether the server gives the profile of the device to the keys of the profile
+func keyAccepted(profile Profile, logger *device.Logger) bool {
+	return profile.FillProfileFromServer(nil, logger) == nil
+}
+
+func (kr *KeyRotator) apply(rotated Profile) {
+	SetConfig(kr.device, "private_key", keyToHex(rotated.PrivateKey))
+
+	peerIDs := []string{}
+	kr.connection.Update(func() {
+		kr.connection.Profile = &rotated
+		for peerID := range kr.connection.Peers {
+			peerIDs = append(peerIDs, peerID)
+		}
+	})
+
+	if cache := kr.connection.ProfileCache; cache != nil {
+		cache.SetPrivateKey(rotated.PrivateKey)
+		if err := cache.SetProfile(rotated); err != nil {
+			kr.logger.Error.Println("Unable to save the profile cache:", err)
+		}
+	}
+
+	if kr.eventSubscription != nil {
+		kr.eventSubscription.SetProfile(rotated)
+	}
+
+	// The connections with the peers were negotiated using the previous key
+	for _, peerID := range peerIDs {
+		kr.logger.Info.Println("Reconnecting to", peerID, "using the new key")
+		kr.connection.RestartPeer(kr.device, rotated, peerID, kr.networkConnection)
+	}
+}
+
+// RegisterRotatedKey replaces the public key of the profile on the server by newPublicKey
+// The profile must still hold the current keys as they are used to solve the challenge
+// ErrUnsupportedEndpoint is returned when the server doesn't implement the rotation
+func RegisterRotatedKey(profile *Profile, newPublicKey string) error {
+	auth, err := DoServerChallenge(profile)
+	if err != nil {
+		return err
+	}
+
+	return callOptionalEndpoint(
+		"/api/v1/remote_clients/rotate_key",
+		rotateKeyRequest{
+			PublicKey:    b64keyToURLb64(profile.PublicKey),
+			Auth:         auth,
+			NewPublicKey: b64keyToURLb64(newPublicKey),
+		},
+	)
+}
+
+func generateKeyPair() (priv [32]byte, pub [32]byte, err error) {
+	if _, err = rand.Read(priv[:]); err != nil {
+		return priv, pub, err
+	}
+	// Clamp the private key as required by curve25519
+	priv[0] &= 248
+	priv[31] = (priv[31] & 127) | 64
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return priv, pub, nil
+}
+
+// writeAuthFile replaces the keys in the auth file while keeping the other values it holds
+func writeAuthFile(path, privateKey, publicKey string) error {
+	return writeAuthFileFrom(path, path, privateKey, publicKey)
+}
+
+// writeAuthFileFrom writes the keys in path along with the other values held by the auth file from
+func writeAuthFileFrom(path, from, privateKey, publicKey string) error {
+	auth := map[string]interface{}{}
+	if data, err := ioutil.ReadFile(from); err == nil {
+		if err := json.Unmarshal(data, &auth); err != nil {
+			return fmt.Errorf("Unable to decode %s: %s", from, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	auth["private_key"] = privateKey
+	auth["public_key"] = publicKey
+
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// readAuthFileKeys returns the keys held by an auth file
+func readAuthFileKeys(path string) (privateKey string, publicKey string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	auth := struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	}{}
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return "", "", fmt.Errorf("Unable to decode %s: %s", path, err)
+	}
+	if auth.PrivateKey == "" || auth.PublicKey == "" {
+		return "", "", fmt.Errorf("%s doesn't hold the keys", path)
+	}
+	return auth.PrivateKey, auth.PublicKey, nil
+}
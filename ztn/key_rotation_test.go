@@ -0,0 +1,187 @@
+package ztn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/inverse-inc/wireguard-go/device"
+	"github.com/inverse-inc/wireguard-go/tun/tuntest"
+)
+
+func TestKeyRotation(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	profile, oldID := newTestProfile(srv, "100.64.0.1", "agent1")
+	peer, _ := newTestProfile(srv, "100.64.0.2", "agent2")
+	srv.SetProfile(remoteclients.Peer{
+		PublicKey:        peer.PublicKey,
+		WireguardIP:      net.ParseIP("100.64.0.2"),
+		WireguardNetmask: 24,
+		Hostname:         "agent2",
+		AllowedPeers:     []string{oldID},
+	})
+
+	dir, err := ioutil.TempDir("", "ztn-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "auth.json")
+	ioutil.WriteFile(authFile, []byte(`{"private_key":"`+profile.PrivateKey+`","public_key":"`+profile.PublicKey+`","server":"kept"}`), 0600)
+
+	tun := tuntest.NewChannelTUN()
+	d := device.NewDevice(tun.TUN(), logger)
+	defer d.Close()
+	SetConfig(d, "private_key", keyToHex(profile.PrivateKey))
+
+	connection := NewConnection(logger)
+	connection.Profile = &profile
+	connection.ProfileCache = NewProfileCache(filepath.Join(dir, "profile_cache.dat"), profile.PrivateKey)
+
+	kr := NewKeyRotator(connection, d, nil, nil, logger, authFile)
+	newPublicKey, err := kr.Rotate()
+	if err != nil {
+		t.Fatal("Unable to rotate the keys", err)
+	}
+	if newPublicKey == profile.PublicKey || connection.Profile.PublicKey != newPublicKey {
+		t.Fatal("The profile of the connection doesn't use the new key", newPublicKey, connection.Profile.PublicKey)
+	}
+
+	auth := map[string]string{}
+	data, _ := ioutil.ReadFile(authFile)
+	if err := json.Unmarshal(data, &auth); err != nil {
+		t.Fatal("Unable to decode the auth file", err)
+	}
+	if auth["public_key"] != newPublicKey || auth["private_key"] != connection.Profile.PrivateKey || auth["server"] != "kept" {
+		t.Error("Unexpected auth file after the rotation", auth)
+	}
+
+	var uapi bytes.Buffer
+	w := bufio.NewWriter(&uapi)
+	d.IpcGetOperation(w)
+	w.Flush()
+	if !strings.Contains(uapi.String(), "private_key="+keyToHex(connection.Profile.PrivateKey)) {
+		t.Error("The device doesn't use the new private key")
+	}
+
+	rotated := *connection.Profile
+	if err := rotated.FillProfileFromServer(connection, logger); err != nil {
+		t.Error("The new key isn't accepted by the server", err)
+	}
+	if err := profile.FillProfileFromServer(nil, logger); err == nil {
+		t.Error("The previous key is still accepted by the server")
+	}
+
+	cache := NewProfileCache(filepath.Join(dir, "profile_cache.dat"), rotated.PrivateKey)
+	if err := cache.Load(DefaultProfileCacheMaxAge); err != nil {
+		t.Error("The profile cache wasn't written with the new key", err)
+	}
+
+	if err := peer.FillProfileFromServer(nil, logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(peer.AllowedPeers) != 1 || peer.AllowedPeers[0] != b64keyToURLb64(newPublicKey) {
+		t.Error("The peer isn't allowed to connect to the new key", peer.AllowedPeers)
+	}
+}
+
+func TestRecoverKeyRotation(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+
+	profile, _ := newTestProfile(srv, "100.64.0.1", "agent1")
+
+	dir, err := ioutil.TempDir("", "ztn-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "auth.json")
+	pendingFile := authFile + rotatingAuthFileSuffix
+	writeAuthFile(authFile, profile.PrivateKey, profile.PublicKey)
+
+	priv, pub, _ := generateKeyPair()
+	newPrivateKey := base64.StdEncoding.EncodeToString(priv[:])
+	newPublicKey := base64.StdEncoding.EncodeToString(pub[:])
+	if err := writeAuthFileFrom(pendingFile, authFile, newPrivateKey, newPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server doesn't know the new keys yet, they are kept for the next rotation
+	if err := RecoverKeyRotation(authFile, logger); err != nil {
+		t.Fatal(err)
+	}
+	if _, publicKey, _ := readAuthFileKeys(authFile); publicKey != profile.PublicKey {
+		t.Error("The auth file was replaced by keys unknown to the server")
+	}
+	if _, err := os.Stat(pendingFile); err != nil {
+		t.Error("The pending keys were removed", err)
+	}
+
+	// The rotation was interrupted after the server accepted the new keys
+	if err := RegisterRotatedKey(&profile, newPublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverKeyRotation(authFile, logger); err != nil {
+		t.Fatal(err)
+	}
+	if privateKey, publicKey, _ := readAuthFileKeys(authFile); privateKey != newPrivateKey || publicKey != newPublicKey {
+		t.Error("The auth file doesn't hold the registered keys")
+	}
+	if _, err := os.Stat(pendingFile); !os.IsNotExist(err) {
+		t.Error("The pending keys weren't committed", err)
+	}
+}
+
+func TestKeyRotationUnsupported(t *testing.T) {
+	srv, teardown := setupFakeServer()
+	defer teardown()
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	srv.RemoveEndpoint("/api/v1/remote_clients/rotate_key")
+
+	profile, _ := newTestProfile(srv, "100.64.0.1", "agent1")
+
+	dir, err := ioutil.TempDir("", "ztn-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "auth.json")
+	writeAuthFile(authFile, profile.PrivateKey, profile.PublicKey)
+
+	tun := tuntest.NewChannelTUN()
+	d := device.NewDevice(tun.TUN(), logger)
+	defer d.Close()
+
+	connection := NewConnection(logger)
+	connection.Profile = &profile
+
+	kr := NewKeyRotator(connection, d, nil, nil, logger, authFile)
+	if _, err := kr.Rotate(); err != ErrUnsupportedEndpoint {
+		t.Fatal("The server that doesn't implement the rotation wasn't detected", err)
+	}
+	if connection.Profile.PublicKey != profile.PublicKey {
+		t.Error("The keys were replaced while the server doesn't support the rotation")
+	}
+	if _, publicKey, _ := readAuthFileKeys(authFile); publicKey != profile.PublicKey {
+		t.Error("The auth file was replaced while the server doesn't support the rotation")
+	}
+	if _, err := os.Stat(authFile + rotatingAuthFileSuffix); !os.IsNotExist(err) {
+		t.Error("The keys the server can't have registered were kept", err)
+	}
+	if err := profile.FillProfileFromServer(nil, logger); err != nil {
+		t.Error("The current keys aren't accepted anymore", err)
+	}
+}
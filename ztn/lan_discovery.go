@@ -0,0 +1,271 @@
+package ztn
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"github.com/inverse-inc/wireguard-go/dns/plugin/pkg/reuseport"
+	"golang.org/x/crypto/curve25519"
+)
+
+// The port of the LAN discovery beacons, the same for all the instances so the devices hear each other whatever their instances are
+// The beacons hold the keys of both peers, which tells the instances apart
+const lanDiscoveryPort = 12677
+
+// How often the beacons are broadcasted to the peers that aren't connected and how old a beacon can be when it is received
+var lanBeaconInterval = 5 * time.Second
+var lanBeaconMaxAge = 1 * time.Minute
+
+var lanBeaconMagic = []byte("ZTNBEACN")
+
+const lanBeaconMACLength = sha256.Size
+const lanBeaconLength = 8 + 32 + 32 + 8 + 4 + 2 + lanBeaconMACLength
+
+var errInvalidLANBeacon = errors.New("invalid LAN beacon")
+
+// lanBeacon announces the private WireGuard endpoint of a device to one of its peers
+// The IP is the one the beacon is sent from, a beacon received from another address is refused
+type lanBeacon struct {
+	// The static public keys of the sender and of the peer it is looking for
+	sender   [32]byte
+	receiver [32]byte
+	// Increases with each beacon, the beacons that aren't newer than the last one of the peer are refused
+	sentOn time.Time
+	ip     net.IP
+	port   uint16
+}
+
+// lanBeaconKey derives the key authenticating the beacons exchanged by two devices from their static keys, only they can compute it
+func lanBeaconKey(privateKey, peerPublicKey string) ([]byte, error) {
+	priv, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := base64.StdEncoding.DecodeString(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append(append([]byte{}, lanBeaconMagic...), shared...))
+	return key[:], nil
+}
+
+// marshal encodes the beacon followed by its HMAC computed with key
+func (b lanBeacon) marshal(key []byte) []byte {
+	pkt := make([]byte, 0, lanBeaconLength)
+	pkt = append(pkt, lanBeaconMagic...)
+	pkt = append(pkt, b.sender[:]...)
+	pkt = append(pkt, b.receiver[:]...)
+	pkt = append(pkt, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(pkt[8+32+32:], uint64(b.sentOn.UnixNano()))
+	pkt = append(pkt, b.ip.To4()...)
+	pkt = append(pkt, make([]byte, 2)...)
+	binary.BigEndian.PutUint16(pkt[8+32+32+8+4:], b.port)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(pkt)
+	return mac.Sum(pkt)
+}
+
+func isLANBeacon(pkt []byte) bool {
+	return len(pkt) == lanBeaconLength && bytes.Equal(pkt[:len(lanBeaconMagic)], lanBeaconMagic)
+}
+
+// parseLANBeacon decodes a beacon without authenticating it, see verifyLANBeacon
+func parseLANBeacon(pkt []byte) (lanBeacon, error) {
+	b := lanBeacon{}
+	if !isLANBeacon(pkt) {
+		return b, errInvalidLANBeacon
+	}
+	copy(b.sender[:], pkt[8:8+32])
+	copy(b.receiver[:], pkt[8+32:8+32+32])
+	b.sentOn = time.Unix(0, int64(binary.BigEndian.Uint64(pkt[8+32+32:])))
+	b.ip = net.IP(append([]byte{}, pkt[8+32+32+8:8+32+32+8+4]...))
+	b.port = binary.BigEndian.Uint16(pkt[8+32+32+8+4:])
+	return b, nil
+}
+
+// verifyLANBeacon checks the HMAC of a beacon received from the IP from and that it isn't a replay
+// A beacon is a replay when it is too old or when it isn't newer than previous, the last beacon accepted from the peer
+func verifyLANBeacon(pkt []byte, key []byte, from net.IP, previous time.Time, now time.Time) error {
+	b, err := parseLANBeacon(pkt)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(pkt[:lanBeaconLength-lanBeaconMACLength])
+	if !hmac.Equal(mac.Sum(nil), pkt[lanBeaconLength-lanBeaconMACLength:]) {
+		return errors.New("the LAN beacon isn't authenticated by the key of the peer")
+	}
+	if !b.ip.Equal(from) {
+		return fmt.Errorf("the LAN beacon for %s was sent from %s", b.ip, from)
+	}
+	if age := now.Sub(b.sentOn); age > lanBeaconMaxAge || age < -lanBeaconMaxAge {
+		return errors.New("the LAN beacon is too old")
+	}
+	if !b.sentOn.After(previous) {
+		return errors.New("the LAN beacon isn't newer than the last one of the peer")
+	}
+	return nil
+}
+
+// LANDiscovery finds the peers on the local networks using broadcasted beacons so they can connect without the server
+type LANDiscovery struct {
+	connection *Connection
+	logger     *device.Logger
+	conn       *net.UDPConn
+	// The time the last beacon accepted from each peer was sent, only used by listen
+	lastBeacons map[string]time.Time
+}
+
+func NewLANDiscovery(connection *Connection, logger *device.Logger) *LANDiscovery {
+	return &LANDiscovery{
+		connection:  connection,
+		logger:      logger.AddPrepend("(LAN discovery) "),
+		lastBeacons: map[string]time.Time{},
+	}
+}
+
+// Start listens for the beacons of the peers and broadcasts the ones of this device
+func (ld *LANDiscovery) Start() error {
+	// The instances of this machine share the port, they all receive the broadcasted beacons
+	conn, err := reuseport.ListenPacket("udp4", fmt.Sprintf(":%d", lanDiscoveryPort))
+	if err != nil {
+		return err
+	}
+	ld.conn = conn.(*net.UDPConn)
+	ld.logger.Info.Println("Listening for the beacons of the peers on", ld.conn.LocalAddr())
+	go ld.listen()
+	go ld.announce()
+	return nil
+}
+
+func (ld *LANDiscovery) listen() {
+	buf := make([]byte, 1500)
+	for {
+		n, raddr, err := ld.conn.ReadFromUDP(buf)
+		if err != nil {
+			ld.logger.Error.Println("Stopped receiving the beacons:", err)
+			return
+		}
+		ld.handleBeacon(raddr, buf[:n])
+	}
+}
+
+// handleBeacon gives the private endpoint of a peer to its connection once the beacon is authenticated
+func (ld *LANDiscovery) handleBeacon(raddr *net.UDPAddr, pkt []byte) {
+	b, err := parseLANBeacon(pkt)
+	if err != nil {
+		return
+	}
+
+	// The peers are indexed by the URL safe encoding of their key
+	peerID := base64.URLEncoding.EncodeToString(b.sender[:])
+	ld.connection.Lock()
+	pc := ld.connection.Peers[peerID]
+	ld.connection.Unlock()
+	// The beacons sent by this device and the ones for other devices are received as well
+	if pc == nil || base64.StdEncoding.EncodeToString(b.receiver[:]) != pc.MyProfile.PublicKey {
+		return
+	}
+
+	key, err := lanBeaconKey(pc.MyProfile.PrivateKey, pc.PeerProfile.PublicKey)
+	if err != nil {
+		ld.logger.Error.Println("Unable to derive the beacon key of", peerID, ":", err)
+		return
+	}
+	if err := verifyLANBeacon(pkt, key, raddr.IP, ld.lastBeacons[peerID], time.Now()); err != nil {
+		ld.logger.Info.Println("Ignoring beacon from", raddr, ":", err)
+		return
+	}
+	ld.lastBeacons[peerID] = b.sentOn
+
+	pc.HandleLANEndpoint(&net.UDPAddr{IP: b.ip, Port: int(b.port)})
+}
+
+func (ld *LANDiscovery) announce() {
+	for range time.Tick(lanBeaconInterval) {
+		ld.connection.Lock()
+		peers := []*PeerConnection{}
+		for _, pc := range ld.connection.Peers {
+			if !pc.Connected() {
+				peers = append(peers, pc)
+			}
+		}
+		ld.connection.Unlock()
+
+		if len(peers) == 0 {
+			continue
+		}
+		networks := lanNetworks(peers[0].tunnelNetwork())
+		for _, pc := range peers {
+			// Each network gets a beacon holding the IP of this device on it
+			for _, network := range networks {
+				pkt, err := ld.beacon(pc, network.ip)
+				if err != nil {
+					ld.logger.Error.Println("Unable to build the beacon for", pc.peerID, ":", err)
+					break
+				}
+				if err := udpSend(pkt, ld.conn, network.broadcast); err != nil {
+					ld.logger.Debug.Println("Unable to broadcast the beacon on", network.broadcast, ":", err)
+				}
+			}
+		}
+	}
+}
+
+func (ld *LANDiscovery) beacon(pc *PeerConnection, ip net.IP) ([]byte, error) {
+	key, err := lanBeaconKey(pc.MyProfile.PrivateKey, pc.PeerProfile.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	b := lanBeacon{sentOn: time.Now(), ip: ip, port: uint16(localWGPort())}
+	sender, err := base64.StdEncoding.DecodeString(pc.MyProfile.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := base64.StdEncoding.DecodeString(pc.PeerProfile.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	copy(b.sender[:], sender)
+	copy(b.receiver[:], receiver)
+	return b.marshal(key), nil
+}
+
+// lanNetwork is a local network the beacons are broadcasted on along with the IP of this device on it
+type lanNetwork struct {
+	ip        net.IP
+	broadcast *net.UDPAddr
+}
+
+// lanNetworks returns the local networks with a broadcast address, the network of the tunnel is left out
+func lanNetworks(tunnel *net.IPNet) []lanNetwork {
+	networks := []lanNetwork{}
+	for _, a := range privateAddresses(tunnel) {
+		ip, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			continue
+		}
+		// The point-to-point links have no broadcast address
+		if ones, _ := ipnet.Mask.Size(); ones >= 31 {
+			continue
+		}
+		broadcast := make(net.IP, net.IPv4len)
+		for i := range broadcast {
+			broadcast[i] = ip.To4()[i] | ^ipnet.Mask[i]
+		}
+		networks = append(networks, lanNetwork{ip: ip.To4(), broadcast: &net.UDPAddr{IP: broadcast, Port: lanDiscoveryPort}})
+	}
+	return networks
+}
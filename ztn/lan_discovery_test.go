@@ -0,0 +1,88 @@
+package ztn
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+func testKeyPair(t *testing.T) (string, string) {
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(priv); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(priv), base64.StdEncoding.EncodeToString(pub)
+}
+
+func TestLANBeacon(t *testing.T) {
+	alicePriv, alicePub := testKeyPair(t)
+	bobPriv, bobPub := testKeyPair(t)
+	_, evePub := testKeyPair(t)
+
+	aliceKey, err := lanBeaconKey(alicePriv, bobPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := lanBeaconKey(bobPriv, alicePub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	from := net.IPv4(192, 168, 1, 10)
+	b := lanBeacon{sentOn: now, ip: from, port: 12674}
+	sender, _ := base64.StdEncoding.DecodeString(alicePub)
+	copy(b.sender[:], sender)
+	pkt := b.marshal(aliceKey)
+
+	if err := verifyLANBeacon(pkt, bobKey, from, time.Time{}, now.Add(time.Second)); err != nil {
+		t.Error("The beacon of the peer wasn't accepted:", err)
+	}
+	if parsed, _ := parseLANBeacon(pkt); parsed.port != 12674 || !parsed.ip.Equal(from) || parsed.sender != b.sender {
+		t.Error("Unexpected parsed beacon", parsed)
+	}
+
+	if err := verifyLANBeacon(pkt, bobKey, from, time.Time{}, now.Add(lanBeaconMaxAge+time.Second)); err == nil {
+		t.Error("A replayed beacon was accepted")
+	}
+
+	// A beacon that is within the maximum age but isn't newer than the last one of the peer is a replay
+	if err := verifyLANBeacon(pkt, bobKey, from, now, now.Add(time.Second)); err == nil {
+		t.Error("A beacon that isn't newer than the previous one was accepted")
+	}
+	if err := verifyLANBeacon(pkt, bobKey, from, now.Add(-time.Second), now.Add(time.Second)); err != nil {
+		t.Error("A beacon newer than the previous one wasn't accepted:", err)
+	}
+
+	// A beacon replayed from another address must not redirect the peer to it
+	if err := verifyLANBeacon(pkt, bobKey, net.IPv4(192, 168, 1, 66), time.Time{}, now); err == nil {
+		t.Error("A beacon received from another address was accepted")
+	}
+
+	// A device that isn't the peer can't compute the key
+	eveKey, _ := lanBeaconKey(bobPriv, evePub)
+	if err := verifyLANBeacon(pkt, eveKey, from, time.Time{}, now); err == nil {
+		t.Error("A beacon was accepted with the key of another peer")
+	}
+
+	tampered := append([]byte{}, pkt...)
+	tampered[len(tampered)-lanBeaconMACLength-1]++
+	if err := verifyLANBeacon(tampered, bobKey, from, time.Time{}, now); err == nil {
+		t.Error("A beacon with a modified port was accepted")
+	}
+
+	// Changing the advertised IP along with the source address doesn't pass the HMAC
+	tampered = append([]byte{}, pkt...)
+	tampered[len(tampered)-lanBeaconMACLength-3]++
+	if err := verifyLANBeacon(tampered, bobKey, net.IPv4(192, 168, 1, 11), time.Time{}, now); err == nil {
+		t.Error("A beacon with a modified IP was accepted")
+	}
+}
@@ -0,0 +1,227 @@
+package ztn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gortc.io/stun"
+)
+
+// NATMapping is how the NAT reuses the public address of an internal address as defined by RFC 4787 and discovered as in RFC 5780
+type NATMapping string
+
+// NATFiltering is which external endpoints can send packets to a public address of the NAT
+type NATFiltering string
+
+// The empty values mean the behavior couldn't be discovered
+const (
+	NATMappingUnknown                 = NATMapping("")
+	NATMappingNone                    = NATMapping("none")
+	NATMappingEndpointIndependent     = NATMapping("endpoint-independent")
+	NATMappingAddressDependent        = NATMapping("address-dependent")
+	NATMappingAddressAndPortDependent = NATMapping("address-and-port-dependent")
+
+	NATFilteringUnknown                 = NATFiltering("")
+	NATFilteringEndpointIndependent     = NATFiltering("endpoint-independent")
+	NATFilteringAddressDependent        = NATFiltering("address-dependent")
+	NATFilteringAddressAndPortDependent = NATFiltering("address-and-port-dependent")
+)
+
+// NATBehavior is the classification of the NAT in front of this host
+type NATBehavior struct {
+	Mapping   NATMapping
+	Filtering NATFiltering
+}
+
+// Known returns whether both the mapping and the filtering were discovered
+func (b NATBehavior) Known() bool {
+	return b.Mapping != NATMappingUnknown && b.Filtering != NATFilteringUnknown
+}
+
+func (b NATBehavior) String() string {
+	str := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	return fmt.Sprintf("mapping:%s filtering:%s", str(string(b.Mapping)), str(string(b.Filtering)))
+}
+
+// The flags of the CHANGE-REQUEST attribute
+const (
+	stunChangeIP   = byte(0x04)
+	stunChangePort = byte(0x02)
+)
+
+var natDiscoveryTimeout = 2 * time.Second
+
+var errNoSTUNResponse = errors.New("no response from the STUN server")
+
+type changeRequest byte
+
+func (c changeRequest) AddTo(m *stun.Message) error {
+	m.Add(stun.AttrChangeRequest, []byte{0, 0, 0, byte(c)})
+	return nil
+}
+
+type natDiscoveryResponse struct {
+	from   *net.UDPAddr
+	mapped *net.UDPAddr
+	// The second address and port of the server, nil when it doesn't have one
+	other *net.UDPAddr
+}
+
+// DiscoverNATBehavior classifies the NAT between this host and server using the tests of RFC 5780
+// The mapping is only known when the server has a second address and port advertised in OTHER-ADDRESS, as is the filtering
+func DiscoverNATBehavior(server string) (NATBehavior, error) {
+	behavior := NATBehavior{}
+
+	serverAddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return behavior, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return behavior, err
+	}
+	defer conn.Close()
+
+	localIP, err := localIPTowards(serverAddr)
+	if err != nil {
+		return behavior, err
+	}
+	local := &net.UDPAddr{IP: localIP, Port: conn.LocalAddr().(*net.UDPAddr).Port}
+
+	test1, err := natDiscoveryRequest(conn, serverAddr, 0)
+	if err != nil {
+		return behavior, err
+	}
+
+	var test2, test3 *natDiscoveryResponse
+	if !sameUDPAddr(test1.mapped, local) && test1.other != nil {
+		test2, _ = natDiscoveryRequest(conn, &net.UDPAddr{IP: test1.other.IP, Port: serverAddr.Port}, 0)
+		if test2 != nil && !sameUDPAddr(test2.mapped, test1.mapped) {
+			test3, _ = natDiscoveryRequest(conn, test1.other, 0)
+		}
+	}
+	behavior.Mapping = classifyNATMapping(local, test1, test2, test3)
+
+	if test1.other != nil {
+		// A server that ignores CHANGE-REQUEST answers from its primary address which must not be taken as a success
+		changed := func(flags byte) bool {
+			res, err := natDiscoveryRequest(conn, serverAddr, flags)
+			return err == nil && !sameUDPAddr(res.from, serverAddr)
+		}
+		behavior.Filtering = classifyNATFiltering(changed(stunChangeIP|stunChangePort), func() bool { return changed(stunChangePort) })
+	}
+
+	return behavior, nil
+}
+
+// classifyNATMapping compares the mapped addresses obtained from the primary address of the server (test1), its second address with the primary port (test2) and its second address and port (test3)
+func classifyNATMapping(local *net.UDPAddr, test1, test2, test3 *natDiscoveryResponse) NATMapping {
+	switch {
+	case sameUDPAddr(test1.mapped, local):
+		return NATMappingNone
+	case test2 == nil:
+		return NATMappingUnknown
+	case sameUDPAddr(test2.mapped, test1.mapped):
+		return NATMappingEndpointIndependent
+	case test3 == nil:
+		return NATMappingUnknown
+	case sameUDPAddr(test3.mapped, test2.mapped):
+		return NATMappingAddressDependent
+	default:
+		return NATMappingAddressAndPortDependent
+	}
+}
+
+// classifyNATFiltering uses whether a response was received from the second address and port of the server and, only when it wasn't, from its primary address and second port
+func classifyNATFiltering(fromOtherAddressAndPort bool, fromOtherPort func() bool) NATFiltering {
+	if fromOtherAddressAndPort {
+		return NATFilteringEndpointIndependent
+	} else if fromOtherPort() {
+		return NATFilteringAddressDependent
+	} else {
+		return NATFilteringAddressAndPortDependent
+	}
+}
+
+func natDiscoveryRequest(conn *net.UDPConn, server *net.UDPAddr, changeFlags byte) (*natDiscoveryResponse, error) {
+	setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+	if changeFlags != 0 {
+		setters = append(setters, changeRequest(changeFlags))
+	}
+	req, err := stun.Build(setters...)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := defaultBufferPool.Get()
+	defer defaultBufferPool.Put(buf)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := udpSend(req.Raw, conn, server); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(natDiscoveryTimeout))
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				break
+			}
+			res := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+			if res.Decode() != nil || res.TransactionID != req.TransactionID {
+				continue
+			}
+			return parseNATDiscoveryResponse(from, res)
+		}
+	}
+	return nil, errNoSTUNResponse
+}
+
+func parseNATDiscoveryResponse(from *net.UDPAddr, m *stun.Message) (*natDiscoveryResponse, error) {
+	var xorAddr stun.XORMappedAddress
+	if err := xorAddr.GetFrom(m); err != nil {
+		return nil, err
+	}
+	res := &natDiscoveryResponse{from: from, mapped: &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}}
+	if v, err := m.Get(stun.AttrOtherAddress); err == nil {
+		res.other, _ = parseSTUNAddress(v)
+	}
+	return res, nil
+}
+
+// parseSTUNAddress decodes an attribute that has the format of MAPPED-ADDRESS
+func parseSTUNAddress(v []byte) (*net.UDPAddr, error) {
+	if len(v) < 4 {
+		return nil, errors.New("STUN address is too short")
+	}
+	port := int(binary.BigEndian.Uint16(v[2:4]))
+	switch {
+	case v[1] == 0x01 && len(v) >= 4+net.IPv4len:
+		return &net.UDPAddr{IP: net.IP(append([]byte{}, v[4:4+net.IPv4len]...)), Port: port}, nil
+	case v[1] == 0x02 && len(v) >= 4+net.IPv6len:
+		return &net.UDPAddr{IP: net.IP(append([]byte{}, v[4:4+net.IPv6len]...)), Port: port}, nil
+	}
+	return nil, fmt.Errorf("unknown STUN address family %d", v[1])
+}
+
+// localIPTowards returns the local IP the routes select to reach addr, no packet is sent
+func localIPTowards(addr *net.UDPAddr) (net.IP, error) {
+	conn, err := net.DialUDP(udp, nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a != nil && b != nil && a.IP.Equal(b.IP) && a.Port == b.Port
+}
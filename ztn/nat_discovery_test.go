@@ -0,0 +1,109 @@
+package ztn
+
+import (
+	"net"
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestClassifyNATMapping(t *testing.T) {
+	local := &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 40000}
+	res := func(ip string, port int) *natDiscoveryResponse {
+		return &natDiscoveryResponse{mapped: &net.UDPAddr{IP: net.ParseIP(ip), Port: port}}
+	}
+
+	tests := []struct {
+		test1, test2, test3 *natDiscoveryResponse
+		expected            NATMapping
+	}{
+		{res("192.168.1.10", 40000), nil, nil, NATMappingNone},
+		{res("203.0.113.1", 50000), nil, nil, NATMappingUnknown},
+		{res("203.0.113.1", 50000), res("203.0.113.1", 50000), nil, NATMappingEndpointIndependent},
+		{res("203.0.113.1", 50000), res("203.0.113.1", 50001), res("203.0.113.1", 50001), NATMappingAddressDependent},
+		{res("203.0.113.1", 50000), res("203.0.113.1", 50001), res("203.0.113.1", 50002), NATMappingAddressAndPortDependent},
+	}
+	for i, test := range tests {
+		if mapping := classifyNATMapping(local, test.test1, test.test2, test.test3); mapping != test.expected {
+			t.Errorf("Test %d: got mapping %q instead of %q", i, mapping, test.expected)
+		}
+	}
+
+	if f := classifyNATFiltering(true, func() bool { t.Error("The second filtering test was run"); return false }); f != NATFilteringEndpointIndependent {
+		t.Error("Unexpected filtering", f)
+	}
+	if f := classifyNATFiltering(false, func() bool { return true }); f != NATFilteringAddressDependent {
+		t.Error("Unexpected filtering", f)
+	}
+	if f := classifyNATFiltering(false, func() bool { return false }); f != NATFilteringAddressAndPortDependent {
+		t.Error("Unexpected filtering", f)
+	}
+}
+
+func TestParseSTUNAddress(t *testing.T) {
+	addr, err := parseSTUNAddress([]byte{0, 1, 0x0d, 0x96, 192, 0, 2, 1})
+	if err != nil || addr.String() != "192.0.2.1:3478" {
+		t.Error("Unexpected address", addr, err)
+	}
+	if _, err := parseSTUNAddress([]byte{0, 2, 0x0d, 0x96, 192, 0, 2, 1}); err == nil {
+		t.Error("A truncated IPv6 address was accepted")
+	}
+}
+
+func TestNATAwareConnectionPlan(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	newPeer := func(key string, bt BindTechnique, behavior NATBehavior) *PeerConnection {
+		pc := &PeerConnection{
+			logger:               logger,
+			networkConnection:    &NetworkConnection{BindTechnique: bt},
+			publishedNATBehavior: behavior,
+		}
+		pc.MyProfile.PublicKey = key
+		return pc
+	}
+	event := func(pc *PeerConnection) *NetworkEndpointEvent {
+		return &NetworkEndpointEvent{
+			BindTechnique: pc.networkConnection.BindTechnique,
+			NATMapping:    pc.publishedNATBehavior.Mapping,
+			NATFiltering:  pc.publishedNATBehavior.Filtering,
+		}
+	}
+	complementary := map[string]string{
+		ConnectionTypeWANIN:  ConnectionTypeWANOUT,
+		ConnectionTypeWANOUT: ConnectionTypeWANIN,
+		ConnectionTypeLANIN:  ConnectionTypeLANOUT,
+		ConnectionTypeLANOUT: ConnectionTypeLANIN,
+	}
+
+	open := NATBehavior{Mapping: NATMappingEndpointIndependent, Filtering: NATFilteringEndpointIndependent}
+	strict := NATBehavior{Mapping: NATMappingAddressAndPortDependent, Filtering: NATFilteringAddressAndPortDependent}
+
+	a := newPeer("a", BindThroughPeer, open)
+	b := newPeer("b", BindNATPMP, strict)
+	a.PeerProfile.PublicKey, b.PeerProfile.PublicKey = "b", "a"
+
+	for try := 0; try < 8; try++ {
+		a.try, b.try = try, try
+		aType, bType := a.FindConnectionType(event(b)), b.FindConnectionType(event(a))
+		if complementary[aType] != bType {
+			t.Errorf("Try %d: peers chose %s and %s", try, aType, bType)
+		}
+	}
+
+	a.try, b.try = 0, 0
+	a.networkConnection.BindTechnique = BindSTUN
+	b.networkConnection.BindTechnique = BindUPNPIGD
+	if aType := a.FindConnectionType(event(b)); aType != ConnectionTypeWANOUT {
+		t.Error("The peer with the forwarded port wasn't chosen to receive the connection first", aType)
+	}
+
+	b.networkConnection.BindTechnique = BindSTUN
+	if aType, bType := a.FindConnectionType(event(b)), b.FindConnectionType(event(a)); aType != ConnectionTypeWANIN || bType != ConnectionTypeWANOUT {
+		t.Error("The peer with the endpoint-independent filtering wasn't chosen to receive the connection first", aType, bType)
+	}
+
+	b.publishedNATBehavior = NATBehavior{}
+	if plan := a.connectionPlan(event(b)); len(plan) != 6 {
+		t.Error("The connection types aren't cycled through when the NAT behavior of the peer is unknown")
+	}
+}
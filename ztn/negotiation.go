@@ -0,0 +1,32 @@
+package ztn
+
+import (
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	securerandom "github.com/theckman/go-securerandom"
+)
+
+// newSessionNonce returns the random nonce of a connection attempt, it is never zero since zero means unknown
+func newSessionNonce() uint64 {
+	for {
+		nonce, err := securerandom.Uint64()
+		sharedutils.CheckError(err)
+		if nonce != 0 {
+			return nonce
+		}
+	}
+}
+
+// holdsBestTry returns whether the peer with myNonce holds the try, both peers reach opposite conclusions whatever their clocks say
+// The largest nonce holds the try and the smallest key breaks the ties
+func holdsBestTry(myNonce, theirNonce uint64, iHaveTheSmallestKey bool) bool {
+	if myNonce == theirNonce {
+		return iHaveTheSmallestKey
+	}
+	return myNonce > theirNonce
+}
+
+// staleNetworkEndpointEvent returns whether an event acknowledges another nonce than the one of the current connection attempt
+// Such an event was published in answer to a previous attempt so its try may no longer be the one of the peer
+func staleNetworkEndpointEvent(nee *NetworkEndpointEvent, nonce uint64) bool {
+	return nee.AckNonce != 0 && nee.AckNonce != nonce
+}
@@ -0,0 +1,58 @@
+package ztn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestNegotiateTryWithSkewedClocks(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	now := time.Now()
+
+	for _, skew := range []time.Duration{0, 5 * time.Minute, -5 * time.Minute, time.Hour} {
+		for i := 0; i < 20; i++ {
+			alice := &PeerConnection{logger: logger, try: 3, nonce: newSessionNonce(), launchedAt: now}
+			alice.MyProfile.PublicKey = "alice"
+			alice.PeerProfile.PublicKey = "bob"
+			// Bob was launched right after Alice but his clock is off
+			bob := &PeerConnection{logger: logger, try: 8, nonce: newSessionNonce(), launchedAt: now.Add(time.Second + skew)}
+			bob.MyProfile.PublicKey = "bob"
+			bob.PeerProfile.PublicKey = "alice"
+
+			fromAlice := &NetworkEndpointEvent{Try: alice.try, Nonce: alice.nonce, LaunchedAt: alice.launchedAt}
+			fromBob := &NetworkEndpointEvent{Try: bob.try, Nonce: bob.nonce, AckNonce: alice.nonce, LaunchedAt: bob.launchedAt}
+
+			if alice.IAmTheBestTryHolder(fromBob) == bob.IAmTheBestTryHolder(fromAlice) {
+				t.Fatal("Both or none of the peers hold the try with a skew of", skew)
+			}
+			alice.negotiateTry(fromBob)
+			bob.negotiateTry(fromAlice)
+			if alice.try != bob.try {
+				t.Fatal("The peers disagree on the try with a skew of", skew, ":", alice.try, "and", bob.try)
+			}
+		}
+	}
+}
+
+func TestHoldsBestTry(t *testing.T) {
+	if !holdsBestTry(2, 1, false) || holdsBestTry(1, 2, true) {
+		t.Error("The largest nonce doesn't hold the try")
+	}
+	if !holdsBestTry(7, 7, true) || holdsBestTry(7, 7, false) {
+		t.Error("The smallest key doesn't break the ties")
+	}
+}
+
+func TestStaleNetworkEndpointEvent(t *testing.T) {
+	if staleNetworkEndpointEvent(&NetworkEndpointEvent{Nonce: 10}, 42) {
+		t.Error("An event that doesn't acknowledge anything yet was considered stale")
+	}
+	if staleNetworkEndpointEvent(&NetworkEndpointEvent{Nonce: 10, AckNonce: 42}, 42) {
+		t.Error("An event acknowledging the current attempt was considered stale")
+	}
+	if !staleNetworkEndpointEvent(&NetworkEndpointEvent{Nonce: 10, AckNonce: 41}, 42) {
+		t.Error("An event answering a previous attempt wasn't considered stale")
+	}
+}
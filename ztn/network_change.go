@@ -0,0 +1,55 @@
+package ztn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackpal/gateway"
+)
+
+// How long the network must stay unchanged before the changes are handled, an interface going up usually generates several address and route changes
+var networkChangeSettleDelay = 2 * time.Second
+
+var errNetworkChangesUnsupported = errors.New("subscribing to the network changes isn't supported on this platform")
+
+// debounceNetworkChanges calls onchange once the changes signaled on changes stop for networkChangeSettleDelay
+func debounceNetworkChanges(changes chan bool, onchange func()) {
+	var settled <-chan time.Time
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			settled = time.After(networkChangeSettleDelay)
+		case <-settled:
+			settled = nil
+			onchange()
+		}
+	}
+}
+
+// currentUnderlay describes the path used to reach the Internet: the local IP used to reach the STUN server and the default gateway
+// It is empty when the STUN server can't be reached
+func currentUnderlay() string {
+	return Underlay(stunServer)
+}
+
+// Underlay describes the path used to reach the Internet like currentUnderlay, for the processes that don't set up the tunnel
+func Underlay(stunServer string) string {
+	if stunServer == "" {
+		return ""
+	}
+	stunAddr, err := net.ResolveUDPAddr("udp4", stunServer)
+	if err != nil {
+		return ""
+	}
+	localIP, err := localIPTowards(stunAddr)
+	if err != nil {
+		return ""
+	}
+	gatewayIP, _ := gateway.DiscoverGateway()
+	return fmt.Sprintf("%s via %s", localIP, gatewayIP)
+}
@@ -0,0 +1,66 @@
+// +build linux
+
+package ztn
+
+import (
+	"unsafe"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"golang.org/x/sys/unix"
+)
+
+// SubscribeNetworkChanges calls onchange when the addresses or the routes of the host change, once they settled
+// onstop is called if the changes stop being received, the network then has to be polled instead
+func SubscribeNetworkChanges(logger *device.Logger, onchange func(), onstop func()) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+
+	sa := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR | unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE,
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	changes := make(chan bool)
+	go debounceNetworkChanges(changes, onchange)
+
+	go func() {
+		defer unix.Close(fd)
+		defer close(changes)
+
+		buf := make([]byte, 1<<16)
+		for {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err == unix.EINTR {
+				continue
+			} else if err == unix.ENOBUFS {
+				// Messages were lost, something changed anyway
+				changes <- true
+				continue
+			} else if err != nil {
+				logger.Error.Println("Stopped receiving the network changes, polling the network instead:", err)
+				onstop()
+				return
+			}
+
+			for remain := buf[:n]; len(remain) >= unix.SizeofNlMsghdr; {
+				hdr := *(*unix.NlMsghdr)(unsafe.Pointer(&remain[0]))
+				if hdr.Len < unix.SizeofNlMsghdr || uint(hdr.Len) > uint(len(remain)) {
+					break
+				}
+				switch hdr.Type {
+				case unix.RTM_NEWADDR, unix.RTM_DELADDR, unix.RTM_NEWROUTE, unix.RTM_DELROUTE:
+					changes <- true
+				}
+				remain = remain[hdr.Len:]
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package ztn
+
+import "github.com/inverse-inc/wireguard-go/device"
+
+// SubscribeNetworkChanges isn't supported outside of Linux, the network has to be polled instead
+func SubscribeNetworkChanges(logger *device.Logger, onchange func(), onstop func()) error {
+	return errNetworkChangesUnsupported
+}
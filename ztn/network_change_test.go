@@ -0,0 +1,72 @@
+package ztn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestDebounceNetworkChanges(t *testing.T) {
+	defer func(delay time.Duration) { networkChangeSettleDelay = delay }(networkChangeSettleDelay)
+	networkChangeSettleDelay = 100 * time.Millisecond
+
+	changes := make(chan bool)
+	handled := make(chan bool, 10)
+	go debounceNetworkChanges(changes, func() { handled <- true })
+	defer close(changes)
+
+	for i := 0; i < 5; i++ {
+		changes <- true
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if len(handled) != 1 {
+		t.Error("A burst of changes was handled", len(handled), "times instead of once")
+	}
+}
+
+func TestPathChanged(t *testing.T) {
+	pc := &PeerConnection{connectedInbound: true, connectedOutbound: true, ConnectionType: ConnectionTypeLANOUT}
+	pc.peerAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 12673}
+	pc.localIP, _ = localIPTowards(pc.peerAddr)
+
+	if pc.PathChanged(true) {
+		t.Error("A peer reached directly over an unchanged path was considered changed")
+	}
+
+	pc.localIP = net.IPv4(192, 0, 2, 1)
+	if !pc.PathChanged(false) {
+		t.Error("A change of the local IP used to reach the peer wasn't detected")
+	}
+
+	pc.localIP, _ = localIPTowards(pc.peerAddr)
+	pc.ConnectionType = ConnectionTypeWANSTUN
+	if !pc.PathChanged(true) {
+		t.Error("A peer reached through the public port wasn't reconnected when the port changed")
+	}
+
+	pc.connectedOutbound = false
+	if !pc.PathChanged(false) {
+		t.Error("A peer that wasn't connected wasn't reconnected")
+	}
+}
+
+func TestHandlePublicAddrChange(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	connection := NewConnection(logger)
+	connected := &PeerConnection{connectedInbound: true, connectedOutbound: true, ConnectionType: ConnectionTypeWANSTUN, reconnectChan: make(chan bool, 1), republishChan: make(chan bool, 1)}
+	connecting := &PeerConnection{ConnectionType: ConnectionTypeWANSTUN, reconnectChan: make(chan bool, 1), republishChan: make(chan bool, 1)}
+	connection.Peers["connected-id"] = connected
+	connection.Peers["connecting-id"] = connecting
+
+	connection.HandlePublicAddrChange()
+
+	if len(connected.reconnectChan) != 0 || len(connected.republishChan) != 1 {
+		t.Error("A connected peer wasn't given the new public address without reconnecting")
+	}
+	if len(connecting.reconnectChan) != 1 {
+		t.Error("A peer that wasn't connected wasn't connected again")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -24,6 +25,11 @@ type bridge struct {
 	marker    []byte
 }
 
+type bridgeUpdate struct {
+	id     string
+	bridge *bridge
+}
+
 type pkt struct {
 	conn    *net.UDPConn
 	raddr   *net.UDPAddr
@@ -39,19 +45,63 @@ type NetworkConnection struct {
 	token uint64
 
 	publicAddr *net.UDPAddr
+	// The global IPv6 address of this host along with the port of localConn, nil when IPv6 isn't available
+	publicAddrV6 *net.UDPAddr
 
 	publicAddrChan chan *net.UDPAddr
 
+	natBehavior     NATBehavior
+	natBehaviorLock sync.Mutex
+
+	// The address seen by the STUN server, it is obtained even when STUN isn't the bind technique so it can be used as a candidate
+	reflexiveAddr     *net.UDPAddr
+	reflexiveAddrLock sync.Mutex
+
+	// Predicts the external ports of localConn for each peer when the bind technique is port prediction, see PredictPorts
+	portPrediction     *PortPrediction
+	portPredictionLock sync.Mutex
+
+	// The addresses obtained by the bind techniques other than the one in use, they are published as candidates, see gatherCandidates
+	// and the address the relay of the relay candidate forwards the packets from, they carry a marker
+	gatheredAddrs     map[BindTechnique]*net.UDPAddr
+	gatheredRelayAddr *net.UDPAddr
+	gatheredLock      sync.Mutex
+
+	// The connectivity checks waiting for a response, indexed by transaction ID
+	checks     map[uint64]chan bool
+	checksLock sync.Mutex
+
 	bindThroughPeerAddr *net.UDPAddr
 
 	localConn *net.UDPConn
 	port      int
 
+	// The sockets pinned to each interface of a multi-homed host and the names of these interfaces
+	underlays          []*underlaySocket
+	underlayInterfaces string
+	underlaysLock      sync.Mutex
+
 	BindTechnique            BindTechnique
 	UserDefinedBindTechnique BindTechnique
 	BindTechniques           *BindTechniquesStruct
+	// Where the results of the bind techniques are recorded, nothing is recorded when nil
+	BindScores *BindScores
+
+	// The network the scores of the bind techniques are recorded for, empty until it is identified
+	networkID     string
+	networkIDLock sync.Mutex
+
+	// The path to the Internet when the public port was opened, see currentUnderlay
+	underlay     string
+	underlayLock sync.Mutex
+	// Makes run open a new public port, the channel is closed once the previous public address is discarded
+	rebindChan chan chan bool
+	// Makes run return when this connection bridges for a peer that doesn't use it anymore, see StopForwarding
+	stopForwardingChan chan bool
 
 	peerConnections map[string]*bridge
+	// The bridges added by the peer connections, only run uses peerConnections, see setBridge
+	setBridgeChan chan bridgeUpdate
 
 	logger *device.Logger
 
@@ -71,15 +121,22 @@ type NetworkConnection struct {
 	WGAddr       *net.UDPAddr
 	wgRemoteConn *net.UDPConn
 	wgConnRemote bool
+
+	// Limits and counts the traffic forwarded when this connection bridges for a peer
+	shaper *bridgeShaper
 }
 
 func NewNetworkConnection(description string, logger *device.Logger, port int) *NetworkConnection {
 	nc := &NetworkConnection{
-		logger:          logger.AddPrepend(fmt.Sprintf("(NC:%s) ", description)),
-		peerConnections: map[string]*bridge{},
-		port:            port,
+		logger:             logger.AddPrepend(fmt.Sprintf("(NC:%s) ", description)),
+		peerConnections:    map[string]*bridge{},
+		port:               port,
+		checks:             map[uint64]chan bool{},
+		rebindChan:         make(chan chan bool),
+		setBridgeChan:      make(chan bridgeUpdate),
+		stopForwardingChan: make(chan bool, 1),
 	}
-	nc.WGAddr = &net.UDPAddr{IP: localWGIP, Port: localWGPort}
+	nc.WGAddr = &net.UDPAddr{IP: localWGIP, Port: localWGPort()}
 
 	var err error
 	nc.id, err = securerandom.Uint64()
@@ -89,11 +146,11 @@ func NewNetworkConnection(description string, logger *device.Logger, port int) *
 
 	nc.reset()
 	nc.BindTechniques = BindTechniques.CopyNew()
-	if bt := sharedutils.EnvOrDefault(EnvBindTechnique, ""); bt != "" && BindTechniqueNames[bt] != "" {
-		nc.BindTechnique = BindTechniqueNames[bt]
+	if bt := GetConfig().BindTechnique; bt != "" {
+		nc.BindTechnique = bt
 		nc.UserDefinedBindTechnique = nc.BindTechnique
 		// If we're configured to use a static bind technique, we replace the bind techniques list with one will only contain our current bind technique
-		if sharedutils.IsEnabled(sharedutils.EnvOrDefault(EnvStaticBindTechnique, "false")) {
+		if GetConfig().StaticBindTechnique {
 			nc.logger.Info.Println("Using static bind technique", nc.BindTechnique)
 			nc.BindTechniques = &BindTechniquesStruct{}
 		}
@@ -107,12 +164,20 @@ func NewNetworkConnection(description string, logger *device.Logger, port int) *
 
 func (nc *NetworkConnection) reset() {
 	nc.publicAddr = nil
+	nc.publicAddrV6 = nil
+	nc.setReflexiveAddr(nil)
+	nc.setPortPrediction(nil)
+	nc.gatheredLock.Lock()
+	nc.gatheredAddrs = map[BindTechnique]*net.UDPAddr{}
+	nc.gatheredRelayAddr = nil
+	nc.gatheredLock.Unlock()
 
 	nc.bindThroughPeerAddr = nil
 
 	if nc.localConn != nil {
 		nc.localConn.Close()
 	}
+	nc.closeUnderlays()
 	for _, pc := range nc.peerConnections {
 		pc.conn.Close()
 	}
@@ -141,6 +206,7 @@ func (nc *NetworkConnection) reset() {
 
 func (nc *NetworkConnection) Start() {
 	for {
+		go nc.discoverNATBehavior()
 		nc.run()
 		nc.reset()
 		nc.logger.Info.Println("Public network connection seems to be inactive, will open a new public port")
@@ -150,7 +216,11 @@ func (nc *NetworkConnection) Start() {
 func (nc *NetworkConnection) SetupForwarding(ct string, profile Profile) (string, *net.UDPAddr) {
 	nc.publicAddrChan = make(chan *net.UDPAddr)
 
-	go nc.run()
+	go func() {
+		nc.run()
+		// The bridge isn't opened again, its sockets are released
+		nc.reset()
+	}()
 
 	select {
 	case <-time.After(5 * time.Second):
@@ -160,7 +230,7 @@ func (nc *NetworkConnection) SetupForwarding(ct string, profile Profile) (string
 		// And also what is the address to advertise to his own peers
 		if ct == ConnectionTypeLANIN || ct == ConnectionTypeLANOUT {
 			s := strings.Split(nc.localConn.LocalAddr().String(), ":")
-			return fmt.Sprintf("%s:%d", nc.GetPrivateIP().String(), s[len(s)-1]), addr
+			return fmt.Sprintf("%s:%s", nc.GetPrivateIP().String(), s[len(s)-1]), addr
 		} else {
 			return addr.String(), addr
 		}
@@ -174,6 +244,10 @@ func (nc *NetworkConnection) run() {
 
 	keepalive := time.Tick(500 * time.Millisecond)
 
+	reflexiveRefresh := time.Tick(30 * time.Second)
+
+	underlayKeepalive := time.Tick(underlayKeepaliveInterval)
+
 	maintenance := time.Tick(1 * time.Minute)
 
 	var localConnAddr *net.UDPAddr
@@ -196,20 +270,62 @@ func (nc *NetworkConnection) run() {
 
 	peernatpmp := NewNATPMP()
 
+	peerpcp := NewPCP()
+	defer peerpcp.DelPortMapping()
+
+	peerportprediction := NewPortPrediction()
+	nc.setPortPrediction(peerportprediction)
+
 	peerdirectpublic := NewPublicPort()
 
 	peerbindthroughpeer := NewBindThroughPeerAgent(nc.Connection, nc)
 	peerbindthroughpeerCheck := time.Tick(2 * time.Second)
+	relayReevaluation := time.Tick(relayReevaluationInterval)
+	candidateGathering := time.Tick(candidateGatheringInterval)
+	defer nc.releaseRelayCandidate(peerbindthroughpeer)
 
 	a := strings.Split(nc.localConn.LocalAddr().String(), ":")
 	localPort, err := strconv.Atoi(a[len(a)-1])
 	sharedutils.CheckError(err)
 
-	stunAddr, err := net.ResolveUDPAddr(udp, stunServer)
+	stunAddr, err := net.ResolveUDPAddr("udp4", stunServer)
 	sharedutils.CheckError(err)
 
+	// IPv6 addresses aren't translated so the one of this host can be given to the peers as is
+	if GetConfig().UseIPv6 {
+		if ip := nc.GetGlobalIPv6(); ip != nil {
+			nc.publicAddrV6 = &net.UDPAddr{IP: ip, Port: localPort}
+			nc.logger.Info.Println("Using the IPv6 address", nc.publicAddrV6)
+		}
+	}
+
 	nc.listen(nc.localConn, nc.messageChan)
 
+	nc.underlayLock.Lock()
+	nc.underlay = currentUnderlay()
+	nc.underlayLock.Unlock()
+
+	nc.openUnderlays()
+	nc.refreshUnderlays(stunAddr)
+
+	// Start with the technique that worked best on this network when it can be identified before binding
+	if nc.GetNetworkID() == "" && nc.identifyNetwork() && nc.UserDefinedBindTechnique == "" {
+		nc.BindTechnique = nc.BindTechniques.Next()
+		nc.logger.Info.Println("Using", nc.BindTechnique, "which has the best score on this network")
+	}
+
+	// Obtain the reflexive address right away so it is part of the candidates even when STUN isn't the bind technique
+	if nc.BindTechnique != BindSTUN {
+		sendBindingRequest(nc.localConn, stunAddr)
+	}
+
+	portMappers := map[BindTechnique]portMapper{
+		BindUPNPIGD: peerupnpigd,
+		BindNATPMP:  peernatpmp,
+		BindPCP:     peerpcp,
+	}
+	go nc.gatherCandidates(nc.localConn, localPort, portMappers, peerbindthroughpeer)
+
 	nc.started = time.Now()
 
 	for {
@@ -238,9 +354,15 @@ func (nc *NetworkConnection) run() {
 						return false
 					}
 				case peerbindthroughpeer.IsMessage(message.message):
+					previousAddr := nc.publicAddr
 					if nc.bindRequestPktIPUpdate(peerbindthroughpeer, message.message) != nil {
 						return false
 					}
+					// The peers that reach this device through the previous relay must move to the new one
+					if previousAddr != nil && previousAddr.Port != 0 && nc.publicAddr.Port != 0 && previousAddr.String() != nc.publicAddr.String() && nc.Connection != nil {
+						nc.logger.Info.Println("The public address moved from", previousAddr, "to", nc.publicAddr, "with the new relay")
+						go nc.Connection.HandlePublicAddrChange()
+					}
 				case peerupnpigd.IsMessage(message.message):
 					if nc.bindRequestPktIPUpdate(peerupnpigd, message.message) != nil {
 						return false
@@ -249,6 +371,14 @@ func (nc *NetworkConnection) run() {
 					if nc.bindRequestPktIPUpdate(peernatpmp, message.message) != nil {
 						return false
 					}
+				case peerpcp.IsMessage(message.message):
+					if nc.bindRequestPktIPUpdate(peerpcp, message.message) != nil {
+						return false
+					}
+				case peerportprediction.IsMessage(message.message):
+					if nc.bindRequestPktIPUpdate(peerportprediction, message.message) != nil {
+						return false
+					}
 				case stun.IsMessage(message.message):
 					m := new(stun.Message)
 					m.Raw = message.message
@@ -263,13 +393,22 @@ func (nc *NetworkConnection) run() {
 						return false
 					}
 
-					if stunPublicAddr.String() != xorAddr.String() {
+					if nc.setUnderlayReflexiveAddr(message.conn, &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}) {
+						return true
+					}
+
+					nc.setReflexiveAddr(&net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port})
+					if nc.GetNetworkID() == "" {
+						nc.identifyNetwork()
+					}
+					if nc.BindTechnique == BindSTUN && stunPublicAddr.String() != xorAddr.String() {
 						stunPublicAddr = xorAddr
-						newaddr, err := net.ResolveUDPAddr("udp4", xorAddr.String())
-						sharedutils.CheckError(err)
-						nc.setPublicAddr(newaddr)
+						nc.setPublicAddr(&net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port})
 					}
 
+				case isConnectivityCheck(message.message):
+					nc.handleConnectivityCheck(message.conn, message.raddr, message.message, nil)
+
 				case string(message.message) == pingMsg:
 					nc.logger.Debug.Println("Received ping from", message.raddr.String())
 
@@ -277,7 +416,8 @@ func (nc *NetworkConnection) run() {
 					if writeBack := nc.findBridge(message.conn.LocalAddr()); writeBack != nil {
 						msg := message.message
 						nc.lastWGOutbound = time.Now()
-						if nc.BindTechnique == BindThroughPeer {
+						// The packets of the peers that reach this device through a relay go back through it
+						if writeBack.marker != nil {
 							msg = nc.addMarker(writeBack.marker, msg)
 						}
 						n := len(message.message)
@@ -289,6 +429,10 @@ func (nc *NetworkConnection) run() {
 					} else if writeBack := nc.findRemoteBridge(message.conn.LocalAddr(), message.message); writeBack != nil {
 						nc.lastWGOutbound = time.Now()
 						n := len(message.message)
+						if !nc.shaper.forward(n, false, nc.lastWGOutbound) {
+							nc.logger.Debug.Printf("Dropping %d bytes from the bridged peer that exceed the bandwidth limits\n", n)
+							return true
+						}
 
 						// strip our special header
 						marker, msg := nc.stripMarker(message.message)
@@ -300,9 +444,16 @@ func (nc *NetworkConnection) run() {
 						}
 					} else {
 						//TODO: more mem efficiency and ensure garbage collected
+						if nc.lastWGInbound.IsZero() {
+							nc.recordBindResult(true)
+						}
 						nc.lastWGInbound = time.Now()
 						n := len(message.message)
 						if nc.wgConnRemote {
+							if !nc.shaper.forward(n, true, nc.lastWGInbound) {
+								nc.logger.Debug.Printf("Dropping %d bytes for the bridged peer that exceed the bandwidth limits\n", n)
+								return true
+							}
 							nc.setupRemoteBridge(message.conn, message.raddr)
 							msg := nc.addMarkerFromAddr(message.raddr, message.message)
 							nc.logger.Debug.Printf("send to remote WG server: [%s]: %d bytes from %s (marker:%s)\n", nc.WGAddr.String(), n, message.raddr, nc.infoFromMarker(msg))
@@ -310,8 +461,16 @@ func (nc *NetworkConnection) run() {
 						} else {
 							var marker []byte
 							msg := message.message
-							if nc.BindTechnique == BindThroughPeer {
+							if nc.BindTechnique == BindThroughPeer || nc.fromRelayCandidate(message.raddr) {
 								marker, msg = nc.stripMarker(message.message)
+								if nc.infoFromMarker(marker) == nil {
+									nc.logger.Debug.Println("Dropping a packet from", message.raddr, "with a marker of an incompatible version")
+									return true
+								}
+								if isConnectivityCheck(msg) {
+									nc.handleConnectivityCheck(message.conn, message.raddr, msg, marker)
+									return true
+								}
 							}
 							writeBack := nc.setupBridge(message.conn, message.raddr, nc.WGAddr, nc.messageChan, marker)
 							// recompute length so that its refreshed if a marker was removed
@@ -324,18 +483,41 @@ func (nc *NetworkConnection) run() {
 						}
 					}
 				}
+			case <-nc.stopForwardingChan:
+				nc.logger.Info.Println("The peer doesn't use this bridge anymore, stopping the forwarding")
+				return false
+			case done := <-nc.rebindChan:
+				nc.logger.Info.Println("The network changed, opening a new public port")
+				nc.publicAddr = nil
+				nc.networkIDLock.Lock()
+				nc.networkID = ""
+				nc.networkIDLock.Unlock()
+				close(done)
+				return false
 			case <-nc.inboundAttemptsChan:
 				nc.inboundAttempts++
 				nc.logger.Debug.Println("Got an inbound attempt reported by a peer connection", nc.inboundAttempts, InboundAttemptsTolerance, time.Since(nc.started), InboundAttemptsTryAtLeast, nc.lastWGInbound)
 				if nc.inboundAttempts > InboundAttemptsTolerance && time.Since(nc.started) > InboundAttemptsTryAtLeast && nc.lastWGInbound.IsZero() {
-					nc.BindTechnique = nc.BindTechniques.Next()
+					nc.nextBindTechnique()
 					return false
 				}
+			case u := <-nc.setBridgeChan:
+				u.bridge.lastUsed = time.Now()
+				nc.peerConnections[u.id] = u.bridge
 			case <-nc.printDebugChan:
 				nc.logger.Info.Print(spew.Sdump(nc.peerConnections))
 				nc.logger.Info.Println("Last inbound/outbound", nc.lastWGInbound, "/", nc.lastWGOutbound)
 			case <-maintenance:
 				nc.maintenance()
+			case <-reflexiveRefresh:
+				// The STUN binding is refreshed by the keepalive when STUN is the bind technique
+				if nc.BindTechnique != BindSTUN {
+					sendBindingRequest(nc.localConn, stunAddr)
+				}
+			case <-underlayKeepalive:
+				nc.refreshUnderlays(stunAddr)
+			case <-candidateGathering:
+				go nc.gatherCandidates(nc.localConn, localPort, portMappers, peerbindthroughpeer)
 			case <-peerbindthroughpeerCheck:
 				if nc.BindTechnique == BindThroughPeer && nc.publicAddr != nil && nc.publicAddr.Port != 0 {
 					if !peerbindthroughpeer.StillAlive() {
@@ -343,9 +525,13 @@ func (nc *NetworkConnection) run() {
 						return false
 					}
 				}
+			case <-relayReevaluation:
+				if nc.BindTechnique == BindThroughPeer && nc.publicAddr != nil && nc.publicAddr.Port != 0 {
+					go peerbindthroughpeer.Migrate(nc.localConn, nc.messageChan)
+				}
 			case <-keepalive:
 				if !nc.CheckConnectionLiveness() {
-					nc.BindTechnique = nc.BindTechniques.Next()
+					nc.nextBindTechnique()
 					return false
 				}
 
@@ -363,6 +549,10 @@ func (nc *NetworkConnection) run() {
 						err = peerupnpigd.BindRequest(nc.localConn, localPort, nc.messageChan)
 					} else if nc.BindTechnique == BindNATPMP {
 						err = peernatpmp.BindRequest(nc.localConn, localPort, nc.messageChan)
+					} else if nc.BindTechnique == BindPCP {
+						err = peerpcp.BindRequest(nc.localConn, localPort, nc.messageChan)
+					} else if nc.BindTechnique == BindPortPrediction {
+						err = peerportprediction.BindRequest(stunAddr, nc.messageChan)
 					} else if nc.BindTechnique == BindDirectPublic {
 						err = peerdirectpublic.BindRequest(nc.localConn, nc.messageChan)
 					}
@@ -378,7 +568,7 @@ func (nc *NetworkConnection) run() {
 					bindFail++
 					if bindFail > nc.MaxBindFailures() {
 						nc.logger.Error.Printf("Maximum amount of bind failures reached (%d)", bindFail)
-						nc.BindTechnique = nc.BindTechniques.Next()
+						nc.nextBindTechnique()
 						return false
 					}
 				}
@@ -396,6 +586,156 @@ func (nc *NetworkConnection) GetPublicAddr() *net.UDPAddr {
 	return nc.publicAddr
 }
 
+// discoverNATBehavior classifies the NAT using the STUN server of the profile, the previous classification is kept when it fails
+func (nc *NetworkConnection) discoverNATBehavior() {
+	if stunServer == "" {
+		return
+	}
+	behavior, err := DiscoverNATBehavior(stunServer)
+	if err != nil {
+		nc.logger.Error.Println("Unable to discover the NAT behavior:", err)
+		return
+	}
+	nc.logger.Info.Println("Discovered the NAT behavior", behavior)
+	nc.natBehaviorLock.Lock()
+	defer nc.natBehaviorLock.Unlock()
+	nc.natBehavior = behavior
+
+	// The STUN address can't be reached by the peers behind a symmetric NAT, predicting the next ports may still allow a direct connection
+	if (behavior.Mapping == NATMappingAddressDependent || behavior.Mapping == NATMappingAddressAndPortDependent) && !GetConfig().StaticBindTechnique {
+		nc.logger.Info.Println("The NAT is symmetric, adding the port prediction bind technique")
+		nc.BindTechniques.Add(BindPortPrediction)
+	}
+}
+
+func (nc *NetworkConnection) setPortPrediction(prediction *PortPrediction) {
+	nc.portPredictionLock.Lock()
+	defer nc.portPredictionLock.Unlock()
+	nc.portPrediction = prediction
+}
+
+// PredictPorts samples the NAT again and returns the external ports it should allocate to the next peer, it is empty unless the port prediction bind technique is used
+// The connectivity checks sent to the other peers use up the predicted ports so each peer takes its own sample right before punching
+func (nc *NetworkConnection) PredictPorts() []int {
+	nc.portPredictionLock.Lock()
+	prediction := nc.portPrediction
+	nc.portPredictionLock.Unlock()
+	if prediction == nil || nc.BindTechnique != BindPortPrediction {
+		return nil
+	}
+
+	_, ports, err := prediction.Predict()
+	if err != nil {
+		nc.logger.Error.Println("Unable to predict the ports:", err)
+		return nil
+	}
+	return ports
+}
+
+// GetNATBehavior returns the classification of the NAT in front of this connection, it is unknown until the discovery completes
+func (nc *NetworkConnection) GetNATBehavior() NATBehavior {
+	nc.natBehaviorLock.Lock()
+	defer nc.natBehaviorLock.Unlock()
+	return nc.natBehavior
+}
+
+// HandleNetworkChange opens a new public port when the path to the Internet changed and returns whether it did
+// The public port is kept when the change doesn't affect that path, for example when a route is added for the tunnel
+func (nc *NetworkConnection) HandleNetworkChange() bool {
+	underlay := currentUnderlay()
+	nc.underlayLock.Lock()
+	previous := nc.underlay
+	nc.underlayLock.Unlock()
+
+	interfaces := underlayInterfaceNames(usableUnderlayInterfaces())
+	nc.underlaysLock.Lock()
+	previousInterfaces := nc.underlayInterfaces
+	nc.underlaysLock.Unlock()
+
+	if underlay == previous && interfaces == previousInterfaces {
+		nc.logger.Debug.Println("The path to the Internet is unchanged:", underlay)
+		return false
+	}
+
+	nc.logger.Info.Println("The path to the Internet changed from", previous, "to", underlay, "interfaces", previousInterfaces, "to", interfaces)
+	done := make(chan bool)
+	select {
+	case nc.rebindChan <- done:
+		<-done
+	case <-time.After(10 * time.Second):
+		nc.logger.Error.Println("Timeout waiting for the public port to be closed")
+	}
+	return true
+}
+
+// identifyNetwork finds the network this connection uses and orders the bind techniques using their scores on it
+// It returns whether the network was identified
+func (nc *NetworkConnection) identifyNetwork() bool {
+	if nc.BindScores == nil {
+		return false
+	}
+	publicIP := ""
+	if addr := nc.GetReflexiveAddr(); addr != nil {
+		publicIP = addr.IP.String()
+	}
+	id := networkID(publicIP)
+	if id == "" {
+		return false
+	}
+
+	nc.networkIDLock.Lock()
+	nc.networkID = id
+	nc.networkIDLock.Unlock()
+
+	nc.logger.Info.Println("Connected to network", id)
+	nc.BindTechniques.SetScores(nc.BindScores.Scores(id))
+	return true
+}
+
+// GetNetworkID returns the identifier of the network this connection uses, it is empty until the network is identified
+func (nc *NetworkConnection) GetNetworkID() string {
+	nc.networkIDLock.Lock()
+	defer nc.networkIDLock.Unlock()
+	return nc.networkID
+}
+
+// recordBindResult records whether the current bind technique allowed to receive the packets of a peer
+func (nc *NetworkConnection) recordBindResult(success bool) {
+	id := nc.GetNetworkID()
+	if nc.BindScores == nil || id == "" {
+		return
+	}
+	if err := nc.BindScores.Record(id, nc.BindTechnique, success, time.Since(nc.started)); err != nil {
+		nc.logger.Error.Println("Unable to save the scores of the bind techniques:", err)
+	}
+}
+
+// nextBindTechnique switches to the next bind technique, the current one failed if it never received a packet of a peer
+func (nc *NetworkConnection) nextBindTechnique() {
+	if nc.lastWGInbound.IsZero() {
+		nc.recordBindResult(false)
+	}
+	nc.BindTechnique = nc.BindTechniques.Next()
+}
+
+func (nc *NetworkConnection) setReflexiveAddr(addr *net.UDPAddr) {
+	nc.reflexiveAddrLock.Lock()
+	defer nc.reflexiveAddrLock.Unlock()
+	nc.reflexiveAddr = addr
+}
+
+// GetReflexiveAddr returns the address of this connection as seen by the STUN server or nil when it isn't known yet
+func (nc *NetworkConnection) GetReflexiveAddr() *net.UDPAddr {
+	nc.reflexiveAddrLock.Lock()
+	defer nc.reflexiveAddrLock.Unlock()
+	return nc.reflexiveAddr
+}
+
+// GetPublicAddrV6 returns the IPv6 address the peers can use to reach this connection or nil when there is none
+func (nc *NetworkConnection) GetPublicAddrV6() *net.UDPAddr {
+	return nc.publicAddrV6
+}
+
 func (nc *NetworkConnection) listen(conn *net.UDPConn, messages chan *pkt) {
 	go func() {
 		for {
@@ -421,7 +761,7 @@ func (nc *NetworkConnection) setupBridge(fromConn *net.UDPConn, raddr *net.UDPAd
 		id = raddr.String()
 	}
 	if nc.peerConnections[id] == nil {
-		conn, err := net.DialUDP("udp4", nil, toAddr)
+		conn, err := net.DialUDP(udp, nil, toAddr)
 		sharedutils.CheckError(err)
 		markerCopy := make([]byte, len(marker))
 		copy(markerCopy, marker)
@@ -443,7 +783,7 @@ func (nc *NetworkConnection) findBridge(addr net.Addr) *bridge {
 
 const remotePrefix = "remote:"
 const remoteBackSuffix = ":back"
-const markerLength = 4 + binary.MaxVarintLen64
+const markerLength = encodedAddrLength
 
 func (nc *NetworkConnection) setupRemoteBridge(fromConn *net.UDPConn, raddr *net.UDPAddr) {
 	if nc.peerConnections[remotePrefix+raddr.String()] == nil {
@@ -483,6 +823,25 @@ func (nc *NetworkConnection) CheckConnectionLiveness() bool {
 	return true
 }
 
+// StopForwarding tears down the bridge set up by SetupForwarding
+func (nc *NetworkConnection) StopForwarding() {
+	select {
+	case nc.stopForwardingChan <- true:
+	default:
+		// The forwarding is already being stopped
+	}
+}
+
+// setBridge makes run use b for the packets received from id
+// The bridge is lost when the public port is opened again, the peer connections then connect again anyway
+func (nc *NetworkConnection) setBridge(id string, b *bridge) {
+	select {
+	case nc.setBridgeChan <- bridgeUpdate{id: id, bridge: b}:
+	case <-time.After(10 * time.Second):
+		nc.logger.Error.Println("Timeout waiting to set the bridge of", id)
+	}
+}
+
 func (nc *NetworkConnection) RecordInboundAttempt() {
 	nc.inboundAttemptsChan <- 1
 }
@@ -576,10 +935,8 @@ func (nc *NetworkConnection) bindPeerBridge(conn *net.UDPConn, raddr *net.UDPAdd
 }
 
 func (nc *NetworkConnection) addMarkerFromAddr(raddr *net.UDPAddr, data []byte) []byte {
-	info := []byte{raddr.IP[12], raddr.IP[13], raddr.IP[14], raddr.IP[15]}
-	port := make([]byte, binary.MaxVarintLen64)
-	binary.PutUvarint(port, uint64(raddr.Port))
-	info = append(info, port...)
+	info := make([]byte, markerLength)
+	encodeAddr(info, raddr.IP, raddr.Port)
 	return nc.addMarker(info, data)
 }
 
@@ -589,12 +946,8 @@ func (nc *NetworkConnection) addMarker(marker []byte, data []byte) []byte {
 }
 
 func (nc *NetworkConnection) infoFromMarker(message []byte) *net.UDPAddr {
-	if nc.wgConnRemote || nc.BindTechnique == BindThroughPeer {
-		port, _ := binary.Uvarint(message[4 : 4+binary.MaxVarintLen64])
-		return &net.UDPAddr{
-			IP:   net.IPv4(message[0], message[1], message[2], message[3]),
-			Port: int(port),
-		}
+	if (nc.wgConnRemote || nc.BindTechnique == BindThroughPeer) && len(message) >= markerLength {
+		return decodeAddr(message)
 	}
 	return nil
 }
@@ -612,8 +965,7 @@ func (nc *NetworkConnection) bindRequestPktIPUpdate(method BindTechniqueInterfac
 		return err
 	}
 
-	newaddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("%s:%d", externalIP, externalPort))
-	sharedutils.CheckError(err)
+	newaddr := &net.UDPAddr{IP: externalIP, Port: externalPort}
 	if newaddr.String() != nc.publicAddr.String() {
 		nc.setPublicAddr(newaddr)
 	}
@@ -621,13 +973,34 @@ func (nc *NetworkConnection) bindRequestPktIPUpdate(method BindTechniqueInterfac
 }
 
 func (nc *NetworkConnection) GetPrivateIP() net.IP {
-	conn, err := net.Dial("udp", stunServer)
+	conn, err := net.Dial("udp4", stunServer)
 	sharedutils.CheckError(err)
 	defer conn.Close()
 
 	return conn.LocalAddr().(*net.UDPAddr).IP
 }
 
+// A well-known IPv6 address used to find the route to the Internet, no packet is sent to it
+const ipv6RouteProbeAddr = "[2001:4860:4860::8888]:53"
+
+// GetGlobalIPv6 returns the IPv6 address this host uses to reach the Internet or nil when it doesn't have a global one
+// The address is the one the system selects when routing to a well-known address, which doesn't depend on the DNS records of the STUN server
+func (nc *NetworkConnection) GetGlobalIPv6() net.IP {
+	conn, err := net.Dial("udp6", ipv6RouteProbeAddr)
+	if err != nil {
+		nc.logger.Debug.Println("No IPv6 connectivity:", err)
+		return nil
+	}
+	defer conn.Close()
+
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if !isGlobalIPv6(ip) {
+		nc.logger.Debug.Println("The IPv6 address", ip, "isn't reachable from the Internet")
+		return nil
+	}
+	return ip
+}
+
 func (nc *NetworkConnection) MaxBindFailures() int {
 	if nc.BindTechnique == nc.UserDefinedBindTechnique {
 		return UserDefinedMaxBindFailures
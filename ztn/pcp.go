@@ -0,0 +1,326 @@
+package ztn
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	"github.com/jackpal/gateway"
+	securerandom "github.com/theckman/go-securerandom"
+)
+
+// Port Control Protocol as defined in RFC 6887, only the MAP opcode is used
+const (
+	pcpServerPort   = 5351
+	pcpVersion      = 2
+	pcpOpcodeMap    = 1
+	pcpResponseBit  = 0x80
+	pcpProtocolUDP  = 17
+	pcpNonceLength  = 12
+	pcpHeaderLength = 24
+	pcpMapLength    = 36
+)
+
+var pcpResultCodes = map[byte]string{
+	1:  "UNSUPP_VERSION",
+	2:  "NOT_AUTHORIZED",
+	3:  "MALFORMED_REQUEST",
+	4:  "UNSUPP_OPCODE",
+	5:  "UNSUPP_OPTION",
+	6:  "MALFORMED_OPTION",
+	7:  "NETWORK_FAILURE",
+	8:  "NO_RESOURCES",
+	9:  "UNSUPP_PROTOCOL",
+	10: "USER_EX_QUOTA",
+	11: "CANNOT_PROVIDE_EXTERNAL",
+	12: "ADDRESS_MISMATCH",
+	13: "EXCESSIVE_REMOTE_PEERS",
+}
+
+// How long to wait for the response of the PCP server before sending the request again
+var pcpTimeout = 1 * time.Second
+
+const pcpAttempts = 3
+
+var pcpMapped = []*PCP{}
+var pcpMappedLock sync.Mutex
+
+type PCP struct {
+	sync.Mutex
+	BindTechniqueBase
+	// The PCP server, it is the default gateway unless it is set before the first request
+	server     *net.UDPAddr
+	nonce      [pcpNonceLength]byte
+	localPort  int
+	remotePort int
+	externalIP net.IP
+	stop       chan bool
+}
+
+type pcpMapResponse struct {
+	lifetime     uint32
+	externalPort int
+	externalIP   net.IP
+}
+
+func NewPCP() *PCP {
+	u := &PCP{}
+	u.InitID()
+	_, err := rand.Read(u.nonce[:])
+	sharedutils.CheckError(err)
+	return u
+}
+
+// PCPCleanupMapped deletes the mappings created by all the PCP bind techniques
+func PCPCleanupMapped() {
+	pcpMappedLock.Lock()
+	mapped := pcpMapped
+	pcpMapped = []*PCP{}
+	pcpMappedLock.Unlock()
+
+	for _, u := range mapped {
+		fmt.Println("Clearing PCP mapping", u.remotePort)
+		u.DelPortMapping()
+	}
+}
+
+func (u *PCP) discoverServer() error {
+	if u.server != nil {
+		return nil
+	}
+	gatewayIP, err := gateway.DiscoverGateway()
+	if err != nil {
+		return err
+	}
+	u.server = &net.UDPAddr{IP: gatewayIP, Port: pcpServerPort}
+	return nil
+}
+
+func (u *PCP) CheckNet() error {
+	if err := u.discoverServer(); err != nil {
+		return err
+	}
+
+	// Test if the port mapping works, open random port for 5s and delete it right away
+	r, err := securerandom.Uint64()
+	sharedutils.CheckError(err)
+	randomPort := int(r%10000 + 30000)
+
+	res, err := u.mapRequest(randomPort, randomPort, nil, 5)
+	if err != nil {
+		return err
+	}
+	u.mapRequest(randomPort, 0, nil, 0)
+
+	if isPrivateIP(res.externalIP) {
+		return errors.New("External IP is a private ip")
+	}
+	return nil
+}
+
+// AddPortMapping maps the remote port to the local port and renews the mapping until it is deleted
+// The PCP server can assign another port or external address than the ones suggested
+func (u *PCP) AddPortMapping(localPort, remotePort int) error {
+	res, err := u.mapRequest(localPort, remotePort, nil, uint32(PublicPortTTL()))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Port mapped successfully via PCP", localPort, res.externalPort)
+
+	u.localPort = localPort
+	u.remotePort = res.externalPort
+	u.externalIP = res.externalIP
+	u.stop = make(chan bool)
+
+	pcpMappedLock.Lock()
+	pcpMapped = append(pcpMapped, u)
+	pcpMappedLock.Unlock()
+
+	go u.renew(res.lifetime, u.stop)
+	return nil
+}
+
+// renew refreshes the mapping when half of its lifetime has passed as recommended by section 11.2.1 of RFC 6887
+func (u *PCP) renew(lifetime uint32, stop chan bool) {
+	for {
+		select {
+		case <-time.After(time.Duration(lifetime) * time.Second / 2):
+		case <-stop:
+			return
+		}
+
+		u.Lock()
+		if u.remotePort == 0 {
+			u.Unlock()
+			return
+		}
+		res, err := u.mapRequest(u.localPort, u.remotePort, u.externalIP, uint32(PublicPortTTL()))
+		if err != nil {
+			fmt.Println("Failed to renew the PCP mapping", u.localPort, u.remotePort, err)
+			// Retry sooner since the mapping will expire
+			lifetime = lifetime / 2
+			if lifetime < 2 {
+				lifetime = 2
+			}
+		} else {
+			if res.externalPort != u.remotePort || !res.externalIP.Equal(u.externalIP) {
+				fmt.Println("The PCP mapping changed from", u.remotePort, "to", res.externalPort)
+				u.remotePort = res.externalPort
+				u.externalIP = res.externalIP
+			}
+			lifetime = res.lifetime
+		}
+		u.Unlock()
+	}
+}
+
+// DelPortMapping deletes the mapping by requesting it with a lifetime of 0
+func (u *PCP) DelPortMapping() error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.remotePort == 0 {
+		return nil
+	}
+	if u.stop != nil {
+		close(u.stop)
+		u.stop = nil
+	}
+	_, err := u.mapRequest(u.localPort, 0, nil, 0)
+	u.remotePort = 0
+
+	pcpMappedLock.Lock()
+	defer pcpMappedLock.Unlock()
+	for i, m := range pcpMapped {
+		if m == u {
+			pcpMapped = append(pcpMapped[:i], pcpMapped[i+1:]...)
+			break
+		}
+	}
+	return err
+}
+
+func (u *PCP) BindRequest(localPeerConn *net.UDPConn, localPeerPort int, sendTo chan *pkt) error {
+	u.Lock()
+	defer u.Unlock()
+
+	if err := u.discoverServer(); err != nil {
+		return err
+	}
+
+	if u.remotePort == 0 {
+		r, err := securerandom.Uint64()
+		sharedutils.CheckError(err)
+		err = u.AddPortMapping(localPeerPort, int(r%10000+30000))
+		if err != nil {
+			return fmt.Errorf("Fail to add the port mapping via PCP: %s", err)
+		}
+	}
+
+	externalIP, remotePort := u.externalIP, u.remotePort
+	go func() {
+		sendTo <- &pkt{message: u.BindRequestPkt(externalIP, remotePort)}
+	}()
+
+	return nil
+}
+
+// mapRequest sends a MAP request to the PCP server and waits for its response, a lifetime of 0 deletes the mapping
+func (u *PCP) mapRequest(internalPort, suggestedPort int, suggestedIP net.IP, lifetime uint32) (*pcpMapResponse, error) {
+	conn, err := net.DialUDP(udp, nil, u.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := pcpMapRequestPkt(conn.LocalAddr().(*net.UDPAddr).IP, u.nonce, internalPort, suggestedPort, suggestedIP, lifetime)
+
+	buf := defaultBufferPool.Get()
+	defer defaultBufferPool.Put(buf)
+
+	for attempt := 0; attempt < pcpAttempts; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(pcpTimeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			res, err := parsePCPMapResponse(buf[:n], u.nonce)
+			if err == errPCPOtherNonce {
+				continue
+			}
+			return res, err
+		}
+	}
+	return nil, errors.New("no response from the PCP server")
+}
+
+var errPCPOtherNonce = errors.New("PCP response is for another mapping")
+
+func pcpMapRequestPkt(clientIP net.IP, nonce [pcpNonceLength]byte, internalPort, suggestedPort int, suggestedIP net.IP, lifetime uint32) []byte {
+	b := make([]byte, pcpHeaderLength+pcpMapLength)
+	b[0] = pcpVersion
+	b[1] = pcpOpcodeMap
+	binary.BigEndian.PutUint32(b[4:8], lifetime)
+	copy(b[8:24], clientIP.To16())
+
+	m := b[pcpHeaderLength:]
+	copy(m[0:12], nonce[:])
+	m[12] = pcpProtocolUDP
+	binary.BigEndian.PutUint16(m[16:18], uint16(internalPort))
+	binary.BigEndian.PutUint16(m[18:20], uint16(suggestedPort))
+	if suggestedIP == nil {
+		// The unspecified address must be of the same family as the client
+		if clientIP.To4() != nil {
+			suggestedIP = net.IPv4zero
+		} else {
+			suggestedIP = net.IPv6zero
+		}
+	}
+	copy(m[20:36], suggestedIP.To16())
+	return b
+}
+
+func parsePCPMapResponse(b []byte, nonce [pcpNonceLength]byte) (*pcpMapResponse, error) {
+	if len(b) < pcpHeaderLength+pcpMapLength {
+		return nil, errors.New("PCP response is too short")
+	}
+	if b[0] != pcpVersion {
+		return nil, fmt.Errorf("unsupported PCP version %d", b[0])
+	}
+	if b[1] != pcpResponseBit|pcpOpcodeMap {
+		return nil, fmt.Errorf("unexpected PCP opcode %d", b[1])
+	}
+
+	m := b[pcpHeaderLength:]
+	var resNonce [pcpNonceLength]byte
+	copy(resNonce[:], m[0:12])
+	if resNonce != nonce {
+		return nil, errPCPOtherNonce
+	}
+
+	if result := b[3]; result != 0 {
+		if name, ok := pcpResultCodes[result]; ok {
+			return nil, fmt.Errorf("PCP server refused the mapping: %s", name)
+		}
+		return nil, fmt.Errorf("PCP server refused the mapping with result code %d", result)
+	}
+
+	res := &pcpMapResponse{
+		lifetime:     binary.BigEndian.Uint32(b[4:8]),
+		externalPort: int(binary.BigEndian.Uint16(m[18:20])),
+		externalIP:   net.IP(append([]byte{}, m[20:36]...)),
+	}
+	if ip4 := res.externalIP.To4(); ip4 != nil {
+		res.externalIP = ip4
+	}
+	return res, nil
+}
@@ -0,0 +1,147 @@
+package ztn
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePCPRequest struct {
+	lifetime      uint32
+	internalPort  int
+	suggestedPort int
+}
+
+// fakePCPServer answers the MAP requests with the external address 203.0.113.7 and a lifetime capped to maxLifetime
+type fakePCPServer struct {
+	sync.Mutex
+	conn        *net.UDPConn
+	maxLifetime uint32
+	result      byte
+	requests    []fakePCPRequest
+}
+
+func newFakePCPServer(t *testing.T, maxLifetime uint32) *fakePCPServer {
+	conn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakePCPServer{conn: conn, maxLifetime: maxLifetime}
+	go s.serve()
+	return s
+}
+
+func (s *fakePCPServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, raddr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:n]
+		if n != pcpHeaderLength+pcpMapLength || req[0] != pcpVersion || req[1] != pcpOpcodeMap {
+			continue
+		}
+		m := req[pcpHeaderLength:]
+		r := fakePCPRequest{
+			lifetime:      binary.BigEndian.Uint32(req[4:8]),
+			internalPort:  int(binary.BigEndian.Uint16(m[16:18])),
+			suggestedPort: int(binary.BigEndian.Uint16(m[18:20])),
+		}
+
+		s.Lock()
+		s.requests = append(s.requests, r)
+		result := s.result
+		s.Unlock()
+
+		lifetime := r.lifetime
+		if lifetime > s.maxLifetime {
+			lifetime = s.maxLifetime
+		}
+		externalPort := r.suggestedPort
+		if externalPort == 0 {
+			externalPort = 40000
+		}
+
+		res := make([]byte, pcpHeaderLength+pcpMapLength)
+		res[0] = pcpVersion
+		res[1] = pcpResponseBit | pcpOpcodeMap
+		res[3] = result
+		binary.BigEndian.PutUint32(res[4:8], lifetime)
+		copy(res[pcpHeaderLength:], m[:20])
+		binary.BigEndian.PutUint16(res[pcpHeaderLength+18:], uint16(externalPort))
+		copy(res[pcpHeaderLength+20:], net.ParseIP("203.0.113.7").To16())
+		s.conn.WriteToUDP(res, raddr)
+	}
+}
+
+func (s *fakePCPServer) Requests() []fakePCPRequest {
+	s.Lock()
+	defer s.Unlock()
+	return append([]fakePCPRequest{}, s.requests...)
+}
+
+func TestPCP(t *testing.T) {
+	server := newFakePCPServer(t, 2)
+	defer server.conn.Close()
+
+	u := NewPCP()
+	u.server = server.conn.LocalAddr().(*net.UDPAddr)
+
+	sendTo := make(chan *pkt)
+	if err := u.BindRequest(nil, 12345, sendTo); err != nil {
+		t.Fatal("Unable to map the port:", err)
+	}
+
+	select {
+	case p := <-sendTo:
+		if !u.IsMessage(p.message) {
+			t.Fatal("The bind request packet isn't recognized")
+		}
+		ip, port, err := u.ParseBindRequestPkt(p.message)
+		if err != nil || ip.String() != "203.0.113.7" || port != u.remotePort {
+			t.Error("Unexpected bind request", ip, port, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No bind request packet was sent")
+	}
+
+	// The lifetime of 2 seconds granted by the server makes the mapping renewed every second
+	time.Sleep(1500 * time.Millisecond)
+	requests := server.Requests()
+	if len(requests) < 2 {
+		t.Fatal("The mapping wasn't renewed")
+	}
+	if renewal := requests[1]; renewal.internalPort != 12345 || renewal.suggestedPort != u.remotePort {
+		t.Error("The renewal didn't request the same mapping", renewal)
+	}
+
+	PCPCleanupMapped()
+	requests = server.Requests()
+	if last := requests[len(requests)-1]; last.lifetime != 0 || last.internalPort != 12345 {
+		t.Error("The mapping wasn't deleted", last)
+	}
+	if u.remotePort != 0 || len(pcpMapped) != 0 {
+		t.Error("The mapping is still tracked after the cleanup")
+	}
+}
+
+func TestPCPRefused(t *testing.T) {
+	server := newFakePCPServer(t, 3600)
+	defer server.conn.Close()
+	server.Lock()
+	server.result = 8
+	server.Unlock()
+
+	u := NewPCP()
+	u.server = server.conn.LocalAddr().(*net.UDPAddr)
+	if err := u.AddPortMapping(12345, 30000); err == nil {
+		t.Error("A refused mapping was accepted")
+	}
+
+	if _, err := parsePCPMapResponse(pcpMapRequestPkt(net.IPv4(127, 0, 0, 1), u.nonce, 1, 1, nil, 1), u.nonce); err == nil {
+		t.Error("A request was accepted as a response")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/inverse-inc/packetfence/go/sharedutils"
@@ -42,15 +43,50 @@ type PeerConnection struct {
 
 	try int
 
+	// The random nonce of the current connection attempt and the last one received from the peer, they decide who holds the try without comparing clocks
+	nonce     uint64
+	peerNonce uint64
+
 	bothStunning bool
 	stunPeerConn *net.UDPConn
 
+	// The index of the network connection socket the packets to the peer are sent from, see NetworkConnection.underlayConns
+	// and the amount of sockets tried since packets were last received
+	underlayIndex int
+	failovers     int
+	// The candidates of the peer the connection was checked with, the failovers check them again from the next socket
+	peerCandidates []Candidate
+	// The external ports predicted for the peer when the endpoints were last published to it, see NetworkConnection.PredictPorts
+	predictedPorts     []int
+	predictedPortsLock sync.Mutex
+
+	// The NAT behavior sent in the last network endpoint event
+	publishedNATBehavior NATBehavior
+
 	Status         string
 	ConnectionType string
 
 	networkConnection *NetworkConnection
 
+	// The endpoint of the peer and the local IP used to reach it when the connection was set up
+	pathLock sync.Mutex
+	peerAddr *net.UDPAddr
+	localIP  net.IP
+
 	peerWGConnection net.Conn
+
+	// The nonces of the endpoint events received from the peer
+	replayWindow *replayWindow
+
+	// The private endpoints of the peer found by the LAN discovery
+	lanEndpointChan chan *net.UDPAddr
+
+	stopChan      chan bool
+	stopOnce      sync.Once
+	doneChan      chan bool
+	reconnectChan chan bool
+	// Makes run publish the endpoints of this device again, see RepublishEndpoint
+	republishChan chan bool
 }
 
 func NewPeerConnection(d *device.Device, logger *device.Logger, myProfile Profile, peerProfile PeerProfile, networkConnection *NetworkConnection) *PeerConnection {
@@ -63,7 +99,14 @@ func NewPeerConnection(d *device.Device, logger *device.Logger, myProfile Profil
 		PeerProfile:       peerProfile,
 		networkConnection: networkConnection,
 		launchedAt:        time.Now(),
+		stopChan:          make(chan bool),
+		doneChan:          make(chan bool),
+		reconnectChan:     make(chan bool, 1),
+		republishChan:     make(chan bool, 1),
+		lanEndpointChan:   make(chan *net.UDPAddr, 1),
+		replayWindow:      newReplayWindow(),
 	}
+	pc.nonce = newSessionNonce()
 	return pc
 }
 
@@ -73,10 +116,55 @@ func (pc *PeerConnection) Start() {
 	for {
 		pc.run()
 		pc.reset()
+		if pc.Stopped() {
+			pc.logger.Info.Println("Connection with", pc.peerID, "was stopped")
+			close(pc.doneChan)
+			return
+		}
 		pc.logger.Error.Println("Lost connection with", pc.peerID, ". Reconnecting")
 	}
 }
 
+// Stop tears down the connection to the peer and prevents Start from reconnecting
+// It waits for the peer to be removed from the device so that a new connection to the same peer can be started right after
+func (pc *PeerConnection) Stop() {
+	pc.stopOnce.Do(func() {
+		close(pc.stopChan)
+	})
+	select {
+	case <-pc.doneChan:
+	case <-time.After(10 * time.Second):
+		pc.logger.Error.Println("Timeout waiting for the connection with", pc.peerID, "to stop")
+	}
+}
+
+// Reconnect tears down the current connection to the peer and starts a new one
+func (pc *PeerConnection) Reconnect() {
+	select {
+	case pc.reconnectChan <- true:
+	default:
+		// A reconnection is already pending
+	}
+}
+
+// RepublishEndpoint publishes the endpoints of this device to the connected peer so that it moves to the new public address without reconnecting
+func (pc *PeerConnection) RepublishEndpoint() {
+	select {
+	case pc.republishChan <- true:
+	default:
+		// A publication is already pending
+	}
+}
+
+func (pc *PeerConnection) Stopped() bool {
+	select {
+	case <-pc.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
 func (pc *PeerConnection) reset() {
 	pc.started = false
 	pc.lastKeepalive = time.Time{}
@@ -95,12 +183,25 @@ func (pc *PeerConnection) reset() {
 
 	pc.offersBridging = false
 
+	pc.nonce = newSessionNonce()
+	pc.peerNonce = 0
+
 	if pc.stunPeerConn != nil {
 		pc.stunPeerConn.Close()
 	}
 
 	pc.peerWGConnection = nil
 
+	pc.underlayIndex = 0
+	pc.failovers = 0
+	pc.peerCandidates = nil
+	pc.setPredictedPorts(nil)
+
+	pc.pathLock.Lock()
+	pc.peerAddr = nil
+	pc.localIP = nil
+	pc.pathLock.Unlock()
+
 	pc.lastTX = 0
 	pc.lastRX = 0
 
@@ -118,27 +219,67 @@ func (pc *PeerConnection) run() {
 
 	var peerAddr *net.UDPAddr
 
+	// The endpoint events the peer publishes once connected, nil unless the connection uses the public endpoint of the peer
+	var endpointUpdates chan *NetworkEndpointEvent
+	runDone := make(chan bool)
+	defer close(runDone)
+
 	for {
 		res := func() bool {
 			select {
+			case <-pc.stopChan:
+				return false
+			case <-pc.reconnectChan:
+				pc.logger.Info.Println("Reconnection requested for", pc.peerID)
+				return false
+			case <-pc.republishChan:
+				if pc.started {
+					pc.logger.Info.Println("Publishing the new public address to", pc.peerID)
+					pc.publishNetworkEndpointEvent()
+				}
+			case nee := <-endpointUpdates:
+				if addr := pc.updatePeerEndpoint(nee); addr != nil {
+					peerAddr = addr
+				}
 			case nee := <-peerAddrChan:
 
+				if pc.started {
+					pc.logger.Debug.Println("Ignoring the network endpoint event of", pc.peerID, "since the connection was already started from the LAN")
+					return true
+				}
+
 				if nee == nil {
 					pc.logger.Info.Println("No connection could be established to", pc.peerID)
 					peerAddrChan = nil
 					return true
 				}
 
+				// The event published in return acknowledges the nonce of the peer
+				pc.peerNonce = nee.Nonce
 				pc.logger.Debug.Println("Publishing for peer join", pc.peerID)
-				GLPPublish(pc.PublishP2PKey(), pc.buildNetworkEndpointEvent())
+				pc.publishNetworkEndpointEvent()
 
 				pc.HandleNetworkEndpointEvent(nee)
 
-				pc.ConnectionType = pc.FindConnectionType(nee)
 				var peerStr string
-				if pc.ConnectionType == ConnectionTypeLANIN || pc.ConnectionType == ConnectionTypeLANOUT {
+				if candidate := pc.checkCandidates(nee); candidate != nil {
+					pc.ConnectionType = ConnectionTypeICE
+					peerStr = candidate.Endpoint
+					if candidate.Type == CandidateHost {
+						pc.Status = PEER_STATUS_CONNECT_PRIVATE
+					} else {
+						pc.Status = PEER_STATUS_CONNECT_PUBLIC
+					}
+				} else if pc.ConnectionType = pc.FindConnectionType(nee); pc.ConnectionType == ConnectionTypeLANIN || pc.ConnectionType == ConnectionTypeLANOUT {
 					pc.Status = PEER_STATUS_CONNECT_PRIVATE
-					peerStr = nee.PrivateEndpoint
+					if pc.ConnectionType == ConnectionTypeLANOUT {
+						peerStr = pc.privateEndpoint(nee)
+					} else {
+						peerStr = nee.PrivateEndpoint
+					}
+				} else if pc.ConnectionType == ConnectionTypeWANIPv6 {
+					pc.Status = PEER_STATUS_CONNECT_PUBLIC
+					peerStr = nee.PublicEndpointV6
 				} else {
 					pc.Status = PEER_STATUS_CONNECT_PUBLIC
 					peerStr = nee.PublicEndpoint
@@ -154,6 +295,9 @@ func (pc *PeerConnection) run() {
 				}
 
 				pc.setupPeerConnection(peerStr, peerAddr)
+				if peerStr == nee.PublicEndpoint && usesPeerPublicEndpoint(pc.ConnectionType) {
+					endpointUpdates = pc.watchEndpointUpdates(runDone)
+				}
 
 				pc.started = true
 				pc.try++
@@ -163,18 +307,48 @@ func (pc *PeerConnection) run() {
 					pc.try = 0
 				}
 				pc.lastKeepalive = time.Now()
-				foundPeer <- true
+				select {
+				case foundPeer <- true:
+				case <-pc.stopChan:
+					return false
+				}
+
+			case lanAddr := <-pc.lanEndpointChan:
+				if pc.started {
+					return true
+				}
+
+				pc.logger.Info.Println("Found", pc.peerID, "on the LAN at", lanAddr)
+				peerAddr = lanAddr
+				pc.ConnectionType = ConnectionTypeLANOUT
+				pc.Status = PEER_STATUS_CONNECT_PRIVATE
+				pc.setupPeerConnection(lanAddr.String(), lanAddr)
+
+				pc.started = true
+				pc.lastKeepalive = time.Now()
+				// Stop publishing the endpoints if the connection was also being established through the server
+				if peerAddrChan != nil {
+					select {
+					case foundPeer <- true:
+					case <-pc.stopChan:
+						return false
+					}
+				}
 
 			case <-keepalive:
 				if !pc.CheckConnectionLiveness() {
-					return false
+					addr := pc.failover()
+					if addr == nil {
+						return false
+					}
+					peerAddr = addr
 				}
 
 				if peerAddr != nil {
 					udpSendStr(pingMsg, pc.networkConnection.localConn, peerAddr)
 				}
 
-				if pc.networkConnection.publicAddr != nil && peerAddrChan == nil {
+				if pc.networkConnection.publicAddr != nil && peerAddrChan == nil && !pc.started {
 					pc.logger.Info.Println("Got a public IP address", pc.networkConnection.publicAddr, "for peer", pc.peerID, ". Obtained via", pc.networkConnection.BindTechnique)
 					peerAddrChan = pc.StartConnection(foundPeer)
 				}
@@ -233,7 +407,7 @@ func (pc *PeerConnection) buildP2PKey(key1, key2 string) string {
 }
 
 func (pc *PeerConnection) getPrivateAddr() string {
-	conn, err := net.Dial("udp", stunServer)
+	conn, err := net.Dial("udp4", stunServer)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -241,18 +415,32 @@ func (pc *PeerConnection) getPrivateAddr() string {
 
 	localAddr := conn.LocalAddr().(*net.UDPAddr)
 
-	return fmt.Sprintf("%s:%d", localAddr.IP.String(), localWGPort)
+	return fmt.Sprintf("%s:%d", localAddr.IP.String(), localWGPort())
 }
 
 type NetworkEndpointEvent struct {
-	ID              string        `json:"id"`
-	PublicEndpoint  string        `json:"public_endpoint"`
-	PrivateEndpoint string        `json:"private_endpoint"`
-	Try             int           `json:"try"`
-	BindTechnique   BindTechnique `json:"bind_technique"`
-	OffersBridging  bool          `json:"offers_bridging"`
-	SentOn          time.Time     `json:"sent_on"`
-	LaunchedAt      time.Time     `json:"launched_at"`
+	ID              string `json:"id"`
+	PublicEndpoint  string `json:"public_endpoint"`
+	PrivateEndpoint string `json:"private_endpoint"`
+	// Empty when the peer has no global IPv6 address
+	PublicEndpointV6 string        `json:"public_endpoint_v6,omitempty"`
+	Try              int           `json:"try"`
+	BindTechnique    BindTechnique `json:"bind_technique"`
+	OffersBridging   bool          `json:"offers_bridging"`
+	// Empty when the NAT behavior of the peer isn't known
+	NATMapping   NATMapping   `json:"nat_mapping,omitempty"`
+	NATFiltering NATFiltering `json:"nat_filtering,omitempty"`
+	// Ordered by decreasing priority, empty when the peer doesn't run the connectivity checks
+	Candidates []Candidate `json:"candidates,omitempty"`
+	// A hash of the MAC address of the gateway of the peer, used to detect the peers behind the same NAT, see gatewayHash
+	GatewayHash string `json:"gateway_hash,omitempty"`
+	// The nonce of this event which detects its replays, see replayWindow
+	EventNonce uint64 `json:"event_nonce,omitempty"`
+	// The nonce of the connection attempt of the sender and the one of the receiver it acknowledges, zero when unknown
+	Nonce      uint64    `json:"nonce,omitempty"`
+	AckNonce   uint64    `json:"ack_nonce,omitempty"`
+	SentOn     time.Time `json:"sent_on"`
+	LaunchedAt time.Time `json:"launched_at"`
 }
 
 func (nee NetworkEndpointEvent) ToJSON() []byte {
@@ -261,22 +449,60 @@ func (nee NetworkEndpointEvent) ToJSON() []byte {
 	return b
 }
 
-func (pc *PeerConnection) buildNetworkEndpointEvent() Event {
-	return Event{Type: "network_endpoint", Data: NetworkEndpointEvent{
-		ID:              pc.MyProfile.PublicKey,
-		PublicEndpoint:  pc.networkConnection.publicAddr.String(),
-		PrivateEndpoint: pc.getPrivateAddr(),
-		Try:             pc.try,
-		BindTechnique:   pc.networkConnection.BindTechnique,
-		OffersBridging:  sharedutils.EnvOrDefault(EnvOffersBridging, "false") == "true",
-		SentOn:          time.Now(),
-		LaunchedAt:      pc.launchedAt,
-	}.ToJSON()}
+func (pc *PeerConnection) buildNetworkEndpointEvent() NetworkEndpointEvent {
+	publicEndpointV6 := ""
+	if addr := pc.networkConnection.GetPublicAddrV6(); addr != nil {
+		publicEndpointV6 = addr.String()
+	}
+	// The connection type is chosen using the behavior the peer knows about
+	pc.publishedNATBehavior = pc.networkConnection.GetNATBehavior()
+
+	// The ports are predicted again for each peer since the connections to the other peers used up the previous ones
+	publicAddr := pc.networkConnection.GetPublicAddr()
+	predictedPorts := pc.networkConnection.PredictPorts()
+	pc.setPredictedPorts(predictedPorts)
+	publicEndpoint := publicAddr.String()
+	if publicAddr != nil && len(predictedPorts) > 0 {
+		publicEndpoint = (&net.UDPAddr{IP: publicAddr.IP, Port: predictedPorts[0]}).String()
+	}
+
+	return NetworkEndpointEvent{
+		ID:               pc.MyProfile.PublicKey,
+		PublicEndpoint:   publicEndpoint,
+		PrivateEndpoint:  pc.getPrivateAddr(),
+		PublicEndpointV6: publicEndpointV6,
+		Try:              pc.try,
+		Nonce:            pc.nonce,
+		AckNonce:         pc.peerNonce,
+		BindTechnique:    pc.networkConnection.BindTechnique,
+		OffersBridging:   GetConfig().OffersBridging,
+		NATMapping:       pc.publishedNATBehavior.Mapping,
+		NATFiltering:     pc.publishedNATBehavior.Filtering,
+		Candidates:       pc.localCandidates(),
+		GatewayHash:      pc.localGatewayHash(),
+		SentOn:           time.Now(),
+		LaunchedAt:       pc.launchedAt,
+	}
+}
+
+// publishNetworkEndpointEvent publishes the endpoints of this device to the peer
+// When accept_unsealed_endpoint_events is enabled, a copy that isn't sealed follows for the peers running a previous version
+// Only the configuration decides it, never the events received from the peer since nothing authenticates the ones that aren't sealed
+func (pc *PeerConnection) publishNetworkEndpointEvent() {
+	nee := pc.buildNetworkEndpointEvent()
+	e, err := sealNetworkEndpointEvent(nee, pc.MyProfile.PrivateKey, pc.PeerProfile.PublicKey)
+	sharedutils.CheckError(err)
+	GLPPublish(pc.PublishP2PKey(), e)
+
+	if GetConfig().AcceptUnsealedEndpointEvents {
+		GLPPublish(pc.PublishP2PKey(), Event{Type: EventTypeNetworkEndpoint, Data: nee.ToJSON()})
+	}
 }
 
 func (pc *PeerConnection) getPeerAddr() chan *NetworkEndpointEvent {
-	result := make(chan *NetworkEndpointEvent)
-	myID := pc.MyProfile.PublicKey
+	// Buffered so that this doesn't block forever if the peer connection is stopped before reading the result
+	result := make(chan *NetworkEndpointEvent, 1)
+	nonce := pc.nonce
 
 	p2pk := pc.ListenP2PKey()
 
@@ -287,22 +513,22 @@ func (pc *PeerConnection) getPeerAddr() chan *NetworkEndpointEvent {
 		maxWait := time.After(PublicPortLivenessTolerance)
 		for {
 			select {
+			case <-pc.stopChan:
+				return
 			case <-maxWait:
 				result <- nil
 				return
 			case e := <-c.EventsChan:
-				event := Event{}
-				err := json.Unmarshal(e.Data, &event)
-				sharedutils.CheckError(err)
-				if event.Type == "network_endpoint" {
-					nee := NetworkEndpointEvent{}
-					err = json.Unmarshal(event.Data, &nee)
-					sharedutils.CheckError(err)
-					if nee.ID != myID {
-						result <- &nee
-						return
-					}
+				nee := pc.readNetworkEndpointEvent(e.Data)
+				if nee == nil {
+					continue
+				}
+				if staleNetworkEndpointEvent(nee, nonce) {
+					pc.logger.Debug.Println("Ignoring a network endpoint event of", pc.peerID, "that answers a previous connection attempt")
+					continue
 				}
+				result <- nee
+				return
 			}
 		}
 	}()
@@ -310,24 +536,140 @@ func (pc *PeerConnection) getPeerAddr() chan *NetworkEndpointEvent {
 	return result
 }
 
-func (pc *PeerConnection) IAmTheBestTryHolder(nee *NetworkEndpointEvent) bool {
-	return pc.launchedAt.Before(nee.LaunchedAt)
+// watchEndpointUpdates returns the endpoint events the peer publishes during the current connection, it does so when its public address changes
+// The events of another connection attempt of the peer are ignored, the peer connects again in that case
+func (pc *PeerConnection) watchEndpointUpdates(done chan bool) chan *NetworkEndpointEvent {
+	updates := make(chan *NetworkEndpointEvent)
+	nonce := pc.nonce
+	peerNonce := pc.peerNonce
+
+	p2pk := pc.ListenP2PKey()
+
+	go func() {
+		c := GLPClient(p2pk)
+		c.Start(APIClientCtx)
+		defer c.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case e := <-c.EventsChan:
+				nee := pc.readNetworkEndpointEvent(e.Data)
+				if nee == nil || nee.Nonce != peerNonce || staleNetworkEndpointEvent(nee, nonce) {
+					continue
+				}
+				select {
+				case updates <- nee:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return updates
 }
 
-func (pc *PeerConnection) HandleNetworkEndpointEvent(nee *NetworkEndpointEvent) {
-	pc.logger.Info.Printf("Received network endpoint event dated from %s. Remote info: (launched at:%s) (bind technique:%s) (can offer bridging:%t) (public endpoint:%s) (private endpoint %s) (try ID %d)", nee.LaunchedAt, nee.SentOn, nee.BindTechnique, nee.OffersBridging, nee.PublicEndpoint, nee.PrivateEndpoint, nee.Try)
+// readNetworkEndpointEvent decodes an endpoint event received from the peer, it returns nil when the event must be dropped
+func (pc *PeerConnection) readNetworkEndpointEvent(data []byte) *NetworkEndpointEvent {
+	event := Event{}
+	err := json.Unmarshal(data, &event)
+	sharedutils.CheckError(err)
+	switch event.Type {
+	case EventTypeNetworkEndpoint:
+		if !GetConfig().AcceptUnsealedEndpointEvents {
+			pc.logger.Info.Println("Dropping a network endpoint event of", pc.peerID, "that isn't sealed")
+			return nil
+		}
+		nee := &NetworkEndpointEvent{}
+		if err := json.Unmarshal(event.Data, nee); err != nil {
+			pc.logger.Error.Println("Dropping an invalid network endpoint event of", pc.peerID, ":", err)
+			return nil
+		}
+		if err := pc.replayWindow.CheckUnsealed(nee, event.Data, pc.PeerProfile.PublicKey, time.Now()); err != nil {
+			pc.logger.Info.Println("Dropping a network endpoint event of", pc.peerID, ":", err)
+			return nil
+		}
+		pc.logger.Debug.Println("Accepting a network endpoint event of", pc.peerID, "that isn't sealed")
+		return nee
+	case EventTypeSealedNetworkEndpoint:
+		nee, err := openNetworkEndpointEvent(event, pc.MyProfile.PrivateKey, pc.PeerProfile.PublicKey)
+		if err != nil {
+			pc.logger.Info.Println("Dropping a network endpoint event that doesn't authenticate:", err)
+			return nil
+		}
+		if err := pc.replayWindow.Check(nee, time.Now()); err != nil {
+			pc.logger.Info.Println("Dropping a network endpoint event of", pc.peerID, ":", err)
+			return nil
+		}
+		return nee
+	}
+	return nil
+}
+
+// usesPeerPublicEndpoint returns whether this device sends the packets of the connection type to the public endpoint of the peer
+func usesPeerPublicEndpoint(connectionType string) bool {
+	return connectionType == ConnectionTypeWANOUT || connectionType == ConnectionTypeWANSTUN || connectionType == ConnectionTypeICE
+}
+
+// updatePeerEndpoint sends the packets to the new public endpoint of the peer without tearing down the connection
+// It returns the new endpoint or nil when it didn't change
+func (pc *PeerConnection) updatePeerEndpoint(nee *NetworkEndpointEvent) *net.UDPAddr {
+	addr, err := net.ResolveUDPAddr(udp, nee.PublicEndpoint)
+	if err != nil || addr.Port == 0 {
+		pc.logger.Debug.Println("Ignoring the invalid public endpoint", nee.PublicEndpoint, "of", pc.peerID)
+		return nil
+	}
 
+	if len(nee.Candidates) > 0 {
+		pc.peerCandidates = nee.Candidates
+	}
+
+	pc.pathLock.Lock()
+	if pc.peerAddr != nil && sameUDPAddr(pc.peerAddr, addr) {
+		pc.pathLock.Unlock()
+		return nil
+	}
+	pc.logger.Info.Println("The public endpoint of", pc.peerID, "moved from", pc.peerAddr, "to", addr, ", updating the connection in place")
+	pc.peerAddr = addr
+	pc.localIP, _ = localIPTowards(addr)
+	pc.pathLock.Unlock()
+
+	switch pc.ConnectionType {
+	case ConnectionTypeWANOUT:
+		SetConfigMulti(pc.device, fmt.Sprintf("public_key=%s\nendpoint=%s\n", keyToHex(pc.PeerProfile.PublicKey), addr))
+	case ConnectionTypeWANSTUN, ConnectionTypeICE:
+		pc.networkConnection.setBridge(pc.stunPeerConn.LocalAddr().String(), &bridge{conn: pc.underlayConn(), raddr: addr})
+	}
+	return addr
+}
+
+// IAmTheBestTryHolder returns whether the try of this device is used by both peers
+// The peers that don't send a nonce are compared using their launch time, which requires their clocks to agree
+func (pc *PeerConnection) IAmTheBestTryHolder(nee *NetworkEndpointEvent) bool {
+	if nee.Nonce == 0 {
+		return pc.launchedAt.Before(nee.LaunchedAt)
+	}
+	return holdsBestTry(pc.nonce, nee.Nonce, pc.IAmTheSmallestKey())
+}
+
+// negotiateTry adopts the try of the peer when it holds the best try
+func (pc *PeerConnection) negotiateTry(nee *NetworkEndpointEvent) {
 	if pc.IAmTheBestTryHolder(nee) {
 		pc.logger.Info.Println("Using my own try")
-		// I know this is pretty useless but I just wanted to make it explicit
-		pc.try = pc.try
 	} else {
 		pc.logger.Info.Println("Using try from peer")
 		pc.try = nee.Try
 	}
 	pc.logger.Info.Println("Using try ID", pc.try)
+}
+
+func (pc *PeerConnection) HandleNetworkEndpointEvent(nee *NetworkEndpointEvent) {
+	pc.logger.Info.Printf("Received network endpoint event dated from %s. Remote info: (launched at:%s) (bind technique:%s) (can offer bridging:%t) (public endpoint:%s) (private endpoint %s) (IPv6 endpoint %s) (NAT mapping:%s) (NAT filtering:%s) (try ID %d) (nonce %d)", nee.LaunchedAt, nee.SentOn, nee.BindTechnique, nee.OffersBridging, nee.PublicEndpoint, nee.PrivateEndpoint, nee.PublicEndpointV6, nee.NATMapping, nee.NATFiltering, nee.Try, nee.Nonce)
 
-	if nee.BindTechnique == BindSTUN && pc.networkConnection.BindTechnique == BindSTUN {
+	pc.negotiateTry(nee)
+
+	if holePunches(nee.BindTechnique) && holePunches(pc.networkConnection.BindTechnique) {
 		pc.logger.Debug.Println("Self and peer are using STUN to connect")
 		pc.bothStunning = true
 	} else {
@@ -335,6 +677,87 @@ func (pc *PeerConnection) HandleNetworkEndpointEvent(nee *NetworkEndpointEvent)
 		pc.bothStunning = false
 	}
 	pc.offersBridging = nee.OffersBridging
+
+	if pc.SameNAT(nee) {
+		pc.logger.Info.Println("The peer", pc.peerID, "is behind the same NAT, trying the LAN connection types first")
+	}
+}
+
+func (pc *PeerConnection) setPredictedPorts(ports []int) {
+	pc.predictedPortsLock.Lock()
+	defer pc.predictedPortsLock.Unlock()
+	pc.predictedPorts = ports
+}
+
+// localCandidates returns the candidates of this device for the peer, they include the ports predicted when the endpoints were last published to it
+func (pc *PeerConnection) localCandidates() []Candidate {
+	pc.predictedPortsLock.Lock()
+	defer pc.predictedPortsLock.Unlock()
+	return withPredictedCandidates(pc.networkConnection.Candidates(), pc.networkConnection.GetPublicAddr(), pc.predictedPorts)
+}
+
+// checkCandidates runs the connectivity checks with the candidates of the peer and returns the remote candidate of the best working pair
+// The packets to the peer are then sent from the socket the pair was checked from
+// It returns nil when either side has no candidates or when no pair works so that the connection types are tried instead
+func (pc *PeerConnection) checkCandidates(nee *NetworkEndpointEvent) *Candidate {
+	local := pc.localCandidates()
+	if len(local) == 0 || len(nee.Candidates) == 0 {
+		return nil
+	}
+
+	// The peer with the smallest key is the controlling agent so both sides compute the same pair priorities
+	raddr, conn, err := pc.networkConnection.CheckCandidates(local, nee.Candidates, pc.IAmTheSmallestKey())
+	if err != nil {
+		pc.logger.Info.Println("Connectivity checks with", pc.peerID, "failed:", err)
+		return nil
+	}
+	pc.peerCandidates = nee.Candidates
+	for i, c := range pc.networkConnection.underlayConns() {
+		if c == conn {
+			pc.underlayIndex = i
+		}
+	}
+
+	for _, c := range nee.Candidates {
+		if addr, err := net.ResolveUDPAddr(udp, c.Endpoint); err == nil && sameUDPAddr(addr, raddr) {
+			pc.logger.Info.Println("Selected the", c.Type, "candidate", c.Endpoint, "of", pc.peerID)
+			return &c
+		}
+	}
+	return nil
+}
+
+// PathChanged returns whether the connection to the peer must be established again after a network change
+// The connections that aren't established yet are always established again so they publish the new endpoints
+func (pc *PeerConnection) PathChanged(networkConnectionRebound bool) bool {
+	if !pc.Connected() {
+		return true
+	}
+
+	// These connection types go through the public port of the network connection
+	switch pc.ConnectionType {
+	case ConnectionTypeWANIN, ConnectionTypeWANSTUN, ConnectionTypeICE:
+		if networkConnectionRebound {
+			return true
+		}
+	}
+
+	pc.pathLock.Lock()
+	defer pc.pathLock.Unlock()
+	if pc.peerAddr == nil {
+		return true
+	}
+	localIP, err := localIPTowards(pc.peerAddr)
+	return err != nil || !localIP.Equal(pc.localIP)
+}
+
+// HandleLANEndpoint connects to the peer using a private endpoint found on the LAN, it is ignored once the connection is started
+func (pc *PeerConnection) HandleLANEndpoint(addr *net.UDPAddr) {
+	select {
+	case pc.lanEndpointChan <- addr:
+	default:
+		// An endpoint is already pending
+	}
 }
 
 func (pc *PeerConnection) IAmTheSmallestKey() bool {
@@ -347,7 +770,7 @@ func (pc *PeerConnection) Connected() bool {
 
 func (pc *PeerConnection) StartConnection(foundPeer chan bool) chan *NetworkEndpointEvent {
 	go func() {
-		GLPPublish(pc.PublishP2PKey(), pc.buildNetworkEndpointEvent())
+		pc.publishNetworkEndpointEvent()
 		after := []time.Duration{
 			300 * time.Second,
 		}
@@ -357,10 +780,12 @@ func (pc *PeerConnection) StartConnection(foundPeer chan bool) chan *NetworkEndp
 			case <-time.After(after[i%len(after)]):
 				i++
 				pc.logger.Debug.Println("Publishing IP for discovery with peer", pc.peerID)
-				GLPPublish(pc.PublishP2PKey(), pc.buildNetworkEndpointEvent())
+				pc.publishNetworkEndpointEvent()
 			case <-foundPeer:
 				pc.logger.Info.Println("Found peer", pc.peerID, ", stopping the publishing")
 				return
+			case <-pc.stopChan:
+				return
 			}
 		}
 	}()
@@ -369,6 +794,11 @@ func (pc *PeerConnection) StartConnection(foundPeer chan bool) chan *NetworkEndp
 }
 
 func (pc *PeerConnection) setupPeerConnection(peerStr string, peerAddr *net.UDPAddr) {
+	pc.pathLock.Lock()
+	pc.peerAddr = peerAddr
+	pc.localIP, _ = localIPTowards(peerAddr)
+	pc.pathLock.Unlock()
+
 	conf := ""
 
 	conf += fmt.Sprintf("public_key=%s\n", keyToHex(pc.PeerProfile.PublicKey))
@@ -377,18 +807,21 @@ func (pc *PeerConnection) setupPeerConnection(peerStr string, peerAddr *net.UDPA
 		conf += fmt.Sprintf("endpoint=%s\n", peerStr)
 	case ConnectionTypeLANIN:
 		//Nothing to do
-	case ConnectionTypeWANSTUN:
-		go func() {
-			pc.networkConnection.RecordInboundAttempt()
-		}()
+	case ConnectionTypeWANSTUN, ConnectionTypeICE:
+		// The pairs of the connectivity checks were already seen working in both directions
+		if pc.ConnectionType == ConnectionTypeWANSTUN {
+			go func() {
+				pc.networkConnection.RecordInboundAttempt()
+			}()
+		}
 		var err error
 		pc.stunPeerConn, err = net.ListenUDP(udp, nil)
 		sharedutils.CheckError(err)
 		pc.networkConnection.listen(pc.stunPeerConn, pc.networkConnection.messageChan)
-		pc.networkConnection.peerConnections[pc.stunPeerConn.LocalAddr().String()] = &bridge{conn: pc.networkConnection.localConn, raddr: peerAddr}
+		pc.networkConnection.setBridge(pc.stunPeerConn.LocalAddr().String(), &bridge{conn: pc.underlayConn(), raddr: peerAddr})
 		a := strings.Split(pc.stunPeerConn.LocalAddr().String(), ":")
 		conf += fmt.Sprintf("endpoint=%s\n", fmt.Sprintf("127.0.0.1:%s", a[len(a)-1]))
-	case ConnectionTypeWANOUT:
+	case ConnectionTypeWANOUT, ConnectionTypeWANIPv6:
 		conf += fmt.Sprintf("endpoint=%s\n", peerStr)
 	case ConnectionTypeWANIN:
 		go func() {
@@ -445,6 +878,7 @@ func (pc *PeerConnection) CheckConnectionLiveness() bool {
 					pc.connectedInbound = true
 					pc.lastInboundPacket = time.Now()
 					pc.lastRX = stats.RX
+					pc.failovers = 0
 				} else if time.Since(pc.lastInboundPacket) > pc.ConnectionLivenessTolerance() {
 					if pc.connectedInbound {
 						pc.logger.Error.Println("Inbound connection lost to", pc.peerID)
@@ -458,6 +892,78 @@ func (pc *PeerConnection) CheckConnectionLiveness() bool {
 	return result
 }
 
+// underlayConn returns the socket of the network connection the packets to the peer are sent from
+func (pc *PeerConnection) underlayConn() *net.UDPConn {
+	conns := pc.networkConnection.underlayConns()
+	if pc.underlayIndex < len(conns) {
+		return conns[pc.underlayIndex]
+	}
+	return conns[0]
+}
+
+// failover sends the packets to the peer from the next underlay socket that passes a connectivity check and returns the endpoint of the peer it reaches
+// The candidates of the peer are checked from the socket since the peer may only be reachable on another endpoint through that path
+// Only the connections that go through the network connection can fail over, the others are established again and nil is returned
+func (pc *PeerConnection) failover() *net.UDPAddr {
+	if pc.ConnectionType != ConnectionTypeICE && pc.ConnectionType != ConnectionTypeWANSTUN {
+		return nil
+	}
+
+	conns := pc.networkConnection.underlayConns()
+	for next := nextUnderlayIndex(pc.underlayIndex, len(conns), pc.failovers); next != -1; next = nextUnderlayIndex(next, len(conns), pc.failovers) {
+		pc.failovers++
+		peerAddr := pc.checkFrom(conns[next])
+		if peerAddr == nil {
+			pc.logger.Info.Println("No endpoint of", pc.peerID, "answered the connectivity checks from", conns[next].LocalAddr())
+			continue
+		}
+
+		pc.logger.Info.Println("Failing over the connection to", pc.peerID, "to", conns[next].LocalAddr(), "towards", peerAddr)
+		pc.pathLock.Lock()
+		pc.peerAddr = peerAddr
+		pc.localIP, _ = localIPTowards(peerAddr)
+		pc.pathLock.Unlock()
+		pc.networkConnection.setBridge(pc.stunPeerConn.LocalAddr().String(), &bridge{conn: conns[next], raddr: peerAddr})
+		pc.underlayIndex = next
+
+		// Give the new path the same tolerance as a new connection
+		pc.connectedInbound = true
+		pc.lastInboundPacket = time.Now()
+		pc.connectedOutbound = true
+		pc.lastOutboundPacket = time.Now()
+		return peerAddr
+	}
+	return nil
+}
+
+// checkFrom runs the connectivity checks from conn with the candidates of the peer, or its current endpoint when it has none
+// It returns the endpoint of the best pair that answered or nil
+func (pc *PeerConnection) checkFrom(conn *net.UDPConn) *net.UDPAddr {
+	local := []Candidate{}
+	for _, c := range pc.localCandidates() {
+		if pc.networkConnection.candidateConn(c) == conn {
+			local = append(local, c)
+		}
+	}
+
+	remote := pc.peerCandidates
+	if len(remote) == 0 {
+		pc.pathLock.Lock()
+		peerAddr := pc.peerAddr
+		pc.pathLock.Unlock()
+		if peerAddr == nil {
+			return nil
+		}
+		remote = []Candidate{{Type: CandidateServerReflexive, Endpoint: peerAddr.String(), Priority: candidatePriority(CandidateServerReflexive, 65535)}}
+	}
+
+	raddr, _, err := pc.networkConnection.CheckCandidates(local, remote, pc.IAmTheSmallestKey())
+	if err != nil {
+		return nil
+	}
+	return raddr
+}
+
 func (pc *PeerConnection) OffersBridging() bool {
 	return pc.offersBridging
 }
@@ -480,24 +986,99 @@ func (pc *PeerConnection) IAmTheBestWANIN(nee *NetworkEndpointEvent) bool {
 }
 
 func (pc *PeerConnection) FindConnectionType(nee *NetworkEndpointEvent) string {
-	tryMod := pc.try % 6
-
-	switch tryMod {
-	case 0:
-		return pc.connectionTypeWan1(nee)
-	case 1:
-		return pc.connectionTypeLan1(nee)
-	case 2:
-		return pc.connectionTypeWan2(nee)
-	case 3:
-		return pc.connectionTypeLan2(nee)
-	case 4:
-		return pc.connectionTypeWan1(nee)
-	case 5:
-		return pc.connectionTypeWan2(nee)
+	plan := pc.connectionPlan(nee)
+	return plan[pc.try%len(plan)](nee)
+}
+
+// connectionPlan returns the order in which the connection types are tried, both peers must compute the same order for a try to use complementary types
+// The order is only based on the NAT behaviors when both peers published theirs, otherwise all the types are cycled through
+// The LAN types come first when both peers are behind the same NAT
+func (pc *PeerConnection) connectionPlan(nee *NetworkEndpointEvent) []func(*NetworkEndpointEvent) string {
+	var plan []func(*NetworkEndpointEvent) string
+	mine := pc.publishedNATBehavior
+	theirs := NATBehavior{Mapping: nee.NATMapping, Filtering: nee.NATFiltering}
+
+	if mine.Known() && theirs.Known() {
+		plan = pc.natAwareConnectionPlan(nee, mine, theirs)
+		// IPv6 addresses don't go through a NAT so they are tried first, the other techniques remain for when IPv6 is filtered
+		if pc.BothHaveIPv6(nee) {
+			plan = append([]func(*NetworkEndpointEvent) string{pc.connectionTypeIPv6}, plan...)
+		}
+	} else {
+		plan = []func(*NetworkEndpointEvent) string{
+			pc.connectionTypeWan1,
+			pc.connectionTypeLan1,
+			pc.connectionTypeWan2,
+			pc.connectionTypeLan2,
+			pc.connectionTypeWan1,
+			pc.connectionTypeWan2,
+		}
+		if pc.BothHaveIPv6(nee) {
+			plan[0] = pc.connectionTypeIPv6
+		}
+	}
+	// Most routers don't hairpin the packets sent to their own public IP so the peers behind the same NAT must use their private endpoints
+	if pc.SameNAT(nee) {
+		plan = append([]func(*NetworkEndpointEvent) string{pc.connectionTypeLan1, pc.connectionTypeLan2}, plan...)
+	}
+	return plan
+}
+
+func (pc *PeerConnection) natAwareConnectionPlan(nee *NetworkEndpointEvent, mine, theirs NATBehavior) []func(*NetworkEndpointEvent) string {
+	if pc.bothStunning {
+		// The hole punching only works when both NATs reuse the address seen by the STUN server
+		if canHolePunch(mine) && canHolePunch(theirs) {
+			return []func(*NetworkEndpointEvent) string{pc.connectionTypeWan1, pc.connectionTypeLan1, pc.connectionTypeWan1, pc.connectionTypeLan2}
+		}
+		return []func(*NetworkEndpointEvent) string{pc.connectionTypeLan1, pc.connectionTypeLan2, pc.connectionTypeWan1}
+	}
+
+	// WAN1 has the best WAN IN peer receive the connection and WAN2 has the other one receive it
+	myReceivable := canReceiveInbound(pc.networkConnection.BindTechnique, mine)
+	theirReceivable := canReceiveInbound(nee.BindTechnique, theirs)
+	bestReceivable, otherReceivable := theirReceivable, myReceivable
+	if pc.IAmTheBestWANIN(nee) {
+		bestReceivable, otherReceivable = myReceivable, theirReceivable
+	}
+
+	switch {
+	case bestReceivable && otherReceivable:
+		return []func(*NetworkEndpointEvent) string{pc.connectionTypeWan1, pc.connectionTypeWan2, pc.connectionTypeLan1, pc.connectionTypeLan2}
+	case bestReceivable:
+		return []func(*NetworkEndpointEvent) string{pc.connectionTypeWan1, pc.connectionTypeLan1, pc.connectionTypeLan2, pc.connectionTypeWan2}
+	case otherReceivable:
+		return []func(*NetworkEndpointEvent) string{pc.connectionTypeWan2, pc.connectionTypeLan1, pc.connectionTypeLan2, pc.connectionTypeWan1}
 	default:
-		panic("Unknown modulo when trying to find connection type")
+		return []func(*NetworkEndpointEvent) string{pc.connectionTypeLan1, pc.connectionTypeLan2, pc.connectionTypeWan1, pc.connectionTypeWan2}
+	}
+}
+
+// canReceiveInbound returns whether a peer can receive packets on its public endpoint from an address it never sent to
+func canReceiveInbound(bt BindTechnique, behavior NATBehavior) bool {
+	if !holePunches(bt) {
+		// The other techniques open or forward a port
+		return true
 	}
+	return behavior.Filtering == NATFilteringEndpointIndependent
+}
+
+// holePunches returns whether the bind technique relies on the outbound packets to open the NAT, the predicted ports are punched the same way as the STUN address
+func holePunches(bt BindTechnique) bool {
+	return bt == BindSTUN || bt == BindPortPrediction
+}
+
+// canHolePunch returns whether the NAT uses the same public address for all the destinations
+func canHolePunch(behavior NATBehavior) bool {
+	return behavior.Mapping == NATMappingNone || behavior.Mapping == NATMappingEndpointIndependent
+}
+
+func (pc *PeerConnection) connectionTypeIPv6(nee *NetworkEndpointEvent) string {
+	return ConnectionTypeWANIPv6
+}
+
+// BothHaveIPv6 returns whether this device and the peer can reach each other directly over IPv6
+func (pc *PeerConnection) BothHaveIPv6(nee *NetworkEndpointEvent) bool {
+	return pc.networkConnection.GetPublicAddrV6() != nil && nee.PublicEndpointV6 != ""
 }
 
 func (pc *PeerConnection) connectionTypeLan1(nee *NetworkEndpointEvent) string {
@@ -540,7 +1121,7 @@ func (pc *PeerConnection) pingWGInterface() {
 	var err error
 	if pc.peerWGConnection == nil {
 		//TODO: perhaps use another port since this is gratuitous pinging and we don't want a reply
-		pc.peerWGConnection, err = net.Dial("udp", fmt.Sprintf("%s:%d", pc.PeerProfile.WireguardIP, localWGPort))
+		pc.peerWGConnection, err = net.Dial("udp", fmt.Sprintf("%s:%d", pc.PeerProfile.WireguardIP, localWGPort()))
 		sharedutils.CheckError(err)
 	}
 	_, err = pc.peerWGConnection.Write([]byte(pingMsg))
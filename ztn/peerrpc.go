@@ -12,6 +12,8 @@ import (
 
 const PeerServiceServerPort = 12676
 
+var PeerServer *PeerServiceServerHandler
+
 func ConnectPeerServiceClient(addr string) (PeerServiceClient, *grpc.ClientConn) {
 	conn, err := grpc.Dial(
 		addr,
@@ -22,12 +24,12 @@ func ConnectPeerServiceClient(addr string) (PeerServiceClient, *grpc.ClientConn)
 	return client, conn
 }
 
-func StartPeerServiceRPC(ip net.IP, logger *device.Logger, profile Profile) {
+func StartPeerServiceRPC(ip net.IP, logger *device.Logger, profile Profile, d *device.Device) {
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", ip, PeerServiceServerPort))
 	sharedutils.CheckError(err)
 	grpcServer := grpc.NewServer()
 
-	PeerServer := NewPeerServiceServerHandler(logger, profile)
+	PeerServer = NewPeerServiceServerHandler(logger, profile, d)
 	RegisterPeerServiceServer(grpcServer, PeerServer)
 
 	reflection.Register(grpcServer)
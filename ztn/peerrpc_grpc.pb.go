@@ -20,6 +20,8 @@ type PeerServiceClient interface {
 	CanOfferForwarding(ctx context.Context, in *CanOfferForwardingRequest, opts ...grpc.CallOption) (*CanOfferForwardingReply, error)
 	SetupForwarding(ctx context.Context, in *SetupForwardingRequest, opts ...grpc.CallOption) (*SetupForwardingReply, error)
 	ForwardingIsAlive(ctx context.Context, in *ForwardingIsAliveRequest, opts ...grpc.CallOption) (*ForwardingIsAliveReply, error)
+	GetBridgeCapacity(ctx context.Context, in *BridgeCapacityRequest, opts ...grpc.CallOption) (*BridgeCapacityReply, error)
+	StopForwarding(ctx context.Context, in *StopForwardingRequest, opts ...grpc.CallOption) (*StopForwardingReply, error)
 }
 
 type peerServiceClient struct {
@@ -57,6 +59,24 @@ func (c *peerServiceClient) ForwardingIsAlive(ctx context.Context, in *Forwardin
 	return out, nil
 }
 
+func (c *peerServiceClient) GetBridgeCapacity(ctx context.Context, in *BridgeCapacityRequest, opts ...grpc.CallOption) (*BridgeCapacityReply, error) {
+	out := new(BridgeCapacityReply)
+	err := c.cc.Invoke(ctx, "/PeerService/GetBridgeCapacity", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *peerServiceClient) StopForwarding(ctx context.Context, in *StopForwardingRequest, opts ...grpc.CallOption) (*StopForwardingReply, error) {
+	out := new(StopForwardingReply)
+	err := c.cc.Invoke(ctx, "/PeerService/StopForwarding", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PeerServiceServer is the server API for PeerService service.
 // All implementations must embed UnimplementedPeerServiceServer
 // for forward compatibility
@@ -64,6 +84,8 @@ type PeerServiceServer interface {
 	CanOfferForwarding(context.Context, *CanOfferForwardingRequest) (*CanOfferForwardingReply, error)
 	SetupForwarding(context.Context, *SetupForwardingRequest) (*SetupForwardingReply, error)
 	ForwardingIsAlive(context.Context, *ForwardingIsAliveRequest) (*ForwardingIsAliveReply, error)
+	GetBridgeCapacity(context.Context, *BridgeCapacityRequest) (*BridgeCapacityReply, error)
+	StopForwarding(context.Context, *StopForwardingRequest) (*StopForwardingReply, error)
 	mustEmbedUnimplementedPeerServiceServer()
 }
 
@@ -80,6 +102,12 @@ func (UnimplementedPeerServiceServer) SetupForwarding(context.Context, *SetupFor
 func (UnimplementedPeerServiceServer) ForwardingIsAlive(context.Context, *ForwardingIsAliveRequest) (*ForwardingIsAliveReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ForwardingIsAlive not implemented")
 }
+func (UnimplementedPeerServiceServer) GetBridgeCapacity(context.Context, *BridgeCapacityRequest) (*BridgeCapacityReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBridgeCapacity not implemented")
+}
+func (UnimplementedPeerServiceServer) StopForwarding(context.Context, *StopForwardingRequest) (*StopForwardingReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopForwarding not implemented")
+}
 func (UnimplementedPeerServiceServer) mustEmbedUnimplementedPeerServiceServer() {}
 
 // UnsafePeerServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -147,6 +175,42 @@ func _PeerService_ForwardingIsAlive_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PeerService_GetBridgeCapacity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BridgeCapacityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).GetBridgeCapacity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/PeerService/GetBridgeCapacity",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).GetBridgeCapacity(ctx, req.(*BridgeCapacityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PeerService_StopForwarding_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopForwardingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PeerServiceServer).StopForwarding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/PeerService/StopForwarding",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PeerServiceServer).StopForwarding(ctx, req.(*StopForwardingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _PeerService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "PeerService",
 	HandlerType: (*PeerServiceServer)(nil),
@@ -163,6 +227,14 @@ var _PeerService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ForwardingIsAlive",
 			Handler:    _PeerService_ForwardingIsAlive_Handler,
 		},
+		{
+			MethodName: "GetBridgeCapacity",
+			Handler:    _PeerService_GetBridgeCapacity_Handler,
+		},
+		{
+			MethodName: "StopForwarding",
+			Handler:    _PeerService_StopForwarding_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "peerrpc.proto",
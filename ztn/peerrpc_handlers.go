@@ -2,59 +2,206 @@ package ztn
 
 import (
 	context "context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"sort"
 	sync "sync"
 	"time"
 
 	"github.com/inverse-inc/packetfence/go/sharedutils"
 	"github.com/inverse-inc/wireguard-go/device"
+	"google.golang.org/grpc/peer"
 )
 
+// relayCaller is a peer that uses the peer service of this device
+type relayCaller struct {
+	peerID   string
+	hostname string
+	ip       net.IP
+}
+
+func (c relayCaller) String() string {
+	return fmt.Sprintf("%s (%s, %s)", c.hostname, c.peerID, c.ip)
+}
+
+// How often the traffic of the bridges is reported to the server
+var bridgeStatsInterval = 5 * time.Minute
+
+// The category of the events reporting the traffic of the bridges to the server
+const bridgeStatsCategory = "bridge_stats"
+
+// peerBridge is a network connection that bridges for a peer
+type peerBridge struct {
+	nc             *NetworkConnection
+	caller         relayCaller
+	connectionType string
+	since          time.Time
+}
+
+func (b *peerBridge) stats() BridgeStats {
+	stats := BridgeStats{
+		PeerID:         b.caller.peerID,
+		Hostname:       b.caller.hostname,
+		IP:             b.caller.ip.String(),
+		ConnectionType: b.connectionType,
+		Since:          b.since,
+	}
+	b.nc.shaper.fillStats(&stats)
+	return stats
+}
+
 type PeerServiceServerHandler struct {
 	sync.Mutex
 	UnimplementedPeerServiceServer
-	logger         *device.Logger
-	peerBridges    map[uint64]*NetworkConnection
-	profile        Profile
-	maxPeerBridges int
+	logger *device.Logger
+	// Where the bridges set up and torn down are logged along with the peers they bridge for
+	audit                 *device.Logger
+	peerBridges           map[uint64]*peerBridge
+	profile               Profile
+	connection            *Connection
+	maxPeerBridges        int
+	maxPeerBridgesPerPeer int
+	maxPeerBridgeKbps     int
+	// Returns the public key of the WireGuard peer the packets from an IP must come from, empty when there is none
+	routedPeerKey func(ip net.IP) string
+	// Shared by all the bridges to limit their total bandwidth
+	totalBandwidth *tokenBucket
 }
 
-func NewPeerServiceServerHandler(logger *device.Logger, profile Profile) *PeerServiceServerHandler {
+func NewPeerServiceServerHandler(logger *device.Logger, profile Profile, d *device.Device) *PeerServiceServerHandler {
 	s := &PeerServiceServerHandler{
-		logger:         logger,
-		profile:        profile,
-		peerBridges:    map[uint64]*NetworkConnection{},
-		maxPeerBridges: sharedutils.EnvOrDefaultInt(EnvMaxPeerBridges, 16),
+		logger:                logger,
+		audit:                 logger.AddPrepend("(AUDIT) "),
+		profile:               profile,
+		connection:            profile.connection,
+		peerBridges:           map[uint64]*peerBridge{},
+		maxPeerBridges:        GetConfig().MaxPeerBridges,
+		maxPeerBridgesPerPeer: GetConfig().MaxPeerBridgesPerPeer,
+		maxPeerBridgeKbps:     GetConfig().MaxPeerBridgeKbps,
+		totalBandwidth:        newTokenBucket(GetConfig().MaxPeerBridgesKbps),
+		routedPeerKey: func(ip net.IP) string {
+			if peer := d.LookupPeerByIP(ip); peer != nil {
+				return peer.GetPublicKey()
+			}
+			return ""
+		},
 	}
 	go func() {
+		reportStats := time.Tick(bridgeStatsInterval)
 		for {
 			select {
 			case <-time.After(1 * time.Second):
 				s.maintenance()
+			case <-reportStats:
+				s.reportStats()
 			}
 		}
 	}()
 	return s
 }
 
+// caller identifies the peer that sent a request using the WireGuard key the device accepts the packets of its IP from
+// The IP must be the WireGuard IP of that peer, which refuses the callers routed through a gateway peer since it can send from any IP
+// The peer must be allowed to talk to this device and the public key it claims, if any, must be its own
+func (s *PeerServiceServerHandler) caller(ctx context.Context, publicKey string) (relayCaller, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return relayCaller{}, errors.New("Unable to find the address of the caller")
+	}
+	addr, ok := p.Addr.(*net.TCPAddr)
+	if !ok {
+		return relayCaller{}, fmt.Errorf("Unexpected address %s for the caller", p.Addr)
+	}
+	if s.connection == nil {
+		return relayCaller{}, errors.New("The peers of this device are unknown")
+	}
+
+	routedKey := s.routedPeerKey(addr.IP)
+	if routedKey == "" {
+		return relayCaller{}, fmt.Errorf("%s isn't the address of a WireGuard peer", addr.IP)
+	}
+
+	s.connection.Lock()
+	defer s.connection.Unlock()
+	for peerID, pc := range s.connection.Peers {
+		if pc.PeerProfile.PublicKey != routedKey {
+			continue
+		}
+		if !pc.PeerProfile.WireguardIP.Equal(addr.IP) {
+			return relayCaller{}, fmt.Errorf("%s is routed through the peer %s which doesn't own it", addr.IP, peerID)
+		}
+		if publicKey != "" && publicKey != pc.PeerProfile.PublicKey {
+			return relayCaller{}, fmt.Errorf("%s doesn't own the key it claims", addr.IP)
+		}
+		if s.connection.Profile == nil || !isAllowedPeer(peerID, s.connection.Profile.AllowedPeers) {
+			return relayCaller{}, fmt.Errorf("%s isn't allowed to talk to this device", addr.IP)
+		}
+		return relayCaller{peerID: peerID, hostname: pc.PeerProfile.Hostname, ip: addr.IP}, nil
+	}
+	return relayCaller{}, fmt.Errorf("%s isn't a known peer", addr.IP)
+}
+
+func isAllowedPeer(peerID string, allowedPeers []string) bool {
+	for _, p := range allowedPeers {
+		if p == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// bridgesFor returns the amount of bridges of the caller, the lock must be held
+func (s *PeerServiceServerHandler) bridgesFor(caller relayCaller) int {
+	count := 0
+	for _, b := range s.peerBridges {
+		if b.caller.peerID == caller.peerID {
+			count++
+		}
+	}
+	return count
+}
+
+// canBridgeFor returns an error when bridging for the caller would exceed the maximum amount of bridges, either in total or for the caller
+func (s *PeerServiceServerHandler) canBridgeFor(caller relayCaller) error {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.peerBridges) >= s.maxPeerBridges {
+		return errors.New("Reached the maximum amount of peer bridges on this server")
+	}
+	if s.bridgesFor(caller) >= s.maxPeerBridgesPerPeer {
+		return errors.New("Reached the maximum amount of peer bridges for your device on this server")
+	}
+	return nil
+}
+
 func (s *PeerServiceServerHandler) CanOfferForwarding(ctx context.Context, in *CanOfferForwardingRequest) (*CanOfferForwardingReply, error) {
-	return &CanOfferForwardingReply{Result: true}, nil
+	caller, err := s.caller(ctx, "")
+	if err != nil {
+		return &CanOfferForwardingReply{Result: false}, nil
+	}
+	return &CanOfferForwardingReply{Result: s.canBridgeFor(caller) == nil}, nil
 }
 
 func (s *PeerServiceServerHandler) SetupForwarding(ctx context.Context, in *SetupForwardingRequest) (*SetupForwardingReply, error) {
+	caller, err := s.caller(ctx, in.PublicKey)
+	if err != nil {
+		s.audit.Info.Println("Refused to bridge:", err)
+		return nil, err
+	}
+
 	if in.Name == "" {
 		return nil, errors.New("Missing name for your connection")
 	}
 
-	s.Lock()
-	if len(s.peerBridges) >= s.maxPeerBridges {
-		s.Unlock()
-		return nil, errors.New("Reached the maximum amount of peer bridges on this server")
+	if err := s.canBridgeFor(caller); err != nil {
+		s.audit.Info.Println("Refused to bridge for", caller, ":", err)
+		return nil, err
 	}
-	s.Unlock()
 
 	nc := NewNetworkConnection(fmt.Sprintf("peer-service-%s", in.Name), s.logger, 0)
+	nc.shaper = newBridgeShaper(s.maxPeerBridgeKbps, s.totalBandwidth)
 	raddr, publicAddr := nc.SetupForwarding(in.PeerConnectionType, s.profile)
 
 	if publicAddr == nil {
@@ -63,41 +210,138 @@ func (s *PeerServiceServerHandler) SetupForwarding(ctx context.Context, in *Setu
 
 	s.Lock()
 	defer s.Unlock()
-	s.peerBridges[nc.Token()] = nc
+	s.peerBridges[nc.Token()] = &peerBridge{nc: nc, caller: caller, connectionType: in.PeerConnectionType, since: time.Now()}
+	s.audit.Info.Println("Bridging for", caller, "on", publicAddr, "using the connection type", in.PeerConnectionType)
 
-	return &SetupForwardingReply{Id: nc.ID(), Token: nc.Token(), Raddr: raddr, PublicIP: publicAddr.IP[12:16], PublicPort: int32(publicAddr.Port)}, nil
+	publicIP := publicAddr.IP.To4()
+	if publicIP == nil {
+		publicIP = publicAddr.IP.To16()
+	}
+	return &SetupForwardingReply{Id: nc.ID(), Token: nc.Token(), Raddr: raddr, PublicIP: publicIP, PublicPort: int32(publicAddr.Port)}, nil
 }
 
 func (s *PeerServiceServerHandler) ForwardingIsAlive(ctx context.Context, in *ForwardingIsAliveRequest) (*ForwardingIsAliveReply, error) {
+	caller, err := s.caller(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
 	s.Lock()
 	defer s.Unlock()
-	if nc, ok := s.peerBridges[in.Token]; ok {
-		if nc.ID() == in.Id {
+	// A caller can only know whether its own bridges are alive
+	if b, ok := s.peerBridges[in.Token]; ok && b.caller.peerID == caller.peerID {
+		if b.nc.ID() == in.Id {
 			return &ForwardingIsAliveReply{Result: true}, nil
 		}
 	}
 	return &ForwardingIsAliveReply{Result: false}, nil
 }
 
+// StopForwarding tears down a bridge of the caller once it moved to another one
+func (s *PeerServiceServerHandler) StopForwarding(ctx context.Context, in *StopForwardingRequest) (*StopForwardingReply, error) {
+	caller, err := s.caller(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	// A caller can only stop its own bridges
+	b, ok := s.peerBridges[in.Token]
+	if !ok || b.caller.peerID != caller.peerID || b.nc.ID() != in.Id {
+		return &StopForwardingReply{Result: false}, nil
+	}
+
+	b.nc.StopForwarding()
+	stats := b.stats()
+	s.audit.Info.Printf("Stopped bridging for %s on its request after relaying %d bytes to it and %d bytes from it, %d bytes were dropped", b.caller, stats.RxBytes, stats.TxBytes, stats.DroppedBytes)
+	delete(s.peerBridges, in.Token)
+	return &StopForwardingReply{Result: true}, nil
+}
+
+// GetBridgeCapacity returns the load of this device so the caller can pick the peer to bridge through
+func (s *PeerServiceServerHandler) GetBridgeCapacity(ctx context.Context, in *BridgeCapacityRequest) (*BridgeCapacityReply, error) {
+	caller, err := s.caller(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	available := s.canBridgeFor(caller) == nil
+	s.Lock()
+	defer s.Unlock()
+	return &BridgeCapacityReply{
+		Bridges:           int32(len(s.peerBridges)),
+		MaxBridges:        int32(s.maxPeerBridges),
+		CallerBridges:     int32(s.bridgesFor(caller)),
+		MaxBridgesPerPeer: int32(s.maxPeerBridgesPerPeer),
+		Available:         available,
+	}, nil
+}
+
 func (s *PeerServiceServerHandler) maintenance() {
 	s.Lock()
 	defer s.Unlock()
 	toDel := []uint64{}
-	for t, nc := range s.peerBridges {
-		if !nc.CheckConnectionLiveness() {
+	for t, b := range s.peerBridges {
+		if !b.nc.CheckConnectionLiveness() {
 			toDel = append(toDel, t)
 		}
 	}
 	for _, t := range toDel {
+		stats := s.peerBridges[t].stats()
+		s.audit.Info.Printf("Stopped bridging for %s after relaying %d bytes to it and %d bytes from it, %d bytes were dropped", s.peerBridges[t].caller, stats.RxBytes, stats.TxBytes, stats.DroppedBytes)
 		delete(s.peerBridges, t)
 	}
 }
 
+// Bridges returns the traffic of the bridges this device offers to its peers, ordered by the time they were set up
+func (s *PeerServiceServerHandler) Bridges() []BridgeStats {
+	s.Lock()
+	defer s.Unlock()
+	bridges := []BridgeStats{}
+	for _, b := range s.peerBridges {
+		bridges = append(bridges, b.stats())
+	}
+	sort.Slice(bridges, func(i, j int) bool {
+		return bridges[i].Since.Before(bridges[j].Since)
+	})
+	return bridges
+}
+
+// reportStats publishes the traffic of the bridges to the server
+func (s *PeerServiceServerHandler) reportStats() {
+	bridges := s.Bridges()
+	if len(bridges) == 0 {
+		return
+	}
+	// The key of this device changes when it is rotated
+	id := s.profile.PublicKey
+	if s.connection != nil {
+		s.connection.Lock()
+		if s.connection.Profile != nil {
+			id = s.connection.Profile.PublicKey
+		}
+		s.connection.Unlock()
+	}
+	data, err := json.Marshal(BridgeStatsEvent{ID: id, Bridges: bridges})
+	sharedutils.CheckError(err)
+	if err := GLPPublish(bridgeStatsCategory, Event{Type: EventTypeBridgeStats, Data: data, Timestamp: time.Now().Unix()}); err != nil {
+		s.logger.Error.Println("Unable to report the traffic of the bridges:", err)
+	}
+}
+
 func (s *PeerServiceServerHandler) PrintDebug() {
 	s.Lock()
 	defer s.Unlock()
-	for _, nc := range s.peerBridges {
-		nc.PrintDebug()
+	perPeer := map[string]int{}
+	for _, b := range s.peerBridges {
+		b.nc.PrintDebug()
+		perPeer[b.caller.String()]++
+		stats := b.stats()
+		s.logger.Info.Printf("Bridge for %s: %d bytes (%d packets) relayed to it, %d bytes (%d packets) relayed from it, %d packets dropped", b.caller, stats.RxBytes, stats.RxPackets, stats.TxBytes, stats.TxPackets, stats.DroppedPackets)
 	}
 	s.logger.Info.Printf("Got %d bridges active out of a maximum of %d", len(s.peerBridges), s.maxPeerBridges)
+	for caller, count := range perPeer {
+		s.logger.Info.Printf("Got %d bridges for %s out of a maximum of %d", count, caller, s.maxPeerBridgesPerPeer)
+	}
 }
@@ -0,0 +1,136 @@
+package ztn
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"google.golang.org/grpc/peer"
+)
+
+func callerContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 4000}})
+}
+
+func TestPeerServiceCaller(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	connection := NewConnection(logger)
+	connection.Profile = &Profile{}
+	connection.Profile.AllowedPeers = []string{"alice-id", "carol-id"}
+	alice := &PeerConnection{}
+	alice.PeerProfile.WireguardIP = net.ParseIP("100.64.0.2")
+	alice.PeerProfile.PublicKey = "alice"
+	alice.PeerProfile.Hostname = "alice-laptop"
+	connection.Peers["alice-id"] = alice
+	// Bob is still connected but was removed from the allowed peers
+	bob := &PeerConnection{}
+	bob.PeerProfile.WireguardIP = net.ParseIP("100.64.0.3")
+	bob.PeerProfile.PublicKey = "bob"
+	connection.Peers["bob-id"] = bob
+	// Carol is a gateway, the packets from the IPs of the other peers aren't accepted from her but the ones of any unknown IP are
+	carol := &PeerConnection{}
+	carol.PeerProfile.WireguardIP = net.ParseIP("100.64.0.4")
+	carol.PeerProfile.PublicKey = "carol"
+	carol.PeerProfile.IsGateway = true
+	connection.Peers["carol-id"] = carol
+	routes := map[string]string{"100.64.0.2": "alice", "100.64.0.3": "bob", "100.64.0.4": "carol", "100.64.0.9": "carol"}
+
+	s := &PeerServiceServerHandler{
+		logger:                logger,
+		audit:                 logger,
+		connection:            connection,
+		peerBridges:           map[uint64]*peerBridge{},
+		maxPeerBridges:        3,
+		maxPeerBridgesPerPeer: 2,
+		routedPeerKey:         func(ip net.IP) string { return routes[ip.String()] },
+	}
+
+	caller, err := s.caller(callerContext("100.64.0.2"), "alice")
+	if err != nil {
+		t.Fatal("Alice wasn't identified:", err)
+	}
+	if caller.peerID != "alice-id" || caller.hostname != "alice-laptop" {
+		t.Fatal("Wrong caller identified:", caller)
+	}
+	if _, err := s.caller(callerContext("100.64.0.2"), "bob"); err == nil {
+		t.Fatal("Alice was able to claim the key of Bob")
+	}
+	if _, err := s.caller(callerContext("100.64.0.3"), "bob"); err == nil {
+		t.Fatal("Bob was accepted while not in the allowed peers")
+	}
+	if _, err := s.caller(callerContext("100.64.0.9"), "carol"); err == nil {
+		t.Fatal("An address routed through a gateway was accepted")
+	}
+	if caller, err := s.caller(callerContext("100.64.0.4"), "carol"); err != nil || caller.peerID != "carol-id" {
+		t.Fatal("The gateway wasn't identified using its own address:", caller, err)
+	}
+	if _, err := s.caller(callerContext("192.0.2.1"), ""); err == nil {
+		t.Fatal("An address that isn't routed to a peer was accepted")
+	}
+	if _, err := s.caller(context.Background(), ""); err == nil {
+		t.Fatal("A caller without an address was accepted")
+	}
+
+	s.peerBridges[1] = &peerBridge{caller: caller}
+	s.peerBridges[2] = &peerBridge{caller: relayCaller{peerID: "carol-id"}}
+	capacity, err := s.GetBridgeCapacity(callerContext("100.64.0.2"), &BridgeCapacityRequest{})
+	if err != nil {
+		t.Fatal("Alice can't get the bridge capacity:", err)
+	}
+	if capacity.Bridges != 2 || capacity.MaxBridges != 3 || capacity.CallerBridges != 1 || capacity.MaxBridgesPerPeer != 2 || !capacity.Available {
+		t.Fatalf("Wrong bridge capacity: %+v", capacity)
+	}
+	if _, err := s.GetBridgeCapacity(callerContext("100.64.0.3"), &BridgeCapacityRequest{}); err == nil {
+		t.Fatal("The bridge capacity was given to a peer that isn't allowed")
+	}
+
+	carolBridge := &NetworkConnection{id: 7, shaper: newBridgeShaper(0, newTokenBucket(0)), stopForwardingChan: make(chan bool, 1)}
+	s.peerBridges[2].nc = carolBridge
+	if reply, err := s.StopForwarding(callerContext("100.64.0.2"), &StopForwardingRequest{Id: 7, Token: 2}); err != nil || reply.Result {
+		t.Fatal("Alice was able to stop a bridge of Carol:", err)
+	}
+	if reply, err := s.StopForwarding(callerContext("100.64.0.4"), &StopForwardingRequest{Id: 8, Token: 2}); err != nil || reply.Result {
+		t.Fatal("A bridge was stopped with the wrong ID:", err)
+	}
+	if reply, err := s.StopForwarding(callerContext("100.64.0.4"), &StopForwardingRequest{Id: 7, Token: 2}); err != nil || !reply.Result {
+		t.Fatal("Carol can't stop her bridge:", err)
+	}
+	if _, ok := s.peerBridges[2]; ok || len(carolBridge.stopForwardingChan) != 1 {
+		t.Fatal("The bridge of Carol wasn't torn down")
+	}
+	s.peerBridges = map[uint64]*peerBridge{}
+
+	if reply, _ := s.CanOfferForwarding(callerContext("100.64.0.3"), &CanOfferForwardingRequest{}); reply.Result {
+		t.Fatal("Forwarding was offered to a peer that isn't allowed")
+	}
+	if reply, _ := s.CanOfferForwarding(callerContext("100.64.0.2"), &CanOfferForwardingRequest{}); !reply.Result {
+		t.Fatal("Forwarding wasn't offered to an allowed peer")
+	}
+}
+
+func TestPeerServiceBridgeLimits(t *testing.T) {
+	s := &PeerServiceServerHandler{
+		peerBridges:           map[uint64]*peerBridge{},
+		maxPeerBridges:        3,
+		maxPeerBridgesPerPeer: 2,
+	}
+	alice := relayCaller{peerID: "alice-id"}
+	bob := relayCaller{peerID: "bob-id"}
+
+	s.peerBridges[1] = &peerBridge{caller: alice}
+	if err := s.canBridgeFor(alice); err != nil {
+		t.Fatal("Alice can't get a second bridge:", err)
+	}
+	s.peerBridges[2] = &peerBridge{caller: alice}
+	if err := s.canBridgeFor(alice); err == nil {
+		t.Fatal("Alice got more bridges than allowed per peer")
+	}
+	if err := s.canBridgeFor(bob); err != nil {
+		t.Fatal("Bob can't get a bridge because of the bridges of Alice:", err)
+	}
+	s.peerBridges[3] = &peerBridge{caller: bob}
+	if err := s.canBridgeFor(bob); err == nil {
+		t.Fatal("Bob got a bridge past the maximum of the server")
+	}
+}
@@ -0,0 +1,123 @@
+package ztn
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// How many STUN bindings are used to sample the port allocation and how many ports are predicted
+var portPredictionSamples = 5
+var portPredictionRange = 10
+
+// PortPrediction predicts the external ports a symmetric NAT will allocate next
+// The peers then send connectivity checks across the predicted ports, the first port is used as the public address
+// Each new destination uses up a port so the ports are predicted again for each peer, see Predict
+type PortPrediction struct {
+	sync.Mutex
+	BindTechniqueBase
+	server *net.UDPAddr
+}
+
+func NewPortPrediction() *PortPrediction {
+	u := &PortPrediction{}
+	u.InitID()
+	return u
+}
+
+func (u *PortPrediction) BindRequest(server *net.UDPAddr, sendTo chan *pkt) error {
+	u.Lock()
+	u.server = server
+	u.Unlock()
+
+	externalIP, predictedPorts, err := u.Predict()
+	if err != nil {
+		return err
+	}
+
+	externalPort := predictedPorts[0]
+	go func() {
+		sendTo <- &pkt{message: u.BindRequestPkt(externalIP, externalPort)}
+	}()
+
+	return nil
+}
+
+// Predict samples the port allocation of the NAT with the STUN server of the last bind request and returns the ports it should allocate next
+// The samples are taken one after the other so the connection the prediction is for is the next one to use the predicted ports
+func (u *PortPrediction) Predict() (net.IP, []int, error) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.server == nil {
+		return nil, nil, errors.New("no STUN server to sample the port allocation with")
+	}
+
+	externalIP, ports, err := samplePortAllocation(u.server, portPredictionSamples)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	predictedPorts, err := predictPorts(ports, portPredictionRange)
+	if err != nil {
+		return nil, nil, err
+	}
+	return externalIP, predictedPorts, nil
+}
+
+// samplePortAllocation obtains the external ports the NAT allocates to new sockets talking to the STUN server
+// The sockets are kept open until the end of the sampling so the NAT can't reuse their ports
+func samplePortAllocation(server *net.UDPAddr, samples int) (net.IP, []int, error) {
+	var externalIP net.IP
+	ports := []int{}
+	for i := 0; i < samples; i++ {
+		conn, err := net.ListenUDP("udp4", nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer conn.Close()
+
+		res, err := natDiscoveryRequest(conn, server, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		externalIP = res.mapped.IP
+		ports = append(ports, res.mapped.Port)
+	}
+	return externalIP, ports, nil
+}
+
+// predictPorts extrapolates the next ports using the most frequent difference between the sampled ports
+// It fails when the ports look randomly allocated since the prediction would then be useless
+func predictPorts(ports []int, count int) ([]int, error) {
+	if len(ports) < 2 {
+		return nil, errors.New("not enough samples to predict the ports")
+	}
+
+	frequencies := map[int]int{}
+	delta, frequency := 0, 0
+	for i := 1; i < len(ports); i++ {
+		d := ports[i] - ports[i-1]
+		frequencies[d]++
+		if frequencies[d] > frequency {
+			delta, frequency = d, frequencies[d]
+		}
+	}
+
+	if delta == 0 {
+		// The NAT reuses the same port, there is nothing to predict
+		return []int{ports[len(ports)-1]}, nil
+	}
+	if len(ports) > 2 && frequency < 2 {
+		return nil, errors.New("the NAT allocates its ports randomly")
+	}
+
+	predicted := []int{}
+	for port := ports[len(ports)-1] + delta; len(predicted) < count && port > 0 && port <= 65535; port += delta {
+		predicted = append(predicted, port)
+	}
+	if len(predicted) == 0 {
+		return nil, errors.New("the predicted ports are out of range")
+	}
+	return predicted, nil
+}
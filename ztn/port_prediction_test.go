@@ -0,0 +1,74 @@
+package ztn
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPredictPorts(t *testing.T) {
+	tests := []struct {
+		ports     []int
+		predicted []int
+		fails     bool
+	}{
+		{ports: []int{40000, 40001, 40002, 40003}, predicted: []int{40004, 40005, 40006}},
+		// Another host took a port in between
+		{ports: []int{40000, 40002, 40003, 40004}, predicted: []int{40005, 40006, 40007}},
+		{ports: []int{50010, 50008, 50006}, predicted: []int{50004, 50002, 50000}},
+		{ports: []int{50000, 50000, 50000}, predicted: []int{50000}},
+		{ports: []int{65533, 65534}, predicted: []int{65535}},
+		{ports: []int{41234, 52011, 33310}, fails: true},
+		{ports: []int{40000}, fails: true},
+	}
+	for i, test := range tests {
+		predicted, err := predictPorts(test.ports, 3)
+		if test.fails {
+			if err == nil {
+				t.Errorf("Test %d: ports were predicted from %v", i, test.ports)
+			}
+		} else if err != nil || !reflect.DeepEqual(predicted, test.predicted) {
+			t.Errorf("Test %d: got %v (%v) instead of %v", i, predicted, err, test.predicted)
+		}
+	}
+}
+
+func TestPortPredictionCandidates(t *testing.T) {
+	conn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	nc := &NetworkConnection{localConn: conn, BindTechnique: BindPortPrediction}
+	nc.setPublicAddr(&net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40004})
+
+	candidates := withPredictedCandidates(nc.Candidates(), nc.GetPublicAddr(), []int{40004, 40005, 40006})
+	predicted := []string{}
+	for i, c := range candidates {
+		if c.Type == CandidatePredicted {
+			predicted = append(predicted, c.Endpoint)
+		}
+		if i > 0 && c.Priority > candidates[i-1].Priority {
+			t.Error("The candidates aren't ordered by decreasing priority", candidates)
+		}
+	}
+	// The first predicted port is the public address of the connection
+	if !reflect.DeepEqual(predicted, []string{"203.0.113.7:40004", "203.0.113.7:40005", "203.0.113.7:40006"}) {
+		t.Error("Unexpected predicted candidates", predicted)
+	}
+
+	// The ports are only predicted for the peer that asked for them
+	for _, c := range nc.Candidates() {
+		if c.Type == CandidatePredicted && c.Endpoint != "203.0.113.7:40004" {
+			t.Error("A predicted port is shared by all the peers", c.Endpoint)
+		}
+	}
+	if ports := nc.PredictPorts(); ports != nil {
+		t.Error("Ports were predicted without sampling the NAT", ports)
+	}
+
+	if canReceiveInbound(BindPortPrediction, NATBehavior{}) {
+		t.Error("A peer behind a symmetric NAT was considered reachable without hole punching")
+	}
+}
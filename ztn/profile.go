@@ -1,6 +1,7 @@
 package ztn
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/inverse-inc/packetfence/go/remoteclients"
@@ -102,7 +104,7 @@ func (p *Profile) SetupWireguard(d *device.Device, WGInterface string) error {
 		return err
 	}
 
-	SetConfig(d, "listen_port", fmt.Sprintf("%d", localWGPort))
+	SetConfig(d, "listen_port", fmt.Sprintf("%d", localWGPort()))
 	SetConfig(d, "private_key", keyToHex(p.PrivateKey))
 
 	p.connection.Update(func() {
@@ -124,7 +126,7 @@ func (p *Profile) SetupWireguard(d *device.Device, WGInterface string) error {
 
 	go func() {
 		time.Sleep(5 * time.Second)
-		StartPeerServiceRPC(p.WireguardIP, p.logger, *p)
+		StartPeerServiceRPC(p.WireguardIP, p.logger, *p, d)
 	}()
 
 	return nil
@@ -167,6 +169,97 @@ func (p *Profile) FillProfileFromServer(connection *Connection, logger *device.L
 	}
 }
 
+// serverUnreachable returns whether the error is a failure to reach the server rather than an answer of the server, like the rejection of this device
+// The TLS failures, like an invalid certificate or one that doesn't match the pinned keys, aren't network errors: the server was reached but can't be trusted
+func serverUnreachable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// A *url.Error is a net.Error whatever the error it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// The TLS alerts sent by the server are wrapped in a "remote error" operation
+		return opErr.Op != "remote error"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// FillProfileFromServerOrCache fills the profile from the server and saves it in the cache
+// When the server can't be reached, the profile is filled from the cache and fromCache will be true
+// The cache isn't used when the server answered with an error since it may have revoked this device
+func (p *Profile) FillProfileFromServerOrCache(connection *Connection, logger *device.Logger, cache *ProfileCache) (fromCache bool, err error) {
+	err = p.FillProfileFromServer(connection, logger)
+	if err == nil {
+		if cacheErr := cache.SetProfile(*p); cacheErr != nil {
+			logger.Error.Println("Unable to save the profile cache:", cacheErr)
+		}
+		return false, nil
+	}
+
+	if !serverUnreachable(err) {
+		logger.Error.Println("The server refused to give the profile, not using the cached profile. Error:", err)
+		return false, err
+	}
+
+	logger.Error.Println("Unable to obtain profile from server, will attempt to use the cached profile. Error:", err)
+
+	if cacheErr := cache.Load(ProfileCacheMaxAge()); cacheErr != nil {
+		logger.Error.Println("Unable to load the profile cache:", cacheErr)
+		return false, err
+	}
+
+	if cacheErr := cache.FillProfile(p); cacheErr != nil {
+		logger.Error.Println("Unable to use the profile cache:", cacheErr)
+		return false, err
+	}
+
+	logger.Info.Println("Using cached profile saved on", cache.SavedAt)
+	return true, nil
+}
+
+// WaitForServerProfile retries to obtain the profile from the server until it succeeds
+// The fresh profile replaces the one in the cache and is then passed to onFresh
+// When the server answers with an error instead, the error is passed to onRejected and the retries stop
+func (p *Profile) WaitForServerProfile(cache *ProfileCache, onFresh func(Profile), onRejected func(error)) {
+	wait := 5 * time.Second
+	maxWait := 5 * time.Minute
+	for {
+		time.Sleep(wait)
+
+		fresh := Profile{PrivateKey: p.PrivateKey}
+		fresh.PublicKey = p.PublicKey
+		err := fresh.FillProfileFromServer(p.connection, p.logger)
+		if err != nil && !serverUnreachable(err) {
+			p.logger.Error.Println("The server refused to give the profile:", err)
+			onRejected(err)
+			return
+		}
+		if err != nil {
+			p.logger.Debug.Println("Server is still unreachable, will retry in", wait, ". Error:", err)
+			if wait *= 2; wait > maxWait {
+				wait = maxWait
+			}
+			continue
+		}
+
+		p.logger.Info.Println("Obtained a fresh profile from the server")
+		if err := cache.SetProfile(fresh); err != nil {
+			p.logger.Error.Println("Unable to save the profile cache:", err)
+		}
+		onFresh(fresh)
+		return
+	}
+}
+
 func (p *Profile) findClientMAC() (net.HardwareAddr, error) {
 	gwIP, err := gateway.DiscoverGateway()
 	if err != nil {
@@ -205,6 +298,10 @@ type RouteInfo struct {
 	Gateway net.IP
 }
 
+func (ri RouteInfo) String() string {
+	return fmt.Sprintf("%s via %s", ri.Network, ri.Gateway)
+}
+
 var routesRegexp = regexp.MustCompile(`([0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}/[0-9]{1,2}) via ([0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3}\.[0-9]{1,3})`)
 
 func (p *Profile) ParseRoutes() []RouteInfo {
@@ -232,7 +329,7 @@ func (p *Profile) ParseRoutes() []RouteInfo {
 }
 
 func (p *Profile) SetupRoutes() error {
-	if sharedutils.EnvOrDefault(EnvHonorRoutes, "true") == "true" {
+	if GetConfig().HonorRoutes {
 		for _, r := range p.ParseRoutes() {
 			p.logger.Info.Println("Installing route to", r.Network, "via", r.Gateway)
 			go func(r RouteInfo) {
@@ -250,45 +347,131 @@ func (p *Profile) SetupRoutes() error {
 	return nil
 }
 
-func (p *Profile) SetupGateway() error {
-	out := os.Getenv(EnvGatewayOutboundInterface)
-	if out == "" {
-		return errors.New(EnvGatewayOutboundInterface + " is not defined. Add this to the environment to determine which interface should be used for outbound routing of the gateway")
+// iptablesRule is a rule installed by SetupGateway
+type iptablesRule struct {
+	table string
+	chain string
+	spec  []string
+}
+
+func (r iptablesRule) run(action string) error {
+	args := append([]string{"-t", r.table, action, r.chain}, r.spec...)
+	return exec.Command("iptables", args...).Run()
+}
+
+// The chains the rules of the gateway are installed in
+var gatewayRuleChains = []iptablesRule{
+	{table: "nat", chain: "POSTROUTING"},
+	{table: "filter", chain: "FORWARD"},
+}
+
+// gatewayRuleComment tags the rules of the gateway of the current instance, the rules of the other instances have their own
+func gatewayRuleComment() string {
+	return "ztn-" + CurrentInstance().String()
+}
+
+// gatewayRules returns the rules that route the traffic of the WireGuard interface wg through the interface out
+// The NAT only applies to the network of the tunnel and all the rules are tagged with comment so that each instance only deletes its own rules
+func gatewayRules(out, wg string, tunnel *net.IPNet, comment string) []iptablesRule {
+	tag := []string{"-m", "comment", "--comment", comment}
+	rule := func(table, chain string, spec ...string) iptablesRule {
+		// The target stays last
+		n := len(spec) - 2
+		return iptablesRule{table: table, chain: chain, spec: append(append(append([]string{}, spec[:n]...), tag...), spec[n:]...)}
 	}
-	err := exec.Command("bash", "-c", "echo 1 > /proc/sys/net/ipv4/ip_forward").Run()
-	if err != nil {
-		return err
+	return []iptablesRule{
+		rule("nat", "POSTROUTING", "-s", tunnel.String(), "-o", out, "-p", "udp", "!", "--dport", "5060", "-j", "MASQUERADE"),
+		rule("nat", "POSTROUTING", "-s", tunnel.String(), "-o", out, "!", "-p", "udp", "-j", "MASQUERADE"),
+		rule("filter", "FORWARD", "-i", out, "-o", wg, "-p", "udp", "--dport", "5060", "-j", "ACCEPT"),
+		rule("filter", "FORWARD", "-i", out, "-o", wg, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"),
+		rule("filter", "FORWARD", "-i", wg, "-o", out, "-j", "ACCEPT"),
 	}
-	err = exec.Command("iptables", "-t", "nat", "-F").Run()
-	if err != nil {
-		return err
+}
+
+// taggedRules returns the rules of a chain listed by iptables -S that are tagged with comment
+func taggedRules(chain iptablesRule, listing string, comment string) []iptablesRule {
+	rules := []iptablesRule{}
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" || fields[1] != chain.chain {
+			continue
+		}
+		for i := 2; i+1 < len(fields); i++ {
+			if fields[i] == "--comment" && strings.Trim(fields[i+1], `"`) == comment {
+				// iptables quotes the comment when listing the rules but not when deleting them
+				fields[i+1] = comment
+				rules = append(rules, iptablesRule{table: chain.table, chain: chain.chain, spec: fields[2:]})
+				break
+			}
+		}
 	}
-	err = exec.Command("iptables", "-F").Run()
-	if err != nil {
-		return err
+	return rules
+}
+
+// SetupGateway enables the forwarding and installs the rules of the gateway
+// The other rules of the host, including the ones of the other instances, are left untouched
+func (p *Profile) SetupGateway() error {
+	out := GetConfig().GatewayOutboundInterface
+	if out == "" {
+		return errors.New("gateway_outbound_interface (" + EnvGatewayOutboundInterface + ") is not defined. Add this to the configuration to determine which interface should be used for outbound routing of the gateway")
 	}
-	err = exec.Command("iptables", "-t", "nat", "-A", "POSTROUTING", "-o", out, "-p", "udp", "!", "--dport", "5060", "-j", "MASQUERADE").Run()
-	if err != nil {
-		return err
+	tunnel := p.tunnelNetwork()
+	if tunnel == nil {
+		return errors.New("The profile has no WireGuard IP to route the traffic of")
 	}
-	err = exec.Command("iptables", "-t", "nat", "-A", "POSTROUTING", "-o", out, "!", "-p", "udp", "-j", "MASQUERADE").Run()
+	wg := CurrentInstance().InterfaceName("wg", 0)
+	err := exec.Command("bash", "-c", "echo 1 > /proc/sys/net/ipv4/ip_forward").Run()
 	if err != nil {
 		return err
 	}
-	err = exec.Command("iptables", "-A", "FORWARD", "-i", out, "-o", "wg0", "-p", "udp", "--dport", "5060", "-j", "ACCEPT").Run()
-	if err != nil {
-		return err
+
+	for _, r := range gatewayRules(out, wg, tunnel, gatewayRuleComment()) {
+		// The rule may remain from a previous run that didn't exit cleanly
+		if r.run("-C") == nil {
+			continue
+		}
+		if err := r.run("-A"); err != nil {
+			return err
+		}
 	}
-	err = exec.Command("iptables", "-A", "FORWARD", "-i", out, "-o", "wg0", "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT").Run()
-	if err != nil {
-		return err
+
+	return nil
+}
+
+// TeardownGateway deletes the rules that were installed by SetupGateway for the current instance
+// They are found using their comment so that they are deleted even when the network of the tunnel or the outbound interface changed since
+func (p *Profile) TeardownGateway() error {
+	// SetupGateway doesn't install anything without the outbound interface
+	if GetConfig().GatewayOutboundInterface == "" {
+		return nil
 	}
-	err = exec.Command("iptables", "-A", "FORWARD", "-i", "wg0", "-o", out, "-j", "ACCEPT").Run()
-	if err != nil {
-		return err
+
+	comment := gatewayRuleComment()
+	var firstErr error
+	for _, chain := range gatewayRuleChains {
+		listing, err := exec.Command("iptables", "-t", chain.table, "-S", chain.chain).Output()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, r := range taggedRules(chain, string(listing), comment) {
+			if err := r.run("-D"); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return firstErr
+}
 
-	return nil
+// tunnelNetwork returns the network of the tunnel, nil when the profile has no WireGuard IP
+func (p *Profile) tunnelNetwork() *net.IPNet {
+	if p.WireguardIP == nil {
+		return nil
+	}
+	mask := net.CIDRMask(p.WireguardNetmask, 32)
+	return &net.IPNet{IP: p.WireguardIP.Mask(mask), Mask: mask}
 }
 
 type PeerProfile struct {
@@ -299,6 +482,9 @@ func GetPeerProfile(id string) (PeerProfile, error) {
 	var p PeerProfile
 	var err error
 	err = GetAPIClient().Call(APIClientCtx, "GET", "/api/v1/remote_clients/peer/"+id, &p)
+	if err != nil {
+		return p, err
+	}
 
 	pkey, err := base64.URLEncoding.DecodeString(p.PublicKey)
 	sharedutils.CheckError(err)
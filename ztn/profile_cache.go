@@ -0,0 +1,212 @@
+package ztn
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+)
+
+// Default maximum age of a cached profile before it is considered too old to start from
+var DefaultProfileCacheMaxAge = 7 * 24 * time.Hour
+
+// ProfileCache holds the last profile that was successfully obtained from the server along with the profiles of the peers
+// It is stored on disk encrypted using a key derived from the local WireGuard private key
+type ProfileCache struct {
+	sync.Mutex
+	SavedAt time.Time              `json:"saved_at"`
+	Profile remoteclients.Peer     `json:"profile"`
+	Peers   map[string]PeerProfile `json:"peers"`
+
+	path       string
+	privateKey string
+	// The key the file may still be encrypted with after a key rotation
+	previousPrivateKey string
+	// Only the tunnel process writes the cache, the other processes only read it
+	readOnly bool
+}
+
+func NewProfileCache(path string, privateKey string) *ProfileCache {
+	return &ProfileCache{
+		path:       path,
+		privateKey: privateKey,
+		Peers:      map[string]PeerProfile{},
+	}
+}
+
+// NewReadOnlyProfileCache returns a cache that is never written to disk, for the processes that share the cache of the tunnel process
+func NewReadOnlyProfileCache(path string, privateKey string) *ProfileCache {
+	pc := NewProfileCache(path, privateKey)
+	pc.readOnly = true
+	return pc
+}
+
+func ProfileCacheMaxAge() time.Duration {
+	return GetConfig().ProfileCacheMaxAge
+}
+
+func profileCacheKey(b64PrivateKey string) ([]byte, error) {
+	privateKey, err := remoteclients.B64KeyToBytes(b64PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append([]byte("ztn-profile-cache"), privateKey[:]...))
+	return key[:], nil
+}
+
+// read decrypts the cache on disk with the current key or, after a key rotation, with the previous one
+func (pc *ProfileCache) read() (ProfileCache, error) {
+	loaded := ProfileCache{}
+	data, err := ioutil.ReadFile(pc.path)
+	if err != nil {
+		return loaded, err
+	}
+
+	for _, privateKey := range []string{pc.privateKey, pc.previousPrivateKey} {
+		if privateKey == "" {
+			continue
+		}
+		key, keyErr := profileCacheKey(privateKey)
+		if keyErr != nil {
+			err = keyErr
+			continue
+		}
+		var decrypted []byte
+		decrypted, err = remoteclients.DecryptMessage(key, data)
+		if err != nil {
+			continue
+		}
+		return loaded, json.Unmarshal(decrypted, &loaded)
+	}
+	return loaded, errors.New("Unable to decrypt the profile cache: " + err.Error())
+}
+
+// merge adds the peers saved on disk that aren't in memory so that writing a cache that wasn't loaded doesn't erase them
+func (pc *ProfileCache) merge() {
+	loaded, err := pc.read()
+	if err != nil {
+		return
+	}
+	for peerID, peerProfile := range loaded.Peers {
+		if _, ok := pc.Peers[peerID]; !ok {
+			pc.Peers[peerID] = peerProfile
+		}
+	}
+}
+
+// Load reads the cache from disk and fails if it is older than maxAge
+func (pc *ProfileCache) Load(maxAge time.Duration) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	loaded, err := pc.read()
+	if err != nil {
+		return err
+	}
+
+	if time.Since(loaded.SavedAt) > maxAge {
+		return fmt.Errorf("Cached profile dates from %s which is older than the maximum age of %s", loaded.SavedAt, maxAge)
+	}
+
+	pc.SavedAt = loaded.SavedAt
+	pc.Profile = loaded.Profile
+	pc.Peers = loaded.Peers
+	if pc.Peers == nil {
+		pc.Peers = map[string]PeerProfile{}
+	}
+	return nil
+}
+
+// SetProfile replaces the cached profile with a fresh one and writes the cache to disk
+// Peers that aren't allowed anymore by the new profile are removed from the cache
+func (pc *ProfileCache) SetProfile(profile Profile) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	pc.merge()
+	pc.Profile = profile.Peer
+
+	allowed := map[string]bool{}
+	for _, peerID := range profile.AllowedPeers {
+		allowed[peerID] = true
+	}
+	for peerID := range pc.Peers {
+		if !allowed[peerID] {
+			delete(pc.Peers, peerID)
+		}
+	}
+
+	return pc.save()
+}
+
+// SetPrivateKey changes the key the cache is encrypted with, it is used from the next write of the cache
+func (pc *ProfileCache) SetPrivateKey(privateKey string) {
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.privateKey != privateKey {
+		pc.previousPrivateKey = pc.privateKey
+	}
+	pc.privateKey = privateKey
+}
+
+// SetPeer records the profile of a peer and writes the cache to disk
+func (pc *ProfileCache) SetPeer(peerID string, peerProfile PeerProfile) error {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.merge()
+	pc.Peers[peerID] = peerProfile
+	return pc.save()
+}
+
+func (pc *ProfileCache) GetPeer(peerID string) (PeerProfile, bool) {
+	pc.Lock()
+	defer pc.Unlock()
+	peerProfile, ok := pc.Peers[peerID]
+	return peerProfile, ok
+}
+
+// FillProfile fills the profile with the cached one while keeping the keys of the profile
+func (pc *ProfileCache) FillProfile(profile *Profile) error {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if pc.SavedAt.IsZero() {
+		return errors.New("No profile cache loaded")
+	}
+
+	if pc.Profile.PublicKey != profile.PublicKey {
+		return errors.New("Cached profile doesn't match the public key of this device")
+	}
+
+	profile.Peer = pc.Profile
+	return nil
+}
+
+func (pc *ProfileCache) save() error {
+	if pc.readOnly {
+		return nil
+	}
+	pc.SavedAt = time.Now()
+
+	data, err := json.Marshal(pc)
+	if err != nil {
+		return err
+	}
+
+	key, err := profileCacheKey(pc.privateKey)
+	if err != nil {
+		return err
+	}
+
+	data, err = remoteclients.EncryptMessage(key, data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(pc.path, data)
+}
@@ -0,0 +1,95 @@
+package ztn
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+)
+
+func TestProfileCacheWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.cache")
+	priv, pub := testKeyPair(t)
+
+	profile := Profile{PrivateKey: priv}
+	profile.PublicKey = pub
+	profile.AllowedPeers = []string{"alice-id", "bob-id"}
+
+	cache := NewProfileCache(path, priv)
+	if err := cache.SetPeer("alice-id", PeerProfile{Peer: remoteclients.Peer{Hostname: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cache that wasn't loaded keeps the peers saved by the previous one
+	restarted := NewProfileCache(path, priv)
+	if err := restarted.SetProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.GetPeer("alice-id"); !ok {
+		t.Error("The cached peers were erased by a new cache")
+	}
+
+	// The processes other than the tunnel process don't write the cache
+	readOnly := NewReadOnlyProfileCache(path, priv)
+	profile.AllowedPeers = []string{"bob-id"}
+	readOnly.SetProfile(profile)
+	loaded := NewProfileCache(path, priv)
+	if err := loaded.Load(DefaultProfileCacheMaxAge); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.GetPeer("alice-id"); !ok {
+		t.Error("A read only cache was written")
+	}
+
+	// After a key rotation, the peers encrypted with the previous key are kept
+	rotatedPriv, _ := testKeyPair(t)
+	restarted.SetPrivateKey(rotatedPriv)
+	if err := restarted.SetPeer("bob-id", PeerProfile{Peer: remoteclients.Peer{Hostname: "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	rotated := NewProfileCache(path, rotatedPriv)
+	if err := rotated.Load(DefaultProfileCacheMaxAge); err != nil {
+		t.Fatal("The cache isn't encrypted with the new key:", err)
+	}
+	if _, ok := rotated.GetPeer("alice-id"); !ok {
+		t.Error("The cached peers were lost with the key rotation")
+	}
+}
+
+func TestServerUnreachable(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://pf.example.com/api/v1/remote_clients/profile", Err: err}
+	}
+
+	tests := []struct {
+		name        string
+		err         error
+		unreachable bool
+	}{
+		{"connection refused", urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true},
+		{"unknown host", urlErr(&net.DNSError{Err: "no such host", Name: "pf.example.com"}), true},
+		{"deadline", urlErr(context.DeadlineExceeded), true},
+		{"untrusted certificate", urlErr(x509.UnknownAuthorityError{}), false},
+		{"pinned keys", urlErr(errors.New("None of the certificates presented by the server match the pinned public keys")), false},
+		{"TLS alert", urlErr(&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}), false},
+		{"rejected", errors.New("Unable to find the profile"), false},
+	}
+
+	for _, test := range tests {
+		if serverUnreachable(test.err) != test.unreachable {
+			t.Errorf("%s: expected unreachable to be %t", test.name, test.unreachable)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ztn
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+	"github.com/inverse-inc/wireguard-go/filter"
+	"github.com/inverse-inc/wireguard-go/routes"
+)
+
+var DefaultProfileRefreshInterval = 5 * time.Minute
+
+// ProfileDiff describes what changed between two profiles
+type ProfileDiff struct {
+	AddedPeers     []string
+	RemovedPeers   []string
+	ACLsChanged    bool
+	AddedRoutes    []RouteInfo
+	RemovedRoutes  []RouteInfo
+	GatewayChanged bool
+}
+
+func (d ProfileDiff) Empty() bool {
+	return len(d.AddedPeers) == 0 && len(d.RemovedPeers) == 0 && !d.ACLsChanged && len(d.AddedRoutes) == 0 && len(d.RemovedRoutes) == 0 && !d.GatewayChanged
+}
+
+func (d ProfileDiff) String() string {
+	return fmt.Sprintf("(added peers:%d) (removed peers:%d) (ACLs changed:%t) (added routes:%d) (removed routes:%d) (gateway changed:%t)", len(d.AddedPeers), len(d.RemovedPeers), d.ACLsChanged, len(d.AddedRoutes), len(d.RemovedRoutes), d.GatewayChanged)
+}
+
+// DiffProfiles computes the changes needed to go from the old profile to the new one
+// Routes are only installed when the profile isn't a gateway so they are computed accordingly
+func DiffProfiles(old, new *Profile) ProfileDiff {
+	d := ProfileDiff{}
+
+	d.AddedPeers, d.RemovedPeers = diffStrings(old.AllowedPeers, new.AllowedPeers)
+
+	// The order of the ACLs matters so any difference is a change
+	d.ACLsChanged = !stringSlicesEqual(old.ACLs, new.ACLs)
+
+	d.GatewayChanged = old.IsGateway != new.IsGateway
+
+	oldRoutes := map[string]RouteInfo{}
+	if !old.IsGateway {
+		for _, r := range old.ParseRoutes() {
+			oldRoutes[r.String()] = r
+		}
+	}
+	newRoutes := map[string]RouteInfo{}
+	if !new.IsGateway {
+		for _, r := range new.ParseRoutes() {
+			newRoutes[r.String()] = r
+		}
+	}
+	for k, r := range newRoutes {
+		if _, ok := oldRoutes[k]; !ok {
+			d.AddedRoutes = append(d.AddedRoutes, r)
+		}
+	}
+	for k, r := range oldRoutes {
+		if _, ok := newRoutes[k]; !ok {
+			d.RemovedRoutes = append(d.RemovedRoutes, r)
+		}
+	}
+
+	return d
+}
+
+func diffStrings(old, new []string) (added []string, removed []string) {
+	oldSet := map[string]bool{}
+	for _, s := range old {
+		oldSet[s] = true
+	}
+	newSet := map[string]bool{}
+	for _, s := range new {
+		newSet[s] = true
+		if !oldSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !newSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ProfileRefresher periodically fetches the profile from the server and applies the changes to the running tunnel
+// Peers that are unchanged by the new profile are left untouched
+type ProfileRefresher struct {
+	connection        *Connection
+	device            *device.Device
+	networkConnection *NetworkConnection
+	logger            *device.Logger
+	refreshChan       chan bool
+}
+
+func NewProfileRefresher(connection *Connection, d *device.Device, networkConnection *NetworkConnection, logger *device.Logger) *ProfileRefresher {
+	return &ProfileRefresher{
+		connection:        connection,
+		device:            d,
+		networkConnection: networkConnection,
+		logger:            logger.AddPrepend("(PROFILE) "),
+		refreshChan:       make(chan bool, 1),
+	}
+}
+
+func ProfileRefreshInterval() time.Duration {
+	return GetConfig().ProfileRefreshInterval
+}
+
+func (pr *ProfileRefresher) Start() {
+	interval := ProfileRefreshInterval()
+	for {
+		select {
+		case <-time.After(interval):
+		case <-pr.refreshChan:
+		}
+		if err := pr.refresh(); err != nil {
+			pr.logger.Error.Println("Unable to refresh the profile:", err)
+		}
+	}
+}
+
+// Refresh requests an immediate refresh of the profile without waiting for the next interval
+func (pr *ProfileRefresher) Refresh() {
+	select {
+	case pr.refreshChan <- true:
+	default:
+		// A refresh is already pending
+	}
+}
+
+func (pr *ProfileRefresher) refresh() error {
+	var current Profile
+	pr.connection.Update(func() {
+		current = *pr.connection.Profile
+	})
+
+	fresh := Profile{PrivateKey: current.PrivateKey}
+	fresh.PublicKey = current.PublicKey
+	err := fresh.FillProfileFromServer(pr.connection, pr.logger)
+	if err != nil {
+		return err
+	}
+
+	pr.Apply(fresh)
+	return nil
+}
+
+// Apply applies the changes between the current profile of the connection and the fresh one
+func (pr *ProfileRefresher) Apply(fresh Profile) {
+	var current Profile
+	pr.connection.Update(func() {
+		current = *pr.connection.Profile
+	})
+	// Ensure the logger is available for parsing the routes
+	if current.logger == nil {
+		current.logger = pr.logger
+	}
+	if fresh.logger == nil {
+		fresh.logger = pr.logger
+	}
+	fresh.connection = pr.connection
+
+	diff := DiffProfiles(&current, &fresh)
+
+	pr.connection.Update(func() {
+		pr.connection.Profile = &fresh
+	})
+
+	if pr.connection.ProfileCache != nil {
+		if err := pr.connection.ProfileCache.SetProfile(fresh); err != nil {
+			pr.logger.Error.Println("Unable to save the profile cache:", err)
+		}
+	}
+
+	if diff.Empty() {
+		pr.logger.Debug.Println("No changes in the profile")
+		return
+	}
+
+	pr.logger.Info.Println("Applying profile changes", diff)
+
+	for _, peerID := range diff.RemovedPeers {
+		pr.connection.StopPeer(peerID)
+	}
+
+	for _, peerID := range diff.AddedPeers {
+		pr.connection.StartPeer(pr.device, fresh, peerID, pr.networkConnection)
+	}
+
+	if diff.ACLsChanged {
+		pr.logger.Info.Println("Installing new ACLs")
+		pr.device.SetReceiveFilter(filter.NewFilterFromAcls(fresh.ACLs))
+	}
+
+	if diff.GatewayChanged && !fresh.IsGateway {
+		pr.logger.Info.Println("This agent isn't a gateway anymore, removing the gateway configuration")
+		if err := fresh.TeardownGateway(); err != nil {
+			pr.logger.Error.Println("Unable to remove the gateway configuration:", err)
+		}
+	}
+
+	pr.applyRoutes(diff)
+
+	if diff.GatewayChanged && fresh.IsGateway {
+		pr.logger.Info.Println("This agent is now a gateway, setting up the gateway configuration")
+		if err := fresh.SetupGateway(); err != nil {
+			pr.logger.Error.Println("Unable to setup the gateway configuration:", err)
+		}
+	}
+}
+
+func (pr *ProfileRefresher) applyRoutes(diff ProfileDiff) {
+	if !GetConfig().HonorRoutes {
+		return
+	}
+
+	for _, r := range diff.RemovedRoutes {
+		pr.logger.Info.Println("Removing route to", r.Network, "via", r.Gateway)
+		if err := routes.Delete(r.Network, r.Gateway); err != nil {
+			pr.logger.Error.Println("Error while removing route to", r.Network, "via", r.Gateway, ":", err)
+		}
+	}
+
+	for _, r := range diff.AddedRoutes {
+		pr.logger.Info.Println("Installing route to", r.Network, "via", r.Gateway)
+		if err := routes.Add(r.Network, r.Gateway); err != nil {
+			pr.logger.Error.Println("Error while installing route to", r.Network, "via", r.Gateway, ":", err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ztn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestDiffStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []string
+		added    []string
+		removed  []string
+	}{
+		{name: "unchanged", old: []string{"a", "b"}, new: []string{"b", "a"}},
+		{name: "added", old: []string{"a"}, new: []string{"a", "b", "c"}, added: []string{"b", "c"}},
+		{name: "removed", old: []string{"a", "b", "c"}, new: []string{"b"}, removed: []string{"a", "c"}},
+		{name: "replaced", old: []string{"a", "b"}, new: []string{"b", "c"}, added: []string{"c"}, removed: []string{"a"}},
+		{name: "from nothing", new: []string{"a"}, added: []string{"a"}},
+		{name: "to nothing", old: []string{"a"}, removed: []string{"a"}},
+	}
+	for _, test := range tests {
+		added, removed := diffStrings(test.old, test.new)
+		if !reflect.DeepEqual(added, test.added) || !reflect.DeepEqual(removed, test.removed) {
+			t.Errorf("%s: got %v added and %v removed instead of %v and %v", test.name, added, removed, test.added, test.removed)
+		}
+	}
+}
+
+func testRefresherProfile(peers, acls, routes []string, gateway bool) *Profile {
+	p := &Profile{logger: device.NewLogger(device.LogLevelSilent, "")}
+	p.AllowedPeers = peers
+	p.ACLs = acls
+	p.Routes = routes
+	p.IsGateway = gateway
+	return p
+}
+
+func routeStrings(routes []RouteInfo) []string {
+	s := []string{}
+	for _, r := range routes {
+		s = append(s, r.String())
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestDiffProfiles(t *testing.T) {
+	routeA := "10.0.0.0/8 via 100.64.0.1"
+	routeB := "192.168.0.0/16 via 100.64.0.1"
+
+	tests := []struct {
+		name          string
+		old, new      *Profile
+		addedPeers    []string
+		removedPeers  []string
+		aclsChanged   bool
+		addedRoutes   []string
+		removedRoutes []string
+		gateway       bool
+	}{
+		{
+			name: "unchanged",
+			old:  testRefresherProfile([]string{"a"}, []string{"permit ip any any"}, []string{routeA}, false),
+			new:  testRefresherProfile([]string{"a"}, []string{"permit ip any any"}, []string{routeA}, false),
+		},
+		{
+			name:       "peer added",
+			old:        testRefresherProfile([]string{"a"}, nil, nil, false),
+			new:        testRefresherProfile([]string{"a", "b"}, nil, nil, false),
+			addedPeers: []string{"b"},
+		},
+		{
+			name:         "peer removed",
+			old:          testRefresherProfile([]string{"a", "b"}, nil, nil, false),
+			new:          testRefresherProfile([]string{"b"}, nil, nil, false),
+			removedPeers: []string{"a"},
+		},
+		{
+			name:        "ACLs reordered",
+			old:         testRefresherProfile(nil, []string{"deny ip any any", "permit ip any any"}, nil, false),
+			new:         testRefresherProfile(nil, []string{"permit ip any any", "deny ip any any"}, nil, false),
+			aclsChanged: true,
+		},
+		{
+			name:          "route changed",
+			old:           testRefresherProfile(nil, nil, []string{routeA}, false),
+			new:           testRefresherProfile(nil, nil, []string{routeB}, false),
+			addedRoutes:   []string{routeB},
+			removedRoutes: []string{routeA},
+		},
+		{
+			name:          "became a gateway",
+			old:           testRefresherProfile(nil, nil, []string{routeA}, false),
+			new:           testRefresherProfile(nil, nil, []string{routeA}, true),
+			removedRoutes: []string{routeA},
+			gateway:       true,
+		},
+		{
+			name:        "isn't a gateway anymore",
+			old:         testRefresherProfile(nil, nil, []string{routeA}, true),
+			new:         testRefresherProfile(nil, nil, []string{routeA}, false),
+			addedRoutes: []string{routeA},
+			gateway:     true,
+		},
+	}
+	for _, test := range tests {
+		d := DiffProfiles(test.old, test.new)
+		if !reflect.DeepEqual(d.AddedPeers, test.addedPeers) || !reflect.DeepEqual(d.RemovedPeers, test.removedPeers) {
+			t.Errorf("%s: wrong peers %v added and %v removed", test.name, d.AddedPeers, d.RemovedPeers)
+		}
+		if d.ACLsChanged != test.aclsChanged {
+			t.Errorf("%s: wrong ACLs change %t", test.name, d.ACLsChanged)
+		}
+		if added := routeStrings(d.AddedRoutes); len(added) != len(test.addedRoutes) || (len(added) > 0 && !reflect.DeepEqual(added, test.addedRoutes)) {
+			t.Errorf("%s: wrong routes added %v", test.name, added)
+		}
+		if removed := routeStrings(d.RemovedRoutes); len(removed) != len(test.removedRoutes) || (len(removed) > 0 && !reflect.DeepEqual(removed, test.removedRoutes)) {
+			t.Errorf("%s: wrong routes removed %v", test.name, removed)
+		}
+		if d.GatewayChanged != test.gateway {
+			t.Errorf("%s: wrong gateway change %t", test.name, d.GatewayChanged)
+		}
+		if d.Empty() != (test.name == "unchanged") {
+			t.Errorf("%s: wrong emptiness of the diff %s", test.name, d)
+		}
+	}
+}
+
+func TestProfileRefresherApply(t *testing.T) {
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	dir, err := ioutil.TempDir("", "profile-refresher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	connection := NewConnection(logger)
+	connection.Profile = testRefresherProfile([]string{"a", "b"}, nil, nil, false)
+	connection.ProfileCache = NewProfileCache(filepath.Join(dir, "profile.cache"), "")
+	removed := &PeerConnection{logger: logger, stopChan: make(chan bool), doneChan: make(chan bool)}
+	close(removed.doneChan)
+	kept := &PeerConnection{logger: logger, stopChan: make(chan bool), doneChan: make(chan bool)}
+	connection.Peers["a"] = removed
+	connection.Peers["b"] = kept
+
+	pr := NewProfileRefresher(connection, nil, nil, logger)
+
+	// Unchanged profile
+	pr.Apply(*testRefresherProfile([]string{"a", "b"}, nil, nil, false))
+	if len(connection.Peers) != 2 || removed.Stopped() || kept.Stopped() {
+		t.Fatal("Peers were touched while the profile didn't change")
+	}
+
+	// Removed peer
+	fresh := testRefresherProfile([]string{"b"}, nil, nil, false)
+	fresh.Hostname = "fresh"
+	pr.Apply(*fresh)
+	if _, ok := connection.Peers["a"]; ok || !removed.Stopped() {
+		t.Error("The removed peer wasn't stopped")
+	}
+	if _, ok := connection.Peers["b"]; !ok || kept.Stopped() {
+		t.Error("The unchanged peer was stopped")
+	}
+	if connection.Profile.Hostname != "fresh" || connection.Profile.connection != connection {
+		t.Error("The fresh profile didn't replace the current one")
+	}
+}
@@ -0,0 +1,46 @@
+package ztn
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGatewayRules(t *testing.T) {
+	_, tunnel, _ := net.ParseCIDR("100.64.0.0/24")
+	for _, r := range gatewayRules("eth0", "wg0", tunnel, "ztn-main") {
+		spec := strings.Join(r.spec, " ")
+		if !strings.Contains(spec, "-m comment --comment ztn-main") {
+			t.Error("The rule isn't tagged with the comment of the instance:", spec)
+		}
+		if r.spec[len(r.spec)-2] != "-j" {
+			t.Error("The target of the rule isn't last:", spec)
+		}
+		if r.table == "nat" && !strings.HasPrefix(spec, "-s 100.64.0.0/24 ") {
+			t.Error("The NAT applies to more than the network of the tunnel:", spec)
+		}
+	}
+}
+
+func TestTaggedRules(t *testing.T) {
+	listing := `-P POSTROUTING ACCEPT
+-A POSTROUTING -s 100.64.0.0/24 -o eth0 -p udp -m udp ! --dport 5060 -m comment --comment ztn-main -j MASQUERADE
+-A POSTROUTING -s 100.65.0.0/24 -o eth0 -p udp -m udp ! --dport 5060 -m comment --comment ztn-customer1 -j MASQUERADE
+-A POSTROUTING -s 100.64.0.0/24 -o eth0 ! -p udp -m comment --comment "ztn-main" -j MASQUERADE
+-A POSTROUTING -o eth0 -j MASQUERADE
+`
+	rules := taggedRules(iptablesRule{table: "nat", chain: "POSTROUTING"}, listing, "ztn-main")
+	if len(rules) != 2 {
+		t.Fatal("Unexpected rules", rules)
+	}
+	if spec := strings.Join(rules[0].spec, " "); rules[0].table != "nat" || spec != "-s 100.64.0.0/24 -o eth0 -p udp -m udp ! --dport 5060 -m comment --comment ztn-main -j MASQUERADE" {
+		t.Error("Unexpected rule", rules[0].table, spec)
+	}
+	if spec := strings.Join(rules[1].spec, " "); strings.Contains(spec, `"`) {
+		t.Error("The comment of the rule is still quoted:", spec)
+	}
+
+	if rules := taggedRules(iptablesRule{table: "nat", chain: "POSTROUTING"}, listing, "ztn-customer2"); len(rules) != 0 {
+		t.Error("Rules of another instance were found", rules)
+	}
+}
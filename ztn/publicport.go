@@ -3,7 +3,6 @@ package ztn
 import (
 	"errors"
 	"net"
-	"os"
 	"sync"
 )
 
@@ -28,11 +27,11 @@ func (pp *PublicPort) BindRequest(conn *net.UDPConn, sendTo chan *pkt) error {
 		return nil
 	}
 
-	pp.remoteIP = net.ParseIP(os.Getenv(EnvPublicPortIP))
+	pp.remoteIP = GetConfig().PublicPortIP
 	if pp.remoteIP == nil {
-		return errors.New(EnvPublicPortIP + " is not defined in the environment or is not a valid IPv4 address")
+		return errors.New("public_port_ip (" + EnvPublicPortIP + ") is not defined in the configuration")
 	}
-	pp.remotePort = localWGPort
+	pp.remotePort = localWGPort()
 
 	go func() {
 		sendTo <- &pkt{message: pp.BindRequestPkt(pp.remoteIP, pp.remotePort)}
@@ -0,0 +1,112 @@
+package ztn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How many times the capacity of a relay is requested to measure its round trip time, the fastest answer is kept
+const relayProbeCount = 3
+
+var relayProbeTimeout = 2 * time.Second
+
+// How often the relays are probed again to find a better one than the current relay
+var relayReevaluationInterval = 2 * time.Minute
+
+// A relay must have a score below this ratio of the score of the current relay to migrate to it, which prevents flapping between similar relays
+const relayMigrationRatio = 0.7
+
+// relayProbe is the round trip time and the load of a peer that offers bridging
+type relayProbe struct {
+	pc         *PeerConnection
+	serverAddr string
+	rtt        time.Duration
+	capacity   *BridgeCapacityReply
+}
+
+func peerServiceAddr(pc *PeerConnection) string {
+	return fmt.Sprintf("%s:%d", pc.PeerProfile.WireguardIP.String(), PeerServiceServerPort)
+}
+
+// relayScore returns the score of a relay, the lower the better
+// The round trip time is weighted by the load the relay would have with the bridge of this device, current tells whether the relay already bridges for this device
+func relayScore(rtt time.Duration, capacity *BridgeCapacityReply, current bool) float64 {
+	bridges := float64(capacity.Bridges)
+	if !current {
+		bridges++
+	}
+	load := 1.0
+	if capacity.MaxBridges > 0 {
+		load = bridges / float64(capacity.MaxBridges)
+	}
+	return float64(rtt) * (1 + load)
+}
+
+// rankRelays returns the relays that can bridge for this device, the best one first
+// The relays that couldn't be probed, like the ones running a version without GetBridgeCapacity, are kept last
+func rankRelays(probes []relayProbe) []relayProbe {
+	ranked := []relayProbe{}
+	for _, p := range probes {
+		if p.capacity == nil || p.capacity.Available {
+			ranked = append(ranked, p)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].capacity == nil || ranked[j].capacity == nil {
+			return ranked[j].capacity == nil && ranked[i].capacity != nil
+		}
+		return relayScore(ranked[i].rtt, ranked[i].capacity, false) < relayScore(ranked[j].rtt, ranked[j].capacity, false)
+	})
+	return ranked
+}
+
+// betterRelay returns whether the relay is enough of an improvement over the current one to migrate to it
+func betterRelay(candidate, current relayProbe) bool {
+	if current.capacity == nil {
+		return true
+	}
+	return relayScore(candidate.rtt, candidate.capacity, false) < relayMigrationRatio*relayScore(current.rtt, current.capacity, true)
+}
+
+// probeRelay requests the capacity of a peer that offers bridging and measures the round trip time to its peer service
+func (btp *BindThroughPeerAgent) probeRelay(pc *PeerConnection) relayProbe {
+	probe := relayProbe{pc: pc, serverAddr: peerServiceAddr(pc)}
+	c, conn := ConnectPeerServiceClient(probe.serverAddr)
+	defer conn.Close()
+	for i := 0; i < relayProbeCount; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), relayProbeTimeout)
+		start := time.Now()
+		capacity, err := c.GetBridgeCapacity(ctx, &BridgeCapacityRequest{})
+		rtt := time.Since(start)
+		cancel()
+		if err != nil {
+			btp.networkConnection.logger.Debug.Println("Unable to get the bridge capacity of peer", pc.PeerProfile.WireguardIP, ":", err)
+			return probe
+		}
+		// The first request also establishes the connection
+		if probe.capacity == nil || rtt < probe.rtt {
+			probe.rtt = rtt
+		}
+		probe.capacity = capacity
+	}
+	btp.networkConnection.logger.Debug.Printf("Peer %s answered in %s with %d bridges out of %d", pc.PeerProfile.WireguardIP, probe.rtt, probe.capacity.Bridges, probe.capacity.MaxBridges)
+	return probe
+}
+
+// probeRelays probes the peers in parallel
+func (btp *BindThroughPeerAgent) probeRelays(pcs []*PeerConnection) []relayProbe {
+	probes := make([]relayProbe, len(pcs))
+	wg := sync.WaitGroup{}
+	for i, pc := range pcs {
+		wg.Add(1)
+		go func(i int, pc *PeerConnection) {
+			defer wg.Done()
+			probes[i] = btp.probeRelay(pc)
+		}(i, pc)
+	}
+	wg.Wait()
+	return probes
+}
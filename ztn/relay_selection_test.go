@@ -0,0 +1,51 @@
+package ztn
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankRelays(t *testing.T) {
+	near := relayProbe{serverAddr: "near", rtt: 10 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 15, MaxBridges: 16, Available: true}}
+	far := relayProbe{serverAddr: "far", rtt: 150 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 0, MaxBridges: 16, Available: true}}
+	idle := relayProbe{serverAddr: "idle", rtt: 20 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 0, MaxBridges: 16, Available: true}}
+	full := relayProbe{serverAddr: "full", rtt: time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 16, MaxBridges: 16, Available: false}}
+	old := relayProbe{serverAddr: "old"}
+
+	ranked := rankRelays([]relayProbe{old, far, full, near, idle})
+	order := []string{}
+	for _, p := range ranked {
+		order = append(order, p.serverAddr)
+	}
+	expected := []string{"near", "idle", "far", "old"}
+	if len(order) != len(expected) {
+		t.Fatal("Wrong relays ranked:", order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatal("Wrong order of the relays:", order)
+		}
+	}
+
+	// A loaded relay loses against an idle one when their round trip times are close
+	busy := relayProbe{serverAddr: "busy", rtt: 15 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 15, MaxBridges: 16, Available: true}}
+	if rankRelays([]relayProbe{busy, idle})[0].serverAddr != "idle" {
+		t.Fatal("The load of the relays wasn't taken into account")
+	}
+}
+
+func TestBetterRelay(t *testing.T) {
+	current := relayProbe{serverAddr: "current", rtt: 100 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 1, MaxBridges: 16, Available: true}}
+	similar := relayProbe{serverAddr: "similar", rtt: 90 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 0, MaxBridges: 16, Available: true}}
+	faster := relayProbe{serverAddr: "faster", rtt: 30 * time.Millisecond, capacity: &BridgeCapacityReply{Bridges: 0, MaxBridges: 16, Available: true}}
+
+	if betterRelay(similar, current) {
+		t.Fatal("Migrating to a relay that is barely better")
+	}
+	if !betterRelay(faster, current) {
+		t.Fatal("Not migrating to a much faster relay")
+	}
+	if !betterRelay(similar, relayProbe{serverAddr: "current"}) {
+		t.Fatal("Not migrating away from a relay that doesn't answer")
+	}
+}
@@ -0,0 +1,154 @@
+package ztn
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+
+	"github.com/jackpal/gateway"
+)
+
+// privateAddresses returns the IPv4 addresses of the local interfaces along with their prefix length, the addresses in the network of the tunnel are left out
+func privateAddresses(tunnel *net.IPNet) []string {
+	addresses := []string{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return addresses
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			if tunnel != nil && tunnel.Contains(ipnet.IP) {
+				continue
+			}
+			addresses = append(addresses, ipnet.String())
+		}
+	}
+	return addresses
+}
+
+// localGatewayMAC returns the MAC address of the default gateway or an empty string when it can't be found
+func localGatewayMAC() string {
+	gatewayIP, err := gateway.DiscoverGateway()
+	if err != nil {
+		return ""
+	}
+	mac, err := gatewayMAC(gatewayIP)
+	if err != nil {
+		return ""
+	}
+	return mac.String()
+}
+
+// gatewayHash returns a hash of the MAC address of the gateway keyed with the shared secret of the two peers, empty when the MAC is unknown
+// Only the peer can compare it with its own gateway and it differs for each peer so it can't be used to locate this device
+func gatewayHash(mac string, sharedSecret [32]byte) string {
+	if mac == "" {
+		return ""
+	}
+	h := hmac.New(sha256.New, sharedSecret[:])
+	h.Write([]byte("ztn-gateway-mac"))
+	h.Write([]byte(mac))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// localGatewayHash returns the hash of the MAC address of the gateway of this device for the peer, see gatewayHash
+func (pc *PeerConnection) localGatewayHash() string {
+	sharedSecret, err := peersSharedSecret(pc.MyProfile.PrivateKey, pc.PeerProfile.PublicKey)
+	if err != nil {
+		return ""
+	}
+	return gatewayHash(localGatewayMAC(), sharedSecret)
+}
+
+// inSubnets returns whether the IP is in the subnet of one of the addresses, the addresses themselves are ignored
+func inSubnets(ip net.IP, addresses []string) bool {
+	for _, a := range addresses {
+		myIP, myNet, err := net.ParseCIDR(a)
+		if err != nil || myIP.Equal(ip) {
+			continue
+		}
+		if myNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameNAT returns whether two peers are behind the same NAT: they share their public IP or their gateway
+// Sharing a private subnet isn't enough since most networks use the same few RFC1918 subnets
+// The result is the same on both sides so they agree on the connection types to try
+func sameNAT(myPublicEndpoint, theirPublicEndpoint, myGatewayHash, theirGatewayHash string) bool {
+	myPublicIP, _, err := net.SplitHostPort(myPublicEndpoint)
+	theirPublicIP, _, err2 := net.SplitHostPort(theirPublicEndpoint)
+	if err == nil && err2 == nil && net.ParseIP(myPublicIP) != nil && net.ParseIP(myPublicIP).Equal(net.ParseIP(theirPublicIP)) {
+		return true
+	}
+	return myGatewayHash != "" && myGatewayHash == theirGatewayHash
+}
+
+// tunnelNetwork returns the network of the tunnel so its addresses aren't mistaken for a shared LAN
+func (pc *PeerConnection) tunnelNetwork() *net.IPNet {
+	return pc.MyProfile.tunnelNetwork()
+}
+
+// SameNAT returns whether the peer is behind the same NAT as this device, the LAN connection types are then tried first since most routers don't hairpin
+// The public endpoints aren't compared when either peer binds through another peer since they are then the endpoint of that other peer
+func (pc *PeerConnection) SameNAT(nee *NetworkEndpointEvent) bool {
+	myPublicEndpoint, theirPublicEndpoint := "", ""
+	if pc.networkConnection.BindTechnique != BindThroughPeer && nee.BindTechnique != BindThroughPeer {
+		myPublicEndpoint = pc.networkConnection.publicAddr.String()
+		theirPublicEndpoint = nee.PublicEndpoint
+	}
+	return sameNAT(myPublicEndpoint, theirPublicEndpoint, pc.localGatewayHash(), nee.GatewayHash)
+}
+
+// privateEndpoint returns the private endpoint of the peer to connect to, probing its addresses when it has several
+// The host candidates of the peer share the addresses of its WireGuard port, the first address that answers the connectivity checks is used
+// Otherwise the address in one of the subnets of this device is preferred over the one the peer uses to reach the Internet
+func (pc *PeerConnection) privateEndpoint(nee *NetworkEndpointEvent) string {
+	_, port, err := net.SplitHostPort(nee.PrivateEndpoint)
+	if err != nil {
+		return nee.PrivateEndpoint
+	}
+
+	tunnel := pc.tunnelNetwork()
+	remote := []Candidate{}
+	for _, c := range nee.Candidates {
+		addr, err := net.ResolveUDPAddr(udp, c.Endpoint)
+		if err != nil || c.Type != CandidateHost || c.Interface != "" || addr.IP.To4() == nil {
+			continue
+		}
+		if tunnel != nil && tunnel.Contains(addr.IP) {
+			continue
+		}
+		remote = append(remote, c)
+	}
+	if len(remote) < 2 {
+		return nee.PrivateEndpoint
+	}
+
+	if raddr, err := pc.networkConnection.CheckCandidates(pc.networkConnection.Candidates(), remote, pc.IAmTheSmallestKey()); err == nil {
+		pc.logger.Info.Println("The private address", raddr.IP, "of", pc.peerID, "answered the connectivity checks")
+		return net.JoinHostPort(raddr.IP.String(), port)
+	}
+
+	mine := privateAddresses(tunnel)
+	for _, c := range remote {
+		if addr, err := net.ResolveUDPAddr(udp, c.Endpoint); err == nil && inSubnets(addr.IP, mine) {
+			return net.JoinHostPort(addr.IP.String(), port)
+		}
+	}
+	return nee.PrivateEndpoint
+}
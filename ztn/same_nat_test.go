@@ -0,0 +1,47 @@
+package ztn
+
+import "testing"
+
+func TestSameNAT(t *testing.T) {
+	tests := []struct {
+		name                  string
+		myPublic, theirPublic string
+		myHash, theirHash     string
+		expected              bool
+	}{
+		{"same public IP", "203.0.113.7:6969", "203.0.113.7:7070", "", "", true},
+		{"different public IPs", "203.0.113.7:6969", "198.51.100.2:6969", "", "", false},
+		{"unknown public endpoint", "<nil>", "<nil>", "", "", false},
+		{"same gateway", "203.0.113.7:6969", "198.51.100.2:6969", "gw-hash", "gw-hash", true},
+		{"different gateways", "203.0.113.7:6969", "198.51.100.2:6969", "gw-hash", "other-gw-hash", false},
+		{"unknown gateways", "203.0.113.7:6969", "198.51.100.2:6969", "", "", false},
+	}
+	for _, test := range tests {
+		if res := sameNAT(test.myPublic, test.theirPublic, test.myHash, test.theirHash); res != test.expected {
+			t.Error(test.name, ": got", res, "instead of", test.expected)
+		}
+		// Both peers must reach the same conclusion
+		if res := sameNAT(test.theirPublic, test.myPublic, test.theirHash, test.myHash); res != test.expected {
+			t.Error(test.name, ": got", res, "instead of", test.expected, "from the side of the peer")
+		}
+	}
+}
+
+func TestGatewayHash(t *testing.T) {
+	alice := [32]byte{1}
+	bob := [32]byte{2}
+	const mac = "00:11:22:33:44:55"
+
+	if gatewayHash(mac, alice) != gatewayHash(mac, alice) {
+		t.Error("The same gateway doesn't give the same hash to a peer")
+	}
+	if gatewayHash(mac, alice) == gatewayHash(mac, bob) {
+		t.Error("The same gateway gives the same hash to different peers")
+	}
+	if gatewayHash(mac, alice) == gatewayHash("00:11:22:33:44:56", alice) {
+		t.Error("Different gateways give the same hash")
+	}
+	if gatewayHash("", alice) != "" {
+		t.Error("An unknown gateway has a hash")
+	}
+}
@@ -0,0 +1,177 @@
+package ztn
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/inverse-inc/packetfence/go/sharedutils"
+	securerandom "github.com/theckman/go-securerandom"
+)
+
+// How long the nonces of the endpoint events are remembered, measured with the local clock only
+var networkEndpointEventReplayWindow = 5 * time.Minute
+
+// How many of the previous connection attempts of a peer are remembered to refuse their events
+const maxRetiredPeerNonces = 64
+
+// SealedNetworkEndpointEvent is a network endpoint event encrypted with the shared secret of the static keys of the two peers
+// Only the peer can decrypt it and successfully decrypting it proves that the other peer sealed it
+type SealedNetworkEndpointEvent struct {
+	// The public key of the peer that sealed the event
+	Sender string `json:"sender"`
+	Sealed []byte `json:"sealed"`
+}
+
+func peersSharedSecret(privateKey, peerPublicKey string) ([32]byte, error) {
+	priv, err := remoteclients.B64KeyToBytes(privateKey)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	pub, err := remoteclients.B64KeyToBytes(peerPublicKey)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return remoteclients.SharedSecret(priv, pub), nil
+}
+
+// sealNetworkEndpointEvent encrypts an endpoint event to the peer, it gets a new nonce so the peer can detect its replays
+func sealNetworkEndpointEvent(nee NetworkEndpointEvent, privateKey, peerPublicKey string) (Event, error) {
+	var err error
+	nee.EventNonce, err = securerandom.Uint64()
+	if err != nil {
+		return Event{}, err
+	}
+
+	sharedSecret, err := peersSharedSecret(privateKey, peerPublicKey)
+	if err != nil {
+		return Event{}, err
+	}
+	sealed, err := remoteclients.EncryptMessage(sharedSecret[:], nee.ToJSON())
+	if err != nil {
+		return Event{}, err
+	}
+
+	data, err := json.Marshal(SealedNetworkEndpointEvent{Sender: nee.ID, Sealed: sealed})
+	sharedutils.CheckError(err)
+	return Event{Type: EventTypeSealedNetworkEndpoint, Data: data}, nil
+}
+
+// openNetworkEndpointEvent decrypts an endpoint event sealed by the peer
+// The ID inside the event must be the one of the peer, which rejects the events of this device reflected back to it
+func openNetworkEndpointEvent(e Event, privateKey, peerPublicKey string) (*NetworkEndpointEvent, error) {
+	if e.Type != EventTypeSealedNetworkEndpoint {
+		return nil, errors.New("the endpoint event isn't sealed")
+	}
+	sealed := SealedNetworkEndpointEvent{}
+	if err := json.Unmarshal(e.Data, &sealed); err != nil {
+		return nil, err
+	}
+	if sealed.Sender != peerPublicKey {
+		return nil, errors.New("the endpoint event was sealed by another peer")
+	}
+
+	sharedSecret, err := peersSharedSecret(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := remoteclients.DecryptMessage(sharedSecret[:], sealed.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	nee := &NetworkEndpointEvent{}
+	if err := json.Unmarshal(data, nee); err != nil {
+		return nil, err
+	}
+	if nee.ID != peerPublicKey {
+		return nil, errors.New("the endpoint event doesn't come from the peer")
+	}
+	return nee, nil
+}
+
+// replayWindow remembers the nonces of the endpoint events received recently
+// The clock of the peer is never used: the nonces are forgotten networkEndpointEventReplayWindow after they were received.
+// Past this window, the events of a previous connection attempt of the peer are refused using its attempt nonce
+// and the events that acknowledge a nonce must acknowledge the current one of this device, see staleNetworkEndpointEvent
+type replayWindow struct {
+	sync.Mutex
+	seen map[uint64]time.Time
+	// The hashes of the events that aren't sealed, they have no nonce
+	seenUnsealed map[[sha256.Size]byte]time.Time
+	// Set once the peer sent a sealed event, its events that aren't sealed are then refused
+	peerSeals bool
+	// The connection attempt of the peer its last accepted event belongs to and the ones it replaced, oldest first
+	peerNonce        uint64
+	retiredPeerNonce []uint64
+}
+
+func newReplayWindow() *replayWindow {
+	return &replayWindow{seen: map[uint64]time.Time{}, seenUnsealed: map[[sha256.Size]byte]time.Time{}}
+}
+
+// Check records the nonce of an event received at now and returns an error when the event was already received
+// or belongs to a connection attempt the peer already replaced
+func (rw *replayWindow) Check(nee *NetworkEndpointEvent, now time.Time) error {
+	if nee.EventNonce == 0 {
+		return errors.New("the endpoint event has no nonce")
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+	for nonce, receivedOn := range rw.seen {
+		if now.Sub(receivedOn) > networkEndpointEventReplayWindow {
+			delete(rw.seen, nonce)
+		}
+	}
+	if _, ok := rw.seen[nee.EventNonce]; ok {
+		return errors.New("the endpoint event was already received")
+	}
+	for _, retired := range rw.retiredPeerNonce {
+		if nee.Nonce != 0 && nee.Nonce == retired {
+			return errors.New("the endpoint event belongs to a previous connection attempt of the peer")
+		}
+	}
+
+	rw.seen[nee.EventNonce] = now
+	rw.peerSeals = true
+	if nee.Nonce != 0 && nee.Nonce != rw.peerNonce {
+		if rw.peerNonce != 0 {
+			rw.retiredPeerNonce = append(rw.retiredPeerNonce, rw.peerNonce)
+			if len(rw.retiredPeerNonce) > maxRetiredPeerNonces {
+				rw.retiredPeerNonce = rw.retiredPeerNonce[1:]
+			}
+		}
+		rw.peerNonce = nee.Nonce
+	}
+	return nil
+}
+
+// CheckUnsealed returns an error when an endpoint event that isn't sealed, received at now, can't be accepted
+// They are only accepted from the peers that never sent a sealed event, and only once since data holds the SentOn of the event
+// Nothing authenticates them, which is why they are refused unless accept_unsealed_endpoint_events is enabled
+func (rw *replayWindow) CheckUnsealed(nee *NetworkEndpointEvent, data []byte, peerPublicKey string, now time.Time) error {
+	if nee.ID != peerPublicKey {
+		return errors.New("the endpoint event doesn't come from the peer")
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+	if rw.peerSeals {
+		return errors.New("the endpoint event isn't sealed while the peer seals its events")
+	}
+	for hash, receivedOn := range rw.seenUnsealed {
+		if now.Sub(receivedOn) > networkEndpointEventReplayWindow {
+			delete(rw.seenUnsealed, hash)
+		}
+	}
+	hash := sha256.Sum256(data)
+	if _, ok := rw.seenUnsealed[hash]; ok {
+		return errors.New("the endpoint event was already received")
+	}
+	rw.seenUnsealed[hash] = now
+	return nil
+}
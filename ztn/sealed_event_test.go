@@ -0,0 +1,113 @@
+package ztn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSealNetworkEndpointEvent(t *testing.T) {
+	alicePriv, alicePub := testKeyPair(t)
+	bobPriv, bobPub := testKeyPair(t)
+	evePriv, _ := testKeyPair(t)
+
+	e, err := sealNetworkEndpointEvent(NetworkEndpointEvent{ID: alicePub, PublicEndpoint: "203.0.113.7:6969", SentOn: time.Now()}, alicePriv, bobPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nee, err := openNetworkEndpointEvent(e, bobPriv, alicePub)
+	if err != nil {
+		t.Fatal("The peer couldn't open the event:", err)
+	}
+	if nee.PublicEndpoint != "203.0.113.7:6969" || nee.EventNonce == 0 {
+		t.Error("Unexpected opened event", nee)
+	}
+
+	if _, err := openNetworkEndpointEvent(e, evePriv, alicePub); err == nil {
+		t.Error("Another device could open the event")
+	}
+
+	// Eve can't pass for Alice using her own key
+	spoofed, _ := sealNetworkEndpointEvent(NetworkEndpointEvent{ID: alicePub, SentOn: time.Now()}, evePriv, bobPub)
+	if _, err := openNetworkEndpointEvent(spoofed, bobPriv, alicePub); err == nil {
+		t.Error("An event sealed by another device was accepted")
+	}
+
+	// An event of Bob sent back to him decrypts with the same shared secret but holds his own ID
+	reflected, _ := sealNetworkEndpointEvent(NetworkEndpointEvent{ID: bobPub, SentOn: time.Now()}, bobPriv, alicePub)
+	sealed := SealedNetworkEndpointEvent{}
+	json.Unmarshal(reflected.Data, &sealed)
+	sealed.Sender = alicePub
+	reflected.Data, _ = json.Marshal(sealed)
+	if _, err := openNetworkEndpointEvent(reflected, bobPriv, alicePub); err == nil {
+		t.Error("An event reflected back to its sender was accepted")
+	}
+
+	if _, err := openNetworkEndpointEvent(Event{Type: EventTypeNetworkEndpoint, Data: nee.ToJSON()}, bobPriv, alicePub); err == nil {
+		t.Error("A cleartext event was accepted")
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	now := time.Now()
+	rw := newReplayWindow()
+
+	// The clock of the peer doesn't matter
+	nee := &NetworkEndpointEvent{EventNonce: 42, Nonce: 1, SentOn: now.Add(-24 * time.Hour)}
+	if err := rw.Check(nee, now); err != nil {
+		t.Error("A new event was refused:", err)
+	}
+	if err := rw.Check(nee, now.Add(time.Second)); err == nil {
+		t.Error("A replayed event was accepted")
+	}
+	if err := rw.Check(&NetworkEndpointEvent{SentOn: now}, now); err == nil {
+		t.Error("An event without nonce was accepted")
+	}
+
+	// The peer starts a new connection attempt, the events of the previous one are refused
+	if err := rw.Check(&NetworkEndpointEvent{EventNonce: 43, Nonce: 2}, now); err != nil {
+		t.Error("The event of a new attempt was refused:", err)
+	}
+	if err := rw.Check(&NetworkEndpointEvent{EventNonce: 44, Nonce: 2}, now); err != nil {
+		t.Error("Another event of the current attempt was refused:", err)
+	}
+	if err := rw.Check(&NetworkEndpointEvent{EventNonce: 45, Nonce: 1}, now); err == nil {
+		t.Error("An event of a previous attempt was accepted")
+	}
+
+	// The nonces of the events are forgotten once the window passed, measured with the local clock
+	later := now.Add(networkEndpointEventReplayWindow + time.Second)
+	rw.Check(&NetworkEndpointEvent{EventNonce: 46, Nonce: 2}, later)
+	if _, ok := rw.seen[42]; ok {
+		t.Error("The nonce of an expired event was kept")
+	}
+	if err := rw.Check(nee, later); err == nil {
+		t.Error("An expired event of a previous attempt was accepted")
+	}
+}
+
+func TestReplayWindowUnsealed(t *testing.T) {
+	_, alicePub := testKeyPair(t)
+	_, evePub := testKeyPair(t)
+	now := time.Now()
+	rw := newReplayWindow()
+
+	nee := &NetworkEndpointEvent{ID: alicePub, SentOn: now}
+	if err := rw.CheckUnsealed(nee, nee.ToJSON(), alicePub, now); err != nil {
+		t.Error("The cleartext event of a peer that doesn't seal its events was refused:", err)
+	}
+	if err := rw.CheckUnsealed(nee, nee.ToJSON(), alicePub, now.Add(time.Second)); err == nil {
+		t.Error("A replayed cleartext event was accepted")
+	}
+	spoofed := &NetworkEndpointEvent{ID: evePub, SentOn: now}
+	if err := rw.CheckUnsealed(spoofed, spoofed.ToJSON(), alicePub, now); err == nil {
+		t.Error("The cleartext event of another peer was accepted")
+	}
+
+	rw.Check(&NetworkEndpointEvent{EventNonce: 42}, now)
+	next := &NetworkEndpointEvent{ID: alicePub, SentOn: now.Add(time.Second)}
+	if err := rw.CheckUnsealed(next, next.ToJSON(), alicePub, now); err == nil {
+		t.Error("A cleartext event was accepted from a peer that seals its events")
+	}
+}
@@ -0,0 +1,41 @@
+package ztn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/inverse-inc/wireguard-go/util"
+)
+
+// ServerTLSConfig returns the TLS configuration used for all the connections to the server: the API, the events and the DNS over HTTPS
+func (c *Config) ServerTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !c.ServerVerifyTLS}
+
+	if c.ServerCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ServerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the server CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in the server CA file %s", c.ServerCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load the client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.ServerPinnedKeys) > 0 {
+		tlsConfig.VerifyPeerCertificate = util.VerifySPKIPins(c.ServerPinnedKeys)
+	}
+
+	return tlsConfig, nil
+}
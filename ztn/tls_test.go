@@ -0,0 +1,88 @@
+package ztn
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inverse-inc/wireguard-go/util"
+	"github.com/inverse-inc/wireguard-go/ztn/ztntest"
+)
+
+func TestServerTLSConfig(t *testing.T) {
+	srv := ztntest.NewServer()
+	defer srv.Close()
+
+	get := func(c *Config) error {
+		tlsConfig, err := c.ServerTLSConfig()
+		if err != nil {
+			t.Fatal("Unable to build the TLS configuration", err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(srv.URL + "/dns-query")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	pin := util.SPKIHash(srv.Certificate())
+	otherSum := sha256.Sum256([]byte("other"))
+	otherPin := base64.StdEncoding.EncodeToString(otherSum[:])
+
+	if err := get(&Config{ServerVerifyTLS: true}); err == nil {
+		t.Error("Server with an unknown CA was trusted")
+	}
+	if err := get(&Config{ServerVerifyTLS: false, ServerPinnedKeys: []string{otherPin}}); err == nil {
+		t.Error("Server that doesn't match the pinned key was trusted")
+	}
+	if err := get(&Config{ServerVerifyTLS: false, ServerPinnedKeys: []string{otherPin, pin}}); err != nil {
+		t.Error("Server matching the pinned key wasn't trusted", err)
+	}
+
+	path, cleanup := writeTestConfig(t, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	defer cleanup()
+	if err := get(&Config{ServerVerifyTLS: true, ServerCAFile: path}); err != nil {
+		t.Error("Server signed by the CA file wasn't trusted", err)
+	}
+	if err := get(&Config{ServerVerifyTLS: true, ServerCAFile: path, ServerPinnedKeys: []string{otherPin}}); err == nil {
+		t.Error("Server that doesn't match the pinned key was trusted with a valid chain")
+	}
+
+	badCA := filepath.Join(filepath.Dir(path), "bad.pem")
+	ioutil.WriteFile(badCA, []byte("not a certificate"), 0600)
+	if _, err := (&Config{ServerCAFile: badCA}).ServerTLSConfig(); err == nil {
+		t.Error("CA file without certificates was accepted")
+	}
+}
+
+func TestLoadConfigTLS(t *testing.T) {
+	sum := sha256.Sum256([]byte("server"))
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	path, cleanup := writeTestConfig(t, `
+server_pinned_keys:
+  - `+pin+`
+  - `+pin+`
+client_cert_file: /etc/client.pem
+`)
+	defer cleanup()
+
+	c, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "client_key_file") {
+		t.Error("Client certificate without a key wasn't reported", err)
+	}
+	if len(c.ServerPinnedKeys) != 2 || c.ServerPinnedKeys[0] != pin {
+		t.Error("Pinned keys weren't loaded from the list", c.ServerPinnedKeys)
+	}
+
+	path, cleanup = writeTestConfig(t, "server_pinned_keys: notapin\n")
+	defer cleanup()
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "server_pinned_keys") {
+		t.Error("Invalid pin wasn't reported", err)
+	}
+}
@@ -0,0 +1,172 @@
+package ztn
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How often the STUN binding of each underlay socket is refreshed so the NAT keeps its mapping
+var underlayKeepaliveInterval = 15 * time.Second
+
+var errUnderlaysUnsupported = errors.New("pinning a socket to an interface isn't supported on this platform")
+
+// underlaySocket is a socket pinned to one of the interfaces of a multi-homed host
+type underlaySocket struct {
+	iface string
+	conn  *net.UDPConn
+	// The address seen by the STUN server through this interface
+	reflexiveAddr *net.UDPAddr
+}
+
+// underlayInterface is an interface that can reach the Internet on its own
+type underlayInterface struct {
+	name  string
+	index int
+	ip    net.IP
+}
+
+// usableUnderlayInterfaces returns the interfaces that are up, aren't loopback and have a global IPv4 address, ordered by name
+func usableUnderlayInterfaces() []underlayInterface {
+	usable := []underlayInterface{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return usable
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		// The tunnel interfaces can't carry their own packets
+		if iface.Flags&net.FlagPointToPoint != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			usable = append(usable, underlayInterface{name: iface.Name, index: iface.Index, ip: ipnet.IP})
+			break
+		}
+	}
+	sort.Slice(usable, func(i, j int) bool {
+		return usable[i].name < usable[j].name
+	})
+	return usable
+}
+
+func underlayInterfaceNames(ifaces []underlayInterface) string {
+	names := []string{}
+	for _, iface := range ifaces {
+		names = append(names, iface.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// openUnderlays opens a socket pinned to each usable interface when the host has more than one
+// With a single interface the main connection socket already goes through it
+func (nc *NetworkConnection) openUnderlays() {
+	ifaces := usableUnderlayInterfaces()
+
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	nc.underlayInterfaces = underlayInterfaceNames(ifaces)
+	if len(ifaces) < 2 {
+		return
+	}
+
+	for _, iface := range ifaces {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: iface.ip})
+		if err != nil {
+			nc.logger.Error.Println("Unable to open an underlay socket on", iface.name, ":", err)
+			continue
+		}
+		if err := bindUnderlayToInterface(conn, iface.index); err != nil {
+			conn.Close()
+			if err == errUnderlaysUnsupported {
+				nc.logger.Debug.Println("Not opening the underlay sockets:", err)
+				return
+			}
+			nc.logger.Error.Println("Unable to pin the underlay socket to", iface.name, ":", err)
+			continue
+		}
+		nc.logger.Info.Println("Opened underlay socket", conn.LocalAddr(), "on", iface.name)
+		nc.underlays = append(nc.underlays, &underlaySocket{iface: iface.name, conn: conn})
+		nc.listen(conn, nc.messageChan)
+	}
+}
+
+func (nc *NetworkConnection) closeUnderlays() {
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	for _, u := range nc.underlays {
+		u.conn.Close()
+	}
+	nc.underlays = nil
+	nc.underlayInterfaces = ""
+}
+
+// refreshUnderlays sends a STUN binding request on each underlay socket which keeps its NAT mapping alive and gives its reflexive address
+func (nc *NetworkConnection) refreshUnderlays(stunAddr *net.UDPAddr) {
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	for _, u := range nc.underlays {
+		if err := sendBindingRequest(u.conn, stunAddr); err != nil {
+			nc.logger.Debug.Println("Unable to refresh the underlay socket on", u.iface, ":", err)
+		}
+	}
+}
+
+// setUnderlayReflexiveAddr records the reflexive address of the underlay socket conn and returns whether conn is an underlay socket
+func (nc *NetworkConnection) setUnderlayReflexiveAddr(conn *net.UDPConn, addr *net.UDPAddr) bool {
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	for _, u := range nc.underlays {
+		if u.conn == conn {
+			u.reflexiveAddr = addr
+			return true
+		}
+	}
+	return false
+}
+
+// underlayConns returns the sockets the peers can be reached through: the main connection socket followed by the underlay sockets
+func (nc *NetworkConnection) underlayConns() []*net.UDPConn {
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	conns := []*net.UDPConn{nc.localConn}
+	for _, u := range nc.underlays {
+		conns = append(conns, u.conn)
+	}
+	return conns
+}
+
+// underlayCandidates returns the candidates of the underlay sockets, after the ones of the main connection socket
+func (nc *NetworkConnection) underlayCandidates() []Candidate {
+	nc.underlaysLock.Lock()
+	defer nc.underlaysLock.Unlock()
+	candidates := []Candidate{}
+	for i, u := range nc.underlays {
+		preference := uint32(16383 - i)
+		candidates = append(candidates, Candidate{Type: CandidateHost, Endpoint: u.conn.LocalAddr().String(), Priority: candidatePriority(CandidateHost, preference), Interface: u.iface})
+		if u.reflexiveAddr != nil {
+			candidates = append(candidates, Candidate{Type: CandidateServerReflexive, Endpoint: u.reflexiveAddr.String(), Priority: candidatePriority(CandidateServerReflexive, preference), Interface: u.iface})
+		}
+	}
+	return candidates
+}
+
+// nextUnderlayIndex returns the index of the socket to fail over to from the one at current, or -1 when they were all tried since the last success
+func nextUnderlayIndex(current, count, failovers int) int {
+	if count < 2 || failovers >= count-1 {
+		return -1
+	}
+	return (current + 1) % count
+}
@@ -0,0 +1,14 @@
+// +build linux,!android
+
+package ztn
+
+import (
+	"net"
+
+	"github.com/inverse-inc/wireguard-go/conn"
+)
+
+// bindUnderlayToInterface pins a socket to an interface with SO_BINDTODEVICE so it isn't subject to the default route
+func bindUnderlayToInterface(c *net.UDPConn, interfaceIndex int) error {
+	return conn.BindUDPConnToInterface(c, uint32(interfaceIndex))
+}
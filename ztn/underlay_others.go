@@ -0,0 +1,10 @@
+// +build !linux android
+
+package ztn
+
+import "net"
+
+// bindUnderlayToInterface isn't supported outside of Linux, only the main connection socket is used
+func bindUnderlayToInterface(c *net.UDPConn, interfaceIndex int) error {
+	return errUnderlaysUnsupported
+}
@@ -0,0 +1,114 @@
+package ztn
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/inverse-inc/wireguard-go/device"
+)
+
+func TestNextUnderlayIndex(t *testing.T) {
+	tests := []struct {
+		current, count, failovers int
+		expected                  int
+	}{
+		{0, 1, 0, -1},
+		{0, 3, 0, 1},
+		{1, 3, 1, 2},
+		{2, 3, 1, 0},
+		{0, 3, 2, -1},
+	}
+	for _, test := range tests {
+		if next := nextUnderlayIndex(test.current, test.count, test.failovers); next != test.expected {
+			t.Error("Got", next, "instead of", test.expected, "for", test)
+		}
+	}
+}
+
+func TestUnderlayCandidates(t *testing.T) {
+	nc := &NetworkConnection{}
+	for _, iface := range []string{"eth0", "wwan0"} {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		nc.underlays = append(nc.underlays, &underlaySocket{iface: iface, conn: conn})
+	}
+	nc.underlays[1].reflexiveAddr = &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 40000}
+
+	candidates := nc.underlayCandidates()
+	if len(candidates) != 3 {
+		t.Fatal("Unexpected candidates", candidates)
+	}
+	if c := candidates[2]; c.Type != CandidateServerReflexive || c.Interface != "wwan0" || c.Endpoint != "198.51.100.7:40000" {
+		t.Error("Unexpected reflexive candidate", c)
+	}
+	if candidates[0].Priority <= candidates[1].Priority {
+		t.Error("The first interface isn't preferred", candidates)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	defer func(timeout, delay time.Duration) {
+		ConnectivityCheckTimeout, ConnectivityCheckNominationDelay = timeout, delay
+	}(ConnectivityCheckTimeout, ConnectivityCheckNominationDelay)
+	ConnectivityCheckTimeout, ConnectivityCheckNominationDelay = 1*time.Second, 300*time.Millisecond
+
+	logger := device.NewLogger(device.LogLevelSilent, "")
+	nc := &NetworkConnection{logger: logger, checks: map[uint64]chan bool{}, setBridgeChan: make(chan bridgeUpdate, 1)}
+	nc.localConn = serveConnectivityChecks(t, nc, nil)
+	defer nc.localConn.Close()
+	wwan := serveConnectivityChecks(t, nc, nil)
+	defer wwan.Close()
+	nc.underlays = []*underlaySocket{{iface: "wwan0", conn: wwan}}
+
+	// The previous endpoint of the peer doesn't answer and its other endpoint can only be reached through wwan0
+	peer := &NetworkConnection{logger: logger, checks: map[uint64]chan bool{}}
+	previous, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer previous.Close()
+	reachable := serveConnectivityChecks(t, peer, wwan.LocalAddr())
+	defer reachable.Close()
+
+	stunPeerConn, err := net.ListenUDP(udp, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stunPeerConn.Close()
+
+	pc := &PeerConnection{
+		logger:            logger,
+		networkConnection: nc,
+		ConnectionType:    ConnectionTypeICE,
+		stunPeerConn:      stunPeerConn,
+		peerAddr:          previous.LocalAddr().(*net.UDPAddr),
+		peerCandidates: []Candidate{
+			{Type: CandidateHost, Endpoint: previous.LocalAddr().String(), Priority: candidatePriority(CandidateHost, 1)},
+			{Type: CandidateServerReflexive, Endpoint: reachable.LocalAddr().String(), Priority: candidatePriority(CandidateServerReflexive, 1)},
+		},
+	}
+
+	addr := pc.failover()
+	if addr == nil || addr.String() != reachable.LocalAddr().String() {
+		t.Fatal("The failover didn't use the endpoint that answered from the new socket", addr)
+	}
+	if pc.peerAddr.String() != addr.String() || pc.underlayIndex != 1 {
+		t.Error("The path of the connection wasn't updated", pc.peerAddr, pc.underlayIndex)
+	}
+	select {
+	case u := <-nc.setBridgeChan:
+		if u.bridge.conn != wwan || u.bridge.raddr.String() != addr.String() {
+			t.Error("Unexpected bridge after the failover", u.bridge.conn.LocalAddr(), u.bridge.raddr)
+		}
+	default:
+		t.Error("The bridge wasn't switched to the new socket")
+	}
+
+	if pc.failover() != nil {
+		t.Error("The connection failed over again while all the sockets were tried")
+	}
+}
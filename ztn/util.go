@@ -4,7 +4,10 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/inverse-inc/packetfence/go/remoteclients"
 	"github.com/inverse-inc/packetfence/go/sharedutils"
@@ -16,6 +19,7 @@ const (
 	STATUS_CONNECTED      = "CONNECTED"
 	STATUS_ERROR          = "ERROR"
 	STATUS_FETCHING_PEERS = "FETCHING_PEERS"
+	STATUS_DEGRADED       = "DEGRADED"
 	STATUS_NOT_READY      = ""
 
 	PEER_STATUS_CONNECTED             = "Connected"
@@ -71,7 +75,7 @@ func ipv4MaskString(mask int) string {
 }
 
 func RunningInCLI() bool {
-	return sharedutils.EnvOrDefault("WG_CLI", "true") == "true"
+	return GetConfig().CLI
 }
 
 var privateIPBlocks []*net.IPNet
@@ -115,3 +119,34 @@ func PauseOnError(quit func()) {
 		util.Pause()
 	}
 }
+
+// writeFileAtomic writes the data to a temporary file which then replaces the file at path
+// A crash never leaves a partially written file behind and the file is only readable by its owner
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -4,4 +4,9 @@ import "net"
 
 var localWGIP = net.ParseIP("127.0.0.1")
 
-const localWGPort = 12674
+// The WireGuard port of the main instance
+const baseLocalWGPort = 12674
+
+func localWGPort() int {
+	return CurrentInstance().Port(baseLocalWGPort)
+}
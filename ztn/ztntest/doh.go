@@ -0,0 +1,102 @@
+package ztntest
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const dohMimeType = "application/dns-message"
+
+func canonicalName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+// handleDNSQuery resolves the names set through SetDNSRecord
+func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
+	s.serveDoH(w, r, func(name string) net.IP {
+		s.Lock()
+		defer s.Unlock()
+		return s.dnsRecords[name]
+	})
+}
+
+// handleDNSZTNQuery resolves the hostnames of the clients to their WireGuard IP, whatever the domain they are queried in
+// The names set through SetDNSRecord are resolved as well
+func (s *Server) handleDNSZTNQuery(w http.ResponseWriter, r *http.Request) {
+	s.serveDoH(w, r, func(name string) net.IP {
+		s.Lock()
+		defer s.Unlock()
+		if ip, ok := s.dnsRecords[name]; ok {
+			return ip
+		}
+		host := strings.SplitN(name, ".", 2)[0]
+		for _, p := range s.profiles {
+			if p.Hostname != "" && strings.EqualFold(p.Hostname, host) {
+				return p.WireguardIP
+			}
+		}
+		return nil
+	})
+}
+
+// serveDoH implements the GET and POST methods of RFC 8484
+func (s *Server) serveDoH(w http.ResponseWriter, r *http.Request, resolve func(name string) net.IP) {
+	var raw []byte
+	var err error
+	switch r.Method {
+	case "GET":
+		raw, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case "POST":
+		if r.Header.Get("Content-Type") != dohMimeType {
+			http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		raw, err = ioutil.ReadAll(r.Body)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to read the DNS query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &dns.Msg{}
+	if err := req.Unpack(raw); err != nil {
+		http.Error(w, "Unable to decode the DNS query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reply := &dns.Msg{}
+	reply.SetReply(req)
+	reply.Rcode = dns.RcodeNameError
+	for _, q := range req.Question {
+		ip := resolve(canonicalName(q.Name))
+		if ip == nil {
+			continue
+		}
+		reply.Rcode = dns.RcodeSuccess
+		hdr := dns.RR_Header{Name: q.Name, Class: dns.ClassINET, Ttl: 60}
+		if ip4 := ip.To4(); ip4 != nil && q.Qtype == dns.TypeA {
+			hdr.Rrtype = dns.TypeA
+			reply.Answer = append(reply.Answer, &dns.A{Hdr: hdr, A: ip4})
+		} else if ip.To4() == nil && q.Qtype == dns.TypeAAAA {
+			hdr.Rrtype = dns.TypeAAAA
+			reply.Answer = append(reply.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+	}
+
+	packed, err := reply.Pack()
+	if err != nil {
+		http.Error(w, "Unable to encode the DNS reply: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohMimeType)
+	w.Write(packed)
+}
@@ -0,0 +1,207 @@
+package ztntest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+)
+
+// Default amount of time a long-poll request waits for events when the client doesn't specify it
+const defaultPollTimeout = 30 * time.Second
+
+// Event is an event as published by the clients and as found in the data of the long-poll events
+type Event struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// PollEvent is an event as returned by the long-poll endpoints
+type PollEvent struct {
+	Timestamp int64           `json:"timestamp"`
+	Category  string          `json:"category"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type pollReply struct {
+	Events    []PollEvent `json:"events,omitempty"`
+	Timeout   string      `json:"timeout,omitempty"`
+	Timestamp int64       `json:"timestamp,omitempty"`
+}
+
+type eventStore struct {
+	sync.Mutex
+	lastTimestamp int64
+	categories    map[string][]PollEvent
+	// Closed and replaced every time an event is added to wake up the pending long-poll requests
+	added chan struct{}
+}
+
+func newEventStore() *eventStore {
+	return &eventStore{
+		categories: map[string][]PollEvent{},
+		added:      make(chan struct{}),
+	}
+}
+
+func (es *eventStore) add(category string, data json.RawMessage) {
+	es.Lock()
+	defer es.Unlock()
+
+	// Timestamps are in milliseconds and must be unique so that since_time never skips an event
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	if ts <= es.lastTimestamp {
+		ts = es.lastTimestamp + 1
+	}
+	es.lastTimestamp = ts
+
+	es.categories[category] = append(es.categories[category], PollEvent{Timestamp: ts, Category: category, Data: data})
+	close(es.added)
+	es.added = make(chan struct{})
+}
+
+func (es *eventStore) since(category string, since int64) ([]PollEvent, chan struct{}) {
+	es.Lock()
+	defer es.Unlock()
+	events := []PollEvent{}
+	for _, e := range es.categories[category] {
+		if e.Timestamp > since {
+			events = append(events, e)
+		}
+	}
+	return events, es.added
+}
+
+func (es *eventStore) all(category string) []PollEvent {
+	events, _ := es.since(category, 0)
+	return events
+}
+
+// PushEvent publishes an event in a public category
+func (s *Server) PushEvent(category string, e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	s.events.add(category, data)
+}
+
+// PushPrivateEvent publishes an event on the private stream of the client identified by its standard base64 public key
+// The event is encrypted with the secret shared between the server and the client, its data is the URL base64 encoding of the encrypted event
+func (s *Server) PushPrivateEvent(publicKey string, e Event) error {
+	pub, err := remoteclients.B64KeyToBytes(publicKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	sharedSecret := remoteclients.SharedSecret(s.PrivateKey, pub)
+	encrypted, err := remoteclients.EncryptMessage(sharedSecret[:], data)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(base64.URLEncoding.EncodeToString(encrypted))
+	if err != nil {
+		return err
+	}
+
+	s.events.add(privateCategory(pub), data)
+	return nil
+}
+
+// Events returns the events that were published in a category, either by the clients or through PushEvent
+func (s *Server) Events(category string) []Event {
+	events := []Event{}
+	for _, pe := range s.events.all(category) {
+		e := Event{}
+		if err := json.Unmarshal(pe.Data, &e); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func privateCategory(pub [32]byte) string {
+	return "private:" + base64.URLEncoding.EncodeToString(pub[:])
+}
+
+func (s *Server) handlePublishEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		replyError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	category := strings.TrimPrefix(r.URL.Path, "/api/v1/remote_clients/events/")
+	if category == "" {
+		replyError(w, http.StatusBadRequest, "Missing category")
+		return
+	}
+
+	e := Event{}
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		replyError(w, http.StatusBadRequest, "Unable to decode the event: "+err.Error())
+		return
+	}
+
+	s.PushEvent(category, e)
+	replyJSON(w, map[string]string{})
+}
+
+func (s *Server) handlePollEvents(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	if category == "" {
+		replyError(w, http.StatusBadRequest, "Missing category")
+		return
+	}
+	s.poll(w, r, category)
+}
+
+// handlePollMyEvents long-polls the private stream of the client identified by the public_key parameter
+func (s *Server) handlePollMyEvents(w http.ResponseWriter, r *http.Request) {
+	pub, err := remoteclients.URLB64KeyToBytes(r.URL.Query().Get("public_key"))
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "Invalid public key: "+err.Error())
+		return
+	}
+	s.poll(w, r, privateCategory(pub))
+}
+
+func (s *Server) poll(w http.ResponseWriter, r *http.Request, category string) {
+	q := r.URL.Query()
+
+	since, _ := strconv.ParseInt(q.Get("since_time"), 10, 64)
+
+	timeout := defaultPollTimeout
+	if seconds, err := strconv.Atoi(q.Get("timeout")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	deadline := time.After(timeout)
+
+	for {
+		events, added := s.events.since(category, since)
+		if len(events) > 0 {
+			replyJSON(w, pollReply{Events: events})
+			return
+		}
+
+		select {
+		case <-added:
+		case <-deadline:
+			replyJSON(w, pollReply{Timeout: "no events before timeout", Timestamp: time.Now().UnixNano() / int64(time.Millisecond)})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,467 @@
+// Package ztntest provides a fake implementation of the PacketFence remote_clients API so that the ztn package can be exercised end to end without a real server
+package ztntest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"golang.org/x/crypto/curve25519"
+)
+
+// ProfileRequest holds the information a client sent when it fetched its profile
+type ProfileRequest struct {
+	PublicKey string
+	MAC       string
+	Hostname  string
+}
+
+// Server is a fake PacketFence server that implements the remote_clients endpoints used by the ztn package along with the DoH endpoints used by the generated Corefile
+type Server struct {
+	*httptest.Server
+	sync.Mutex
+
+	Username string
+	Password string
+
+	PrivateKey [32]byte
+	PublicKey  [32]byte
+
+	tokens          map[string]bool
+	challenges      map[string][]byte
+	profiles        map[string]remoteclients.Peer
+	profileRequests []ProfileRequest
+	events          *eventStore
+	dnsRecords      map[string]net.IP
+
+	// Single use tokens accepted to enroll a device, associated to the IP given to the device
+	enrollmentTokens map[string]net.IP
+	enrolledIPs      int
+
+	// The paths answered with a 404 as a server that doesn't implement them would
+	removedEndpoints map[string]bool
+}
+
+// NewServer starts a fake server over TLS, it must be closed by the caller
+func NewServer() *Server {
+	s := &Server{
+		Username:   "admin",
+		Password:   "admin",
+		tokens:     map[string]bool{},
+		challenges: map[string][]byte{},
+		profiles:   map[string]remoteclients.Peer{},
+		events:     newEventStore(),
+		dnsRecords: map[string]net.IP{},
+
+		enrollmentTokens: map[string]net.IP{},
+		removedEndpoints: map[string]bool{},
+	}
+	s.PrivateKey, s.PublicKey = GenerateKeys()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/login", s.handleLogin)
+	mux.HandleFunc("/api/v1/remote_clients/server_challenge", s.authenticated(s.handleServerChallenge))
+	mux.HandleFunc("/api/v1/remote_clients/profile", s.authenticated(s.handleProfile))
+	mux.HandleFunc("/api/v1/remote_clients/peer/", s.authenticated(s.handlePeer))
+	mux.HandleFunc("/api/v1/remote_clients/rotate_key", s.authenticated(s.handleRotateKey))
+	mux.HandleFunc("/api/v1/remote_clients/enroll", s.authenticated(s.handleEnroll))
+	mux.HandleFunc("/api/v1/remote_clients/events", s.authenticated(s.handlePollEvents))
+	mux.HandleFunc("/api/v1/remote_clients/events/", s.authenticated(s.handlePublishEvent))
+	mux.HandleFunc("/api/v1/remote_clients/my_events", s.authenticated(s.handlePollMyEvents))
+	mux.HandleFunc("/dns-query", s.handleDNSQuery)
+	mux.HandleFunc("/dns-ztn-query", s.handleDNSZTNQuery)
+
+	s.Server = httptest.NewTLSServer(s.implemented(mux))
+	return s
+}
+
+// implemented answers with a 404 for the endpoints that were removed
+func (s *Server) implemented(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		removed := s.removedEndpoints[r.URL.Path]
+		s.Unlock()
+		if removed {
+			replyError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// GenerateKeys generates a WireGuard key pair
+func GenerateKeys() (priv [32]byte, pub [32]byte) {
+	_, err := rand.Read(priv[:])
+	if err != nil {
+		panic(err)
+	}
+	priv[0] &= 248
+	priv[31] = (priv[31] & 127) | 64
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return priv, pub
+}
+
+// Host returns the host the server is listening on
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Hostname()
+}
+
+// Port returns the port the server is listening on
+func (s *Server) Port() string {
+	u, _ := url.Parse(s.URL)
+	return u.Port()
+}
+
+// SetProfile adds or replaces the profile of a client, it is identified by its standard base64 public key
+func (s *Server) SetProfile(profile remoteclients.Peer) {
+	s.Lock()
+	defer s.Unlock()
+	s.profiles[profile.PublicKey] = profile
+}
+
+// RemoveProfile removes the profile of a client which will then fail to authenticate
+func (s *Server) RemoveProfile(publicKey string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.profiles, publicKey)
+}
+
+// ProfileRequests returns the successful profile requests that were made to the server
+func (s *Server) ProfileRequests() []ProfileRequest {
+	s.Lock()
+	defer s.Unlock()
+	requests := make([]ProfileRequest, len(s.profileRequests))
+	copy(requests, s.profileRequests)
+	return requests
+}
+
+// SetDNSRecord sets the address returned by the DoH endpoints for a name
+func (s *Server) SetDNSRecord(name string, ip net.IP) {
+	s.Lock()
+	defer s.Unlock()
+	s.dnsRecords[canonicalName(name)] = ip
+}
+
+// AddEnrollmentToken allows a device to enroll once with the token, it will be given ip
+func (s *Server) AddEnrollmentToken(token string, ip net.IP) {
+	s.Lock()
+	defer s.Unlock()
+	s.enrollmentTokens[token] = ip
+}
+
+// RemoveEndpoint makes the server answer with a 404 on path like the versions of PacketFence that don't implement it
+// The enroll and rotate_key endpoints are only implemented by the servers that support the enrollment and the key rotation
+func (s *Server) RemoveEndpoint(path string) {
+	s.Lock()
+	defer s.Unlock()
+	s.removedEndpoints[path] = true
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		replyError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	login := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		replyError(w, http.StatusBadRequest, "Unable to decode the login request")
+		return
+	}
+
+	if login.Username != s.Username || login.Password != s.Password {
+		replyError(w, http.StatusUnauthorized, "Wrong username or password")
+		return
+	}
+
+	token := make([]byte, 16)
+	rand.Read(token)
+
+	s.Lock()
+	s.tokens[hex.EncodeToString(token)] = true
+	s.Unlock()
+
+	replyJSON(w, map[string]string{"token": hex.EncodeToString(token)})
+}
+
+func (s *Server) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.Lock()
+		ok := s.tokens[token]
+		s.Unlock()
+		if !ok {
+			replyError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) sharedSecret(urlb64PublicKey string) ([32]byte, error) {
+	pub, err := remoteclients.URLB64KeyToBytes(urlb64PublicKey)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return remoteclients.SharedSecret(s.PrivateKey, pub), nil
+}
+
+func (s *Server) handleServerChallenge(w http.ResponseWriter, r *http.Request) {
+	publicKey := r.URL.Query().Get("public_key")
+	sharedSecret, err := s.sharedSecret(publicKey)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "Invalid public key: "+err.Error())
+		return
+	}
+
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+
+	encrypted, err := remoteclients.EncryptMessage(sharedSecret[:], challenge)
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.Lock()
+	s.challenges[publicKey] = challenge
+	s.Unlock()
+
+	replyJSON(w, map[string]string{
+		"challenge":  base64.URLEncoding.EncodeToString(encrypted),
+		"public_key": base64.URLEncoding.EncodeToString(s.PublicKey[:]),
+	})
+}
+
+// verifyChallenge checks that auth is the challenge that was issued to the public key followed by that public key, encrypted with the shared secret
+// A challenge can only be used once
+func (s *Server) verifyChallenge(urlb64PublicKey, auth string) error {
+	s.Lock()
+	challenge, ok := s.challenges[urlb64PublicKey]
+	delete(s.challenges, urlb64PublicKey)
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("No challenge was issued for %s", urlb64PublicKey)
+	}
+
+	sharedSecret, err := s.sharedSecret(urlb64PublicKey)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := base64.URLEncoding.DecodeString(auth)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := remoteclients.DecryptMessage(sharedSecret[:], encrypted)
+	if err != nil {
+		return fmt.Errorf("Unable to decrypt the challenge: %s", err)
+	}
+
+	pub, _ := remoteclients.URLB64KeyToBytes(urlb64PublicKey)
+	expected := append(challenge, pub[:]...)
+	if string(decrypted) != string(expected) {
+		return fmt.Errorf("Challenge doesn't match")
+	}
+	return nil
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	publicKey := q.Get("public_key")
+
+	if err := s.verifyChallenge(publicKey, q.Get("auth")); err != nil {
+		replyError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	pub, _ := remoteclients.URLB64KeyToBytes(publicKey)
+	stdPublicKey := base64.StdEncoding.EncodeToString(pub[:])
+
+	s.Lock()
+	profile, ok := s.profiles[stdPublicKey]
+	if ok {
+		s.profileRequests = append(s.profileRequests, ProfileRequest{PublicKey: stdPublicKey, MAC: q.Get("mac"), Hostname: q.Get("hostname")})
+	}
+	s.Unlock()
+
+	if !ok {
+		replyError(w, http.StatusNotFound, "Unknown public key")
+		return
+	}
+
+	replyJSON(w, profile)
+}
+
+// handlePeer replies with the profile of the peer identified by its URL base64 public key
+// The public key of the peer is also URL base64 encoded in the reply
+func (s *Server) handlePeer(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/remote_clients/peer/")
+	pub, err := remoteclients.URLB64KeyToBytes(id)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "Invalid peer ID: "+err.Error())
+		return
+	}
+
+	s.Lock()
+	profile, ok := s.profiles[base64.StdEncoding.EncodeToString(pub[:])]
+	s.Unlock()
+
+	if !ok {
+		replyError(w, http.StatusNotFound, "Unknown peer")
+		return
+	}
+
+	profile.PublicKey = id
+	replyJSON(w, profile)
+}
+
+// handleRotateKey replaces the public key of a client once it proved it holds the current one
+// The peers that are allowed to connect to the client are updated to its new key and are notified with a profile_updated event
+func (s *Server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		replyError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	req := struct {
+		PublicKey    string `json:"public_key"`
+		Auth         string `json:"auth"`
+		NewPublicKey string `json:"new_public_key"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		replyError(w, http.StatusBadRequest, "Unable to decode the request: "+err.Error())
+		return
+	}
+
+	if err := s.verifyChallenge(req.PublicKey, req.Auth); err != nil {
+		replyError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	newPub, err := remoteclients.URLB64KeyToBytes(req.NewPublicKey)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "Invalid new public key: "+err.Error())
+		return
+	}
+
+	pub, _ := remoteclients.URLB64KeyToBytes(req.PublicKey)
+	oldKey := base64.StdEncoding.EncodeToString(pub[:])
+	newKey := base64.StdEncoding.EncodeToString(newPub[:])
+
+	s.Lock()
+	profile, ok := s.profiles[oldKey]
+	if !ok {
+		s.Unlock()
+		// A 404 tells the clients that the server doesn't implement the rotation
+		replyError(w, http.StatusForbidden, "Unknown public key")
+		return
+	}
+	if _, exists := s.profiles[newKey]; exists {
+		s.Unlock()
+		replyError(w, http.StatusConflict, "The new public key is already used")
+		return
+	}
+
+	delete(s.profiles, oldKey)
+	profile.PublicKey = newKey
+	s.profiles[newKey] = profile
+
+	notify := []string{}
+	for key, p := range s.profiles {
+		for i, peerID := range p.AllowedPeers {
+			if peerID == req.PublicKey {
+				p.AllowedPeers[i] = base64.URLEncoding.EncodeToString(newPub[:])
+				notify = append(notify, key)
+			}
+		}
+	}
+	s.Unlock()
+
+	for _, key := range notify {
+		s.PushPrivateEvent(key, Event{Type: "profile_updated", Data: json.RawMessage("{}")})
+	}
+
+	replyJSON(w, map[string]string{})
+}
+
+// handleEnroll creates the profile of a new device
+// The device gets the IP of its enrollment token or the next free one in 100.64.255.0/24 when it is enrolled with the credentials
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		replyError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	req := struct {
+		PublicKey string `json:"public_key"`
+		Token     string `json:"token"`
+		Hostname  string `json:"hostname"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		replyError(w, http.StatusBadRequest, "Unable to decode the request: "+err.Error())
+		return
+	}
+
+	pub, err := remoteclients.URLB64KeyToBytes(req.PublicKey)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, "Invalid public key: "+err.Error())
+		return
+	}
+	key := base64.StdEncoding.EncodeToString(pub[:])
+
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.profiles[key]; exists {
+		replyError(w, http.StatusConflict, "The public key is already enrolled")
+		return
+	}
+
+	var ip net.IP
+	if req.Token != "" {
+		var ok bool
+		ip, ok = s.enrollmentTokens[req.Token]
+		if !ok {
+			replyError(w, http.StatusForbidden, "Invalid enrollment token")
+			return
+		}
+		delete(s.enrollmentTokens, req.Token)
+	} else {
+		s.enrolledIPs++
+		ip = net.IPv4(100, 64, 255, byte(s.enrolledIPs))
+	}
+
+	s.profiles[key] = remoteclients.Peer{
+		PublicKey:        key,
+		WireguardIP:      ip,
+		WireguardNetmask: 16,
+		Hostname:         req.Hostname,
+	}
+	replyJSON(w, map[string]string{})
+}
+
+func replyJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func replyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "message": message})
+}
@@ -0,0 +1,163 @@
+package ztntest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inverse-inc/packetfence/go/remoteclients"
+	"github.com/miekg/dns"
+)
+
+func login(t *testing.T, srv *Server) string {
+	resp, err := srv.Client().Post(srv.URL+"/api/v1/login", "application/json", strings.NewReader(`{"username":"`+srv.Username+`","password":"`+srv.Password+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reply := map[string]string{}
+	json.NewDecoder(resp.Body).Decode(&reply)
+	if reply["token"] == "" {
+		t.Fatal("Unable to login")
+	}
+	return reply["token"]
+}
+
+func TestLongPoll(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	client := srv.Client()
+	token := login(t, srv)
+	poll := func(since int64) pollReply {
+		reply := pollReply{}
+		req, _ := http.NewRequest("GET", srv.URL+"/api/v1/remote_clients/events?category=test&timeout=5&since_time="+strconv.FormatInt(since, 10), nil)
+		req.Header.Set("Authorization", token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(&reply)
+		return reply
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv.PushEvent("test", Event{Type: "first"})
+	}()
+
+	reply := poll(0)
+	if len(reply.Events) != 1 {
+		t.Fatal("Pending long-poll wasn't woken up by the event", reply)
+	}
+
+	srv.PushEvent("test", Event{Type: "second"})
+	reply = poll(reply.Events[0].Timestamp)
+	if len(reply.Events) != 1 {
+		t.Fatal("Unexpected events after the first one", reply)
+	}
+	e := Event{}
+	json.Unmarshal(reply.Events[0].Data, &e)
+	if e.Type != "second" {
+		t.Error("Unexpected event", e)
+	}
+}
+
+func TestPrivateEvent(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	priv, pub := GenerateKeys()
+	err := srv.PushPrivateEvent(base64.StdEncoding.EncodeToString(pub[:]), Event{Type: "private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := srv.events.all(privateCategory(pub))
+	if len(events) != 1 {
+		t.Fatal("Private event wasn't stored")
+	}
+
+	var encoded string
+	json.Unmarshal(events[0].Data, &encoded)
+	encrypted, _ := base64.URLEncoding.DecodeString(encoded)
+	sharedSecret := remoteclients.SharedSecret(priv, srv.PublicKey)
+	data, err := remoteclients.DecryptMessage(sharedSecret[:], encrypted)
+	if err != nil {
+		t.Fatal("Unable to decrypt the private event", err)
+	}
+	e := Event{}
+	json.Unmarshal(data, &e)
+	if e.Type != "private" {
+		t.Error("Unexpected private event", e)
+	}
+}
+
+func TestDoH(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	srv.SetDNSRecord("www.example.com", net.ParseIP("192.0.2.10"))
+	srv.SetProfile(remoteclients.Peer{PublicKey: "peer", Hostname: "agent1", WireguardIP: net.ParseIP("100.64.0.1")})
+
+	query := func(path, name string) *dns.Msg {
+		req := &dns.Msg{}
+		req.SetQuestion(dns.Fqdn(name), dns.TypeA)
+		packed, _ := req.Pack()
+		resp, err := srv.Client().Get(srv.URL + path + "?dns=" + base64.RawURLEncoding.EncodeToString(packed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 4096)
+		n, _ := resp.Body.Read(buf)
+		reply := &dns.Msg{}
+		if err := reply.Unpack(buf[:n]); err != nil {
+			t.Fatal("Unable to decode the DNS reply", err)
+		}
+		return reply
+	}
+
+	if reply := query("/dns-query", "www.example.com"); len(reply.Answer) != 1 || !reply.Answer[0].(*dns.A).A.Equal(net.ParseIP("192.0.2.10")) {
+		t.Error("Unexpected reply", reply)
+	}
+
+	if reply := query("/dns-ztn-query", "agent1.example.com"); len(reply.Answer) != 1 || !reply.Answer[0].(*dns.A).A.Equal(net.ParseIP("100.64.0.1")) {
+		t.Error("Unexpected reply", reply)
+	}
+
+	if reply := query("/dns-query", "agent1.example.com"); reply.Rcode != dns.RcodeNameError {
+		t.Error("Peer names shouldn't be resolved outside of the ZTN endpoint", reply)
+	}
+}
+
+func TestRemoveEndpoint(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	token := login(t, srv)
+	status := func() int {
+		req, _ := http.NewRequest("POST", srv.URL+"/api/v1/remote_clients/enroll", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", token)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if s := status(); s == http.StatusNotFound {
+		t.Fatal("The enroll endpoint isn't implemented")
+	}
+	srv.RemoveEndpoint("/api/v1/remote_clients/enroll")
+	if s := status(); s != http.StatusNotFound {
+		t.Error("A removed endpoint answered with", s)
+	}
+}